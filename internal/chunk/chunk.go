@@ -7,6 +7,10 @@ import (
 	"strings"
 	"path/filepath"
 	"os/exec"
+
+	"jamtext/internal/minhash"
+	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
 // Chunk represents a section of text with its metadata
@@ -39,6 +43,15 @@ type ChunkOptions struct {
 	PreserveNewlines bool
 	Logger           Logger
 	Verbose          bool
+	Vectorizer       simhash.VectorizerConfig // Zero value selects the default vectorizer
+	Normalizer       simhash.Normalizer       // Zero value leaves text as it is
+	Language         simhash.Language         // Empty selects plain words
+	Algorithm        simhash.Algorithm        // Empty selects the default algorithm
+	Bits             int                      // Fingerprint width, 0 selects 64
+	Seed             *int64                   // Seed of the hyperplanes and LSH permutations, nil selects the default
+	LSHBands         int                      // LSH bands, 0 selects one per 16 fingerprint bits
+	MinHash          minhash.Config           // Per-chunk MinHash signatures; zero stores none
+	Winnow           winnow.Config            // Passage fingerprints of the whole file; zero stores none
 }
 
 // Logger interface for logging operations
@@ -2,56 +2,111 @@ package chunk
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 	"unicode/utf8"
 
 	"jamtext/internal/index"
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
 // ChunkProcessor handles the processing of file chunks
 type ChunkProcessor struct {
 	pool        *WorkerPool
 	resultChan  chan ProcessResult
+	algorithm   simhash.Algorithm
+	bits        int
 	vectorizer  simhash.Vectorizer
 	hyperplanes [][]float64
+	projector   *simhash.Projector // Nil for Charikar
+	minhasher   *minhash.Hasher
 }
 
 // ProcessResult represents the result of processing a chunk
 type ProcessResult struct {
-	Hash  simhash.SimHash
-	Pos   int64
-	Error error
+	Hash        simhash.SimHash // Lowest 64 bits of Fingerprint
+	Fingerprint simhash.Fingerprint
+	MinHash     minhash.Signature // Nil unless MinHash signatures are enabled
+	Pos         int64
+	Length      int
+	Error       error
 }
 
 // NewChunkProcessor creates a new chunk processor
 func NewChunkProcessor(numWorkers int, hyperplanes [][]float64) *ChunkProcessor {
+	return NewChunkProcessorWithVectorizer(numWorkers, hyperplanes,
+		simhash.NewFrequencyVectorizer(simhash.VectorDimensions))
+}
+
+// NewChunkProcessorWithVectorizer creates a chunk processor that hashes
+// chunks with the given vectorizer
+func NewChunkProcessorWithVectorizer(numWorkers int, hyperplanes [][]float64, vectorizer simhash.Vectorizer) *ChunkProcessor {
+	return NewChunkProcessorWithAlgorithm(numWorkers, simhash.DefaultAlgorithm, simhash.DefaultFingerprintBits, hyperplanes, vectorizer)
+}
+
+// NewChunkProcessorWithAlgorithm creates a chunk processor that computes
+// fingerprints of the given width with the given algorithm and vectorizer
+func NewChunkProcessorWithAlgorithm(numWorkers int, algorithm simhash.Algorithm, width int, hyperplanes [][]float64, vectorizer simhash.Vectorizer) *ChunkProcessor {
 	if numWorkers <= 0 {
 		numWorkers = runtime.NumCPU()
 	}
 
-	return &ChunkProcessor{
+	cp := &ChunkProcessor{
 		pool:        NewWorkerPool(numWorkers),
 		resultChan:  make(chan ProcessResult, numWorkers*2),
-		vectorizer:  simhash.NewFrequencyVectorizer(simhash.VectorDimensions),
+		algorithm:   algorithm,
+		bits:        width,
+		vectorizer:  vectorizer,
 		hyperplanes: hyperplanes,
 	}
+	if algorithm == simhash.Hyperplane {
+		cp.projector = simhash.NewProjector(width, hyperplanes)
+	}
+	return cp
+}
+
+// SetMinHasher makes the processor compute a MinHash signature for every
+// chunk; it must be called before the first chunk is submitted
+func (cp *ChunkProcessor) SetMinHasher(h *minhash.Hasher) {
+	cp.minhasher = h
 }
 
 // ProcessChunk handles the processing of a single chunk
 func (cp *ChunkProcessor) ProcessChunk(chunk Chunk) {
 	cp.pool.Submit(func() {
-		hash := simhash.CalculateWithVectorizer(chunk.Content, cp.hyperplanes, cp.vectorizer)
+		fp := cp.fingerprint(chunk.Content)
+		length := chunk.Length
+		if length == 0 {
+			length = len(chunk.Content)
+		}
+		var sig minhash.Signature
+		if cp.minhasher != nil {
+			sig = cp.minhasher.Signature(chunk.Content)
+		}
 		cp.resultChan <- ProcessResult{
-			Hash: hash,
-			Pos:  chunk.StartOffset,
+			Hash:        fp.SimHash(),
+			Fingerprint: fp,
+			MinHash:     sig,
+			Pos:         chunk.StartOffset,
+			Length:      length,
 		}
 	})
 }
 
+// fingerprint computes the fingerprint of a chunk's content
+func (cp *ChunkProcessor) fingerprint(content string) simhash.Fingerprint {
+	if cp.projector != nil {
+		return cp.projector.Fingerprint(content, cp.vectorizer)
+	}
+	return simhash.CalculateFingerprint(cp.algorithm, cp.bits, content, cp.hyperplanes, cp.vectorizer)
+}
+
 // Close shuts down the chunk processor
 func (cp *ChunkProcessor) Close() {
 	cp.pool.Close()
@@ -63,9 +118,19 @@ func (cp *ChunkProcessor) Results() <-chan ProcessResult {
 	return cp.resultChan
 }
 
-// isValidUTF8 checks if a byte slice is valid UTF-8
-func isValidUTF8(data []byte) bool {
-	return utf8.Valid(data)
+// trimPartialRune returns the length of data without a trailing incomplete
+// UTF-8 sequence, so chunks never end in the middle of a character
+func trimPartialRune(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if utf8.FullRune(data[i:]) || i == 0 {
+			return len(data)
+		}
+		return i
+	}
+	return len(data)
 }
 
 // max returns the maximum of two integers
@@ -76,18 +141,17 @@ func max(a, b int) int {
 	return b
 }
 
-// findBoundary finds a good boundary to split text
+// findBoundary returns the position just after the last boundary character
+// in the 100 bytes before preferredPos, or preferredPos if there is none
 func findBoundary(text []byte, preferredPos int, boundaryChars string) int {
 	if preferredPos >= len(text) {
-		return len(text)
+		preferredPos = len(text)
 	}
 
 	// Check backward from preferred position
-	for i := preferredPos; i > max(0, preferredPos-100); i-- {
-		for _, c := range boundaryChars {
-			if i < len(text) && text[i] == byte(c) {
-				return i + 1
-			}
+	for i := preferredPos - 1; i >= max(0, preferredPos-100); i-- {
+		if strings.IndexByte(boundaryChars, text[i]) >= 0 {
+			return i + 1
 		}
 	}
 
@@ -103,12 +167,90 @@ func ProcessFile(filename string, opts ChunkOptions, hyperplanes [][]float64, in
 	}
 	defer file.Close()
 
+	// Every chunk is lexed in the language of the whole file
+	if opts.Vectorizer, err = opts.Vectorizer.ForFile(filename); err != nil {
+		return nil, err
+	}
+	vectorizer, vectorizerConfig, language, err := newVectorizer(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer simhash.CloseVectorizer(vectorizer)
+	algorithm, err := simhash.ParseAlgorithm(string(opts.Algorithm))
+	if err != nil {
+		return nil, err
+	}
+	bits := opts.Bits
+	if bits == 0 {
+		bits = simhash.DefaultFingerprintBits
+	}
+	if algorithm == simhash.Hyperplane && len(hyperplanes) < bits {
+		return nil, fmt.Errorf("%d-bit fingerprints need %d hyperplanes, got %d", bits, bits, len(hyperplanes))
+	}
+	if algorithm == simhash.Hyperplane {
+		if err := simhash.ValidateHyperplanes(hyperplanes, vectorizerConfig.Dimensions()); err != nil {
+			return nil, err
+		}
+	}
+
 	idx := index.New(filename, opts.ChunkSize, hyperplanes, indexDir)
+	idx.Vectorizer = vectorizerConfig
+	idx.Normalizer = opts.Normalizer
+	idx.Language = language
+	idx.Algorithm = algorithm
+	if err := idx.SetBits(bits); err != nil {
+		return nil, err
+	}
+	if opts.Seed != nil {
+		if err := idx.SetSeed(*opts.Seed); err != nil {
+			return nil, err
+		}
+	}
+	if opts.LSHBands != 0 {
+		if err := idx.SetLSHBands(opts.LSHBands); err != nil {
+			return nil, err
+		}
+	}
+	var minhasher *minhash.Hasher
+	if opts.MinHash.Enabled() {
+		if err := idx.SetMinHash(opts.MinHash); err != nil {
+			return nil, err
+		}
+		if minhasher, err = minhash.NewHasher(opts.MinHash); err != nil {
+			return nil, err
+		}
+	}
+	var winnower *winnow.Winnower
+	if opts.Winnow.Enabled() {
+		if err := idx.SetWinnow(opts.Winnow); err != nil {
+			return nil, err
+		}
+		if winnower, err = winnow.NewWinnower(opts.Winnow); err != nil {
+			return nil, err
+		}
+	}
+
+	// Vectorizers that learn from the corpus see every chunk before any
+	// chunk is hashed, so all hashes use the same weights
+	if cv, ok := vectorizer.(simhash.CorpusVectorizer); ok {
+		if err := splitChunks(file, opts, func(c Chunk) { cv.Observe(c.Content) }); err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if idx.VectorizerState, err = cv.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create chunk processor
-	processor := NewChunkProcessor(runtime.NumCPU(), hyperplanes)
+	processor := NewChunkProcessorWithAlgorithm(runtime.NumCPU(), algorithm, bits, hyperplanes, vectorizer)
+	processor.SetMinHasher(minhasher)
 
-	// Start result consumer
+	// Start result consumer. It keeps draining results after a failed add,
+	// so the workers never block, and reports the first failure.
+	var addErr error
 	resultsDone := make(chan struct{})
 	go func() {
 		defer close(resultsDone)
@@ -120,100 +262,173 @@ func ProcessFile(filename string, opts ChunkOptions, hyperplanes [][]float64, in
 			}
 
 			if opts.Verbose {
-				opts.Logger.Printf("Chunk %d: offset=%d, hash=%016x",
-					count, result.Pos, result.Hash)
+				opts.Logger.Printf("Chunk %d: offset=%d, hash=%s",
+					count, result.Pos, result.Fingerprint)
 			}
 
 			// Log every hash
 			if true { // Changed from if count%100 == 0
-				opts.Logger.Printf("Hash: %016x at position %d",
-					result.Hash, result.Pos)
+				opts.Logger.Printf("Hash: %s at position %d",
+					result.Fingerprint, result.Pos)
 			}
 
-			idx.Add(result.Hash, result.Pos)
+			if addErr == nil {
+				addErr = addResult(idx, result)
+			}
 			count++
 		}
 	}()
 
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, opts.ChunkSize)
-	offset := int64(0)
-	overlap := make([]byte, 0, opts.OverlapSize)
+	if err := splitChunks(file, opts, processor.ProcessChunk); err != nil {
+		processor.Close() // Close processor on error
+		return nil, err
+	}
 
-	// Process chunks
-	for {
-		bytesRead, err := reader.Read(buffer)
-		if err != nil && err != io.EOF {
-			processor.Close() // Close processor on error
+	// Close the processor BEFORE waiting for results
+	processor.Close()
+
+	// Wait for all results to be processed
+	<-resultsDone
+	if addErr != nil {
+		return nil, addErr
+	}
+
+	// A vectorizer that failed part way gave zero vectors for the rest of
+	// the chunks, so the index would be wrong
+	if err := simhash.VectorizerErr(vectorizer); err != nil {
+		return nil, err
+	}
+
+	// Passage fingerprints are taken over the whole file, so a copied
+	// passage is found wherever the chunk boundaries fall
+	if winnower != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
 			return nil, err
 		}
-		if bytesRead > 0 {
-			chunkData := buffer[:bytesRead]
-
-			// Handle overlap from previous chunk
-			if len(overlap) > 0 {
-				combinedChunk := make([]byte, len(overlap)+bytesRead)
-				copy(combinedChunk, overlap)
-				copy(combinedChunk[len(overlap):], chunkData)
-				chunkData = combinedChunk
+		var addErr error
+		err := winnower.Read(file, func(fp winnow.Fingerprint) {
+			if addErr == nil {
+				addErr = idx.AddPassageFingerprint(fp)
 			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if addErr != nil {
+			return nil, addErr
+		}
+	}
 
-			// Fix UTF-8 encoding issues at chunk boundaries
-			if !isValidUTF8(chunkData) {
-				// Try to find a valid UTF-8 boundary
-				validLen := 0
-				for i := 0; i < len(chunkData); i++ {
-					if isValidUTF8(chunkData[:i+1]) {
-						validLen = i + 1
-					}
-				}
-				if validLen > 0 {
-					chunkData = chunkData[:validLen]
-				}
-			}
+	return idx, nil
+}
 
-			// Find a good boundary to split if needed
-			chunkSize := len(chunkData)
-			splitPos := chunkSize
-			if opts.SplitOnBoundary && chunkSize > opts.ChunkSize/2 {
-				splitPos = findBoundary(chunkData, opts.ChunkSize, opts.BoundaryChars)
-			}
+// addResult stores the fingerprint of a processed chunk, and its MinHash
+// signature when it has one
+func addResult(idx *index.Index, result ProcessResult) error {
+	if err := idx.AddChunk(result.Fingerprint, result.Pos, result.Length); err != nil {
+		return err
+	}
+	if result.MinHash != nil {
+		return idx.AddMinHash(result.Pos, result.MinHash)
+	}
+	return nil
+}
 
-			// Create the chunk
-			chunk := Chunk{
-				Content:     string(chunkData[:splitPos]),
-				StartOffset: offset,
-				Length:      splitPos,
-				IsComplete:  err == io.EOF,
-				Metadata: map[string]string{
-					"timestamp": time.Now().Format(time.RFC3339),
-				},
-			}
+// newVectorizer builds the vectorizer the options select, with its
+// language and normalization, and returns it with its full configuration
+// and language
+func newVectorizer(opts ChunkOptions) (simhash.Vectorizer, simhash.VectorizerConfig, simhash.Language, error) {
+	cfg := opts.Vectorizer
+	if cfg.Name == "" {
+		cfg = simhash.DefaultVectorizerConfig()
+	}
+	cfg, err := cfg.WithDefaults()
+	if err != nil {
+		return nil, cfg, "", err
+	}
+	language, err := simhash.ParseLanguage(string(opts.Language))
+	if err != nil {
+		return nil, cfg, "", err
+	}
+	vectorizer, err := cfg.New()
+	if err != nil {
+		return nil, cfg, "", err
+	}
+	if err := language.Apply(vectorizer); err != nil {
+		simhash.CloseVectorizer(vectorizer)
+		return nil, cfg, "", err
+	}
+	return opts.Normalizer.Wrap(vectorizer), cfg, language, nil
+}
 
-			processor.ProcessChunk(chunk)
+// splitChunks reads r and hands every chunk to emit. StartOffset and Length
+// always describe the chunk's exact byte range in the source, so positions
+// stored in the index can be mapped back to the text they were computed from.
+func splitChunks(r io.Reader, opts ChunkOptions, emit func(Chunk)) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 4096
+	}
 
-			// Prepare overlap for next chunk
-			if splitPos < chunkSize && opts.OverlapSize > 0 {
-				overlapStart := max(0, splitPos-opts.OverlapSize)
-				overlap = make([]byte, splitPos-overlapStart)
-				copy(overlap, chunkData[overlapStart:splitPos])
-			} else {
-				overlap = nil
+	reader := bufio.NewReader(r)
+	buffer := make([]byte, chunkSize)
+	filled := 0
+	offset := int64(0)
+	eof := false
+
+	for {
+		// Top the buffer up to a full chunk
+		if !eof && filled < chunkSize {
+			n, err := io.ReadFull(reader, buffer[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
 			}
+		}
+		if filled == 0 {
+			return nil
+		}
 
-			offset += int64(splitPos)
+		chunkData := buffer[:filled]
+		last := eof
+
+		// Fix UTF-8 encoding issues at chunk boundaries
+		splitPos := len(chunkData)
+		if !last {
+			splitPos = trimPartialRune(chunkData)
 		}
 
-		if err == io.EOF {
-			break
+		// Find a good boundary to split if needed
+		if opts.SplitOnBoundary && !last && splitPos > chunkSize/2 {
+			splitPos = findBoundary(chunkData, splitPos, opts.BoundaryChars)
 		}
-	}
 
-	// Close the processor BEFORE waiting for results
-	processor.Close()
+		emit(Chunk{
+			Content:     string(chunkData[:splitPos]),
+			StartOffset: offset,
+			Length:      splitPos,
+			IsComplete:  last && splitPos == filled,
+			Metadata: map[string]string{
+				"timestamp": time.Now().Format(time.RFC3339),
+			},
+		})
+
+		if last && splitPos == filled {
+			return nil
+		}
 
-	// Wait for all results to be processed
-	<-resultsDone
+		// Step forward, keeping the overlap with the previous chunk
+		step := splitPos
+		if opts.OverlapSize > 0 && opts.OverlapSize < splitPos {
+			step = splitPos - opts.OverlapSize
+			for step < splitPos && !utf8.RuneStart(chunkData[step]) {
+				step++
+			}
+		}
 
-	return idx, nil
+		filled = copy(buffer, chunkData[step:])
+		offset += int64(step)
+	}
 }
@@ -2,11 +2,19 @@ package chunk
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
 
+	"jamtext/internal/index"
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
 // TestNewChunkProcessor tests the creation of chunk processors with different worker counts
@@ -211,3 +219,246 @@ func TestProcessorWithInvalidContent(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitChunksOffsets(t *testing.T) {
+	text := strings.Repeat("Sentence number one. Another sentence here! ", 50) + "héllo wörld"
+
+	tests := []struct {
+		name string
+		opts ChunkOptions
+	}{
+		{"no overlap", ChunkOptions{ChunkSize: 256}},
+		{"with overlap", ChunkOptions{ChunkSize: 256, OverlapSize: 32}},
+		{"split on boundary", ChunkOptions{ChunkSize: 256, OverlapSize: 32, SplitOnBoundary: true, BoundaryChars: ".!?"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []Chunk
+			err := splitChunks(strings.NewReader(text), tt.opts, func(c Chunk) {
+				chunks = append(chunks, c)
+			})
+			if err != nil {
+				t.Fatalf("splitChunks failed: %v", err)
+			}
+
+			end := int64(0)
+			for _, c := range chunks {
+				if c.Content != text[c.StartOffset:c.StartOffset+int64(c.Length)] {
+					t.Fatalf("chunk at %d does not match the source bytes", c.StartOffset)
+				}
+				if c.StartOffset > end {
+					t.Fatalf("gap before chunk at %d", c.StartOffset)
+				}
+				end = c.StartOffset + int64(c.Length)
+			}
+			if end != int64(len(text)) {
+				t.Errorf("chunks end at %d, want %d", end, len(text))
+			}
+			if !chunks[len(chunks)-1].IsComplete {
+				t.Error("last chunk should be complete")
+			}
+		})
+	}
+}
+
+func TestProcessFileLearnsCorpusStatistics(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	text := strings.Repeat("the same boilerplate header. ", 10) + "distinctive words appear only once here"
+	if err := os.WriteFile(inputPath, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.ChunkSize = 64
+	opts.OverlapSize = 0
+	opts.SplitOnBoundary = false
+	opts.Logger = log.New(io.Discard, "", 0)
+	opts.Vectorizer = simhash.VectorizerConfig{Name: "tfidf"}
+
+	hyperplanes := simhash.GenerateHyperplanes(128, 64)
+	idx, err := ProcessFile(inputPath, opts, hyperplanes, tmpDir)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+	if idx.VectorizerState == nil {
+		t.Fatal("expected learned vectorizer state")
+	}
+
+	// Queries rebuilt from the index must hash chunks exactly as indexing did
+	vectorizer, err := idx.NewVectorizer()
+	if err != nil {
+		t.Fatalf("NewVectorizer failed: %v", err)
+	}
+	first := text[:64]
+	hash := simhash.CalculateWithVectorizer(first, hyperplanes, vectorizer)
+	ref, err := idx.ChunkAt(inputPath, 0)
+	if err != nil {
+		t.Fatalf("ChunkAt failed: %v", err)
+	}
+	if ref.Hash != hash.Fingerprint() {
+		t.Errorf("chunk hash %s, query hash %x", ref.Hash, hash)
+	}
+}
+
+func TestSampleVectors(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	var text strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&text, "paragraph %d repeats a few words of its own %d. ", i, i*i)
+	}
+	if err := os.WriteFile(inputPath, []byte(text.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.ChunkSize = 64
+	opts.OverlapSize = 0
+	opts.SplitOnBoundary = false
+	opts.Logger = log.New(io.Discard, "", 0)
+	opts.Vectorizer = simhash.VectorizerConfig{Name: "tfidf"}
+
+	sample, err := SampleVectors(inputPath, opts, 10)
+	if err != nil {
+		t.Fatalf("SampleVectors failed: %v", err)
+	}
+	if len(sample) != 10 || len(sample[0]) != 128 {
+		t.Fatalf("got %d vectors of %d dimensions, want 10 of 128", len(sample), len(sample[0]))
+	}
+	again, err := SampleVectors(inputPath, opts, 10)
+	if err != nil || !reflect.DeepEqual(again, sample) {
+		t.Error("the same seed sampled other chunks")
+	}
+
+	// A larger sample than the file has chunks takes them all
+	all, err := SampleVectors(inputPath, opts, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (text.Len() + 63) / 64; len(all) != want {
+		t.Errorf("got %d vectors, want one per chunk (%d)", len(all), want)
+	}
+
+	if _, err := SampleVectors(inputPath, opts, 0); err == nil {
+		t.Error("expected an error for an empty sample")
+	}
+}
+
+func TestProcessFileStoresMinHashes(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	text := strings.Repeat("a sentence that repeats itself. ", 8)
+	if err := os.WriteFile(inputPath, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.ChunkSize = 64
+	opts.OverlapSize = 0
+	opts.SplitOnBoundary = false
+	opts.Logger = log.New(io.Discard, "", 0)
+	opts.MinHash = minhash.DefaultConfig()
+
+	idx, err := ProcessFile(inputPath, opts, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	hasher, err := idx.NewMinHasher()
+	if err != nil {
+		t.Fatalf("NewMinHasher failed: %v", err)
+	}
+	for _, pos := range []int64{0, 64} {
+		sig, ok := idx.MinHashAt(pos)
+		if !ok {
+			t.Fatalf("no signature stored for the chunk at %d", pos)
+		}
+		if want := hasher.Signature(text[pos : pos+64]); !reflect.DeepEqual(sig, want) {
+			t.Errorf("signature at %d does not match the chunk text", pos)
+		}
+	}
+}
+
+func TestAddResultReportsErrors(t *testing.T) {
+	idx := index.New("input.txt", 64, simhash.GenerateHyperplanes(128, 64), t.TempDir())
+	idx.Storage = index.NewMemoryStorage()
+
+	result := ProcessResult{Fingerprint: simhash.NewFingerprint(64), Length: 64}
+	if err := addResult(idx, result); err != nil {
+		t.Fatalf("addResult failed: %v", err)
+	}
+
+	// The index was not built to store MinHash signatures
+	result.Pos = 64
+	result.MinHash = minhash.Signature{1, 2, 3}
+	if err := addResult(idx, result); err == nil {
+		t.Error("expected an error for a signature the index cannot store")
+	}
+
+	result.Fingerprint = simhash.NewFingerprint(128)
+	result.MinHash = nil
+	if err := addResult(idx, result); err == nil {
+		t.Error("expected an error for a fingerprint of the wrong width")
+	}
+}
+
+func TestProcessFileStoresPassages(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	copied := "a paragraph that someone copied straddles the boundary between two chunks"
+	text := strings.Repeat("x", 40) + " " + copied + " " + strings.Repeat("y", 40)
+	if err := os.WriteFile(inputPath, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.ChunkSize = 64
+	opts.OverlapSize = 0
+	opts.SplitOnBoundary = false
+	opts.Logger = log.New(io.Discard, "", 0)
+	opts.Winnow = winnow.Config{K: 10, Window: 5}
+
+	idx, err := ProcessFile(inputPath, opts, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	winnower, err := idx.NewWinnower()
+	if err != nil {
+		t.Fatalf("NewWinnower failed: %v", err)
+	}
+	passages, err := idx.Passages(winnower.Fingerprints(copied))
+	if err != nil {
+		t.Fatalf("Passages failed: %v", err)
+	}
+	if len(passages) != 1 {
+		t.Fatalf("got %d passages, want 1: %+v", len(passages), passages)
+	}
+	p, err := winnower.Extend(passages[0], strings.NewReader(copied), strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	start := int64(strings.Index(text, copied))
+	if p.SourceStart != start || p.SourceEnd != start+int64(len(copied)) {
+		t.Errorf("passage at %d-%d, want the copy at %d-%d", p.SourceStart, p.SourceEnd, start, start+int64(len(copied)))
+	}
+}
+
+func TestProcessFileRejectsMismatchedHyperplanes(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte("some text to index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.Logger = log.New(io.Discard, "", 0)
+	opts.Vectorizer = simhash.VectorizerConfig{Name: "ngram", Params: map[string]string{"dims": "384"}}
+
+	_, err := ProcessFile(inputPath, opts, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err == nil || !strings.Contains(err.Error(), "384") {
+		t.Errorf("ProcessFile with 128-dimensional hyperplanes for 384-dimensional vectors: %v", err)
+	}
+}
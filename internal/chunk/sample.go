@@ -0,0 +1,70 @@
+package chunk
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+
+	"jamtext/internal/simhash"
+)
+
+// SampleVectors returns the vectors of up to count chunks of a file, chunked
+// and vectorized as ProcessFile would with the same options. The chunks are
+// chosen uniformly by reservoir sampling seeded with opts.Seed, and
+// vectorizers that learn from the corpus observe every chunk first. The
+// sample is what hyperplanes are learned from.
+func SampleVectors(filename string, opts ChunkOptions, count int) ([][]float64, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("sample size must be positive, got %d", count)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if opts.Vectorizer, err = opts.Vectorizer.ForFile(filename); err != nil {
+		return nil, err
+	}
+	vectorizer, _, _, err := newVectorizer(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer simhash.CloseVectorizer(vectorizer)
+
+	seed := simhash.DefaultSeed
+	if opts.Seed != nil {
+		seed = *opts.Seed
+	}
+	rng := rand.New(rand.NewSource(seed))
+	cv, learns := vectorizer.(simhash.CorpusVectorizer)
+
+	var sample []string
+	seen := 0
+	err = splitChunks(file, opts, func(c Chunk) {
+		if learns {
+			cv.Observe(c.Content)
+		}
+		seen++
+		if len(sample) < count {
+			sample = append(sample, c.Content)
+		} else if i := rng.Intn(seen); i < count {
+			sample[i] = c.Content
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("%s has no chunks", filename)
+	}
+
+	vectors := make([][]float64, len(sample))
+	for i, text := range sample {
+		vectors[i] = vectorizer.TextToVector(text)
+	}
+	if err := simhash.VectorizerErr(vectorizer); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
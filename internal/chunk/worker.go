@@ -59,9 +59,9 @@ func (p *WorkerPool) Submit(task func()) {
 	}
 }
 
-// Close stops the worker pool
+// Close stops the worker pool once every submitted task has run
 func (p *WorkerPool) Close() {
-	p.cancelFunc()
 	close(p.tasks)
 	p.wg.Wait()
+	p.cancelFunc()
 }
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"jamtext/internal/simhash"
+)
+
+// calibrationPair is one line of a calibration sample: two texts and the
+// similarity they should be reported with. The similarity is a pointer so
+// a line without one, such as a pair labelled for evaluate, is rejected
+// rather than read as 0.
+type calibrationPair struct {
+	A          string   `json:"a"`
+	B          string   `json:"b"`
+	Similarity *float64 `json:"similarity"`
+}
+
+// readJSONLines calls fn with every non-empty line of a JSON-lines file
+func readJSONLines(path string, fn func(line int, data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(line, scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// fitCalibration fingerprints every pair in a JSON-lines file with detector
+// and fits a calibration curve to their labels
+func fitCalibration(path string, detector *simhash.DocumentSimilarity, model simhash.Model) (simhash.Calibration, error) {
+	var samples []simhash.CalibrationSample
+	err := readJSONLines(path, func(_ int, data []byte) error {
+		var pair calibrationPair
+		if err := json.Unmarshal(data, &pair); err != nil {
+			return err
+		}
+		if pair.Similarity == nil {
+			return fmt.Errorf(`pair has no "similarity"`)
+		}
+		// Similarities are cosines, as the angle formula reports them
+		if s := *pair.Similarity; !(s >= -1 && s <= 1) {
+			return fmt.Errorf("similarity %g is not between -1 and 1", s)
+		}
+		a, b := detector.Fingerprint(pair.A), detector.Fingerprint(pair.B)
+		samples = append(samples, simhash.CalibrationSample{
+			Distance:   a.HammingDistance(b),
+			Bits:       a.Bits(),
+			Similarity: *pair.Similarity,
+		})
+		return nil
+	})
+	if err != nil {
+		return simhash.Calibration{}, err
+	}
+
+	calibration, err := simhash.FitCalibration(samples, simhash.DefaultConfidence)
+	if err != nil {
+		return simhash.Calibration{}, err
+	}
+	calibration.Model = model.ID()
+	return calibration, nil
+}
+
+// saveCalibration writes a calibration as JSON
+func saveCalibration(path string, c simhash.Calibration) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// loadCalibration reads the calibration at path for fingerprints of model.
+// An empty path selects the angle formula.
+func loadCalibration(path string, model simhash.Model) (simhash.Calibration, error) {
+	if path == "" {
+		return simhash.AngleCalibration(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return simhash.Calibration{}, fmt.Errorf("failed to read calibration: %w", err)
+	}
+	var c simhash.Calibration
+	if err := json.Unmarshal(data, &c); err != nil {
+		return simhash.Calibration{}, fmt.Errorf("invalid calibration %s: %w", path, err)
+	}
+	if c.Model != "" && c.Model != model.ID() {
+		return simhash.Calibration{}, fmt.Errorf("calibration was fitted on model %s, not %s", c.Model, model.ID())
+	}
+	return c, nil
+}
@@ -13,6 +13,7 @@ import (
 
 	"jamtext/internal/chunk"
 	"jamtext/internal/index"
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
 
 	"golang.org/x/text/cases"
@@ -39,19 +40,50 @@ func Run(args []string) error {
 	boundaryChars := fs.String("boundary-chars", ".!?\n", "Text boundaries to split on")
 	maxChunkSize := fs.Int("max-size", 6144, "Maximum chunk size in bytes")
 	preserveNewlines := fs.Bool("preserve-nl", true, "Preserve newlines in chunks")
-	indexDir := fs.String("index-dir", "", "Directory to store index shards")
+	indexDir := fs.String("index-dir", "", "Directory or s3://bucket/prefix to store index shards")
+	cacheDir := fs.String("cache-dir", "", "Local cache directory for shards in remote storage")
+	sourceRoot := fs.String("source-root", "", "Directory holding the indexed source file, if it moved")
 	threshold := fs.Int("threshold", 3, "Threshold for fuzzy lookup")
+	format := fs.String("format", "table", "Output format for stats and evaluate (table|json)")
+	calibrationPath := fs.String("calibration", "", "Calibration fitted by the calibrate command (compare, fuzzy)")
+	at := fs.Int64("at", -1, "Byte offset in the source file to search from (similar-to)")
+	idsPath := fs.String("ids", "", "Record IDs, one per line, for raw float32 vectors (index-vectors, learn-planes)")
 
 	// Content moderation flags
 	wordlistPath := fs.String("wordlist", "", "Path to wordlist file")
 	modLevel := fs.String("level", "strict", "Moderation level (strict|lenient)")
 	contextSize := fs.Int("context", 50, "Context size for matches")
 
+	// Fingerprint settings
+	vectorizerSpec := fs.String("vectorizer", "", "Vectorizer and parameters, e.g. ngram:n=3 ("+strings.Join(simhash.VectorizerNames(), "|")+")")
+	normalize := fs.String("normalize", "", "Text normalization steps, e.g. nfkc,fold,diacritics,punct,space or none (default "+simhash.DefaultNormalizer+", "+simhash.CodeNormalizer+" with the code vectorizer, "+simhash.ExecNormalizer+" with exec or "+simhash.VectorNormalizer+" with vector)")
+	lang := fs.String("lang", "", "Language for stopwords and stemming ("+strings.Join(simhash.LanguageNames(), "|")+", default none)")
+	algorithm := fs.String("algorithm", "", "Fingerprint algorithm (hyperplane|charikar)")
+	bits := fs.Int("bits", 0, "Fingerprint width in bits (64|128|256, default 64)")
+	seed := fs.Int64("seed", simhash.DefaultSeed, "Seed of the hyperplanes and LSH permutations")
+	indexPath := fs.String("index", "", "Index whose fingerprint settings to use (hash, compare), or to search (passages)")
+	planesPath := fs.String("planes", "", "Hyperplanes learned by learn-planes, with the settings they were learned with (index, hash, compare, evaluate, ...)")
+	planeMethod := fs.String("method", "", "How learn-planes derives hyperplanes from the sample (pca|itq, default pca)")
+
+	// MinHash settings
+	minhashes := fs.Int("minhash", 0, "MinHash signature length; index stores signatures when set (default 128 for compare)")
+	shingle := fs.Int("shingle", 3, "Words per MinHash shingle")
+
+	// Winnowing settings
+	winnowK := fs.Int("winnow", 0, "Characters per winnowing k-gram; index stores passage fingerprints when set (e.g. 30)")
+	window := fs.Int("window", 20, "K-grams per winnowing window")
+
 	// Add LSH-specific flags
-	lshBands := fs.Int("lsh-bands", 8, "Number of LSH bands")
-	bandSize := fs.Int("band-size", 8, "Size of each LSH band")
+	lshBands := fs.Int("lsh-bands", 0, "Number of LSH bands (default one per 16 fingerprint bits)")
+	bandSize := fs.Int("band-size", 0, "Bits per LSH band; bands times band size must equal -bits")
+	recall := fs.Float64("recall", 0.95, "Target recall at -threshold (tune-lsh)")
+	sample := fs.Int("sample", 0, "Hashes of the index to measure LSH layouts on (tune-lsh, default 200), or chunks to learn hyperplanes from (learn-planes, default 5000)")
 
 	fs.Parse(args[1:])
+	seedSet := false
+	fs.Visit(func(f *flag.Flag) {
+		seedSet = seedSet || f.Name == "seed"
+	})
 
 	// Setup logger
 	var logger *log.Logger
@@ -68,6 +100,32 @@ func Run(args []string) error {
 		logger = log.New(io.Discard, "", 0) // Discard logs unless verbose or log file specified
 	}
 
+	loadOpts := index.LoadOptions{
+		CacheDir:   *cacheDir,
+		SourceRoot: *sourceRoot,
+		IndexDir:   *indexDir,
+	}
+	fingerprint := fingerprintFlags{
+		vectorizer: *vectorizerSpec,
+		normalize:  *normalize,
+		language:   *lang,
+		algorithm:  *algorithm,
+		bits:       *bits,
+		seed:       *seed,
+		seedSet:    seedSet,
+		lshBands:   *lshBands,
+		bandSize:   *bandSize,
+		planes:     *planesPath,
+	}
+	minhashSettings := minhashFlags{
+		hashes:  *minhashes,
+		shingle: *shingle,
+	}
+	winnowSettings := winnowFlags{
+		k:      *winnowK,
+		window: *window,
+	}
+
 	switch *cmd {
 	case "index":
 		if *input == "" || *output == "" {
@@ -85,14 +143,21 @@ func Run(args []string) error {
 			*size = 4096
 		}
 
-		// Generate hyperplanes first
-		hyperplanes := simhash.GenerateHyperplanes(simhash.VectorDimensions, simhash.NumHyperplanes)
-
-		// Create index with LSH configuration
-		idx := index.New(*input, *size, hyperplanes, *indexDir)
+		model, err := fingerprint.model(simhash.DefaultVectorizer)
+		if err != nil {
+			return err
+		}
+		minhashConfig, err := minhashSettings.indexConfig()
+		if err != nil {
+			return err
+		}
+		winnowConfig, err := winnowSettings.indexConfig()
+		if err != nil {
+			return err
+		}
 
-		// Configure LSH table with specified parameters
-		idx.LSHTable = simhash.NewPermutationTable(*lshBands**bandSize, *lshBands)
+		// Generate hyperplanes first, one per fingerprint bit
+		hyperplanes := model.Hyperplanes()
 
 		opts := chunk.ChunkOptions{
 			ChunkSize:        *size,
@@ -103,6 +168,15 @@ func Run(args []string) error {
 			PreserveNewlines: *preserveNewlines,
 			Logger:           logger,
 			Verbose:          *verbose,
+			Vectorizer:       model.Vectorizer,
+			Normalizer:       model.Normalizer,
+			Language:         model.Language,
+			Algorithm:        model.Algorithm,
+			Bits:             model.Bits,
+			Seed:             &model.Seed,
+			LSHBands:         model.LSHBands,
+			MinHash:          minhashConfig,
+			Winnow:           winnowConfig,
 		}
 
 		start := time.Now()
@@ -117,12 +191,56 @@ func Run(args []string) error {
 			return err
 		}
 
-		stats := idx.Stats()
+		stats, err := idx.Stats()
+		if err != nil {
+			return err
+		}
 		fmt.Printf("Indexed %d unique hashes with %d total positions in %v\n",
-			stats["unique_hashes"],
-			stats["total_positions"],
+			stats.UniqueHashes,
+			stats.TotalPositions,
+			time.Since(start))
+		fmt.Printf("Created %d shards\n", stats.ShardCount)
+		if n := idx.PassageFingerprints(); n > 0 {
+			fmt.Printf("Stored %d passage fingerprints\n", n)
+		}
+		fmt.Printf("Model: %s\n", stats.ModelID)
+
+		return nil
+
+	case "index-vectors":
+		if *input == "" || *output == "" {
+			return fmt.Errorf("input and output file paths must be specified")
+		}
+
+		// Check if the input file exists
+		if _, err := os.Stat(*input); os.IsNotExist(err) {
+			return fmt.Errorf("input file '%s' does not exist", *input)
+		}
+
+		model, err := fingerprint.model("vector")
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		idx, err := indexVectors(*input, *idsPath, model, *indexDir)
+		if err != nil {
+			return err
+		}
+		if err := index.Save(idx, *output); err != nil {
+			return err
+		}
+
+		stats, err := idx.Stats()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Indexed %d vectors with %d unique hashes in %v\n",
+			stats.TotalRecords,
+			stats.UniqueHashes,
 			time.Since(start))
-		fmt.Printf("Created %d shards\n", stats["shards"])
+		fmt.Printf("Created %d shards\n", stats.ShardCount)
+		fmt.Printf("Model: %s\n", stats.ModelID)
 
 		return nil
 
@@ -136,27 +254,34 @@ func Run(args []string) error {
 			return fmt.Errorf("input file '%s' does not exist", *input)
 		}
 
-		idx, err := index.Load(*input)
+		idx, err := index.LoadWithOptions(*input, loadOpts)
 		if err != nil {
 			return err
 		}
+		if err := fingerprint.check(idx); err != nil {
+			return err
+		}
 
-		var hash simhash.SimHash
-		if _, err := fmt.Sscanf(*hashStr, "%x", &hash); err != nil {
-			return fmt.Errorf("invalid hash: %w", err)
+		hash, err := parseHash(idx, *hashStr)
+		if err != nil {
+			return err
 		}
 
-		matches, err := idx.Lookup(hash)
+		matches, err := idx.LookupFingerprint(hash)
 		if err != nil {
 			return fmt.Errorf("lookup failed: %w", err)
 		}
 		if len(matches) == 0 {
-			fmt.Printf("No matches found for hash %x\n", hash)
+			fmt.Printf("No matches found for hash %s\n", hash)
 			return nil
 		}
 
-		fmt.Printf("Found matches for SimHash %x:\n\n", hash)
+		fmt.Printf("Found matches for SimHash %s:\n\n", hash)
 		for _, pos := range matches {
+			if id, ok := idx.RecordID(pos); ok {
+				fmt.Printf("Record: %s\n", id)
+				continue
+			}
 			if err := lookupAndShowPreview(idx.SourceFile, hash, pos, idx.ChunkSize); err != nil {
 				fmt.Printf("Warning: %v\n", err)
 			}
@@ -175,22 +300,21 @@ func Run(args []string) error {
 			return fmt.Errorf("input file '%s' does not exist", *input)
 		}
 
-		idx, err := index.Load(*input)
+		idx, err := index.LoadWithOptions(*input, loadOpts)
 		if err != nil {
 			return err
 		}
-
-		stats := idx.Stats()
-		fmt.Println("Index Statistics:")
-		fmt.Printf("Source file: %s\n", stats["source_file"])
-		fmt.Printf("Chunk size: %d bytes\n", stats["chunk_size"])
-		fmt.Printf("Created: %v\n", stats["created"])
-		fmt.Printf("Shards: %d\n", stats["shards"])
-		fmt.Printf("Unique hashes: %d\n", stats["unique_hashes"])
-		fmt.Printf("Total positions: %d\n", stats["total_positions"])
+		if err := fingerprint.check(idx); err != nil {
+			return err
+		}
 
 		defer idx.Close()
-		return nil
+
+		stats, err := idx.Stats()
+		if err != nil {
+			return err
+		}
+		return printStats(os.Stdout, stats, *format)
 
 	case "fuzzy":
 		if *input == "" || *hashStr == "" {
@@ -202,35 +326,104 @@ func Run(args []string) error {
 			return fmt.Errorf("input file '%s' does not exist", *input)
 		}
 
-		idx, err := index.Load(*input)
+		idx, err := index.LoadWithOptions(*input, loadOpts)
 		if err != nil {
 			return err
 		}
+		if err := fingerprint.check(idx); err != nil {
+			return err
+		}
 
-		var hash simhash.SimHash
-		if _, err := fmt.Sscanf(*hashStr, "%x", &hash); err != nil {
-			return fmt.Errorf("invalid hash: %w", err)
+		hash, err := parseHash(idx, *hashStr)
+		if err != nil {
+			return err
+		}
+		calibration, err := loadCalibration(*calibrationPath, idx.Model())
+		if err != nil {
+			return err
 		}
 
 		// Use LSH-enhanced fuzzy lookup
-		matches, found := idx.FuzzyLookup(hash, *threshold)
+		matches, found := idx.FuzzyLookupFingerprint(hash, *threshold)
 		if !found {
 			fmt.Println("No similar content found")
 			return nil
 		}
 
 		fmt.Printf("Found %d similar chunks:\n", len(matches))
+		for match, positions := range matches {
+			fmt.Printf("\nSimHash: %s\n", match)
+			fmt.Printf("%s: %s\n", calibration.Label(), calibration.EstimateFingerprints(hash, match))
+			for _, pos := range positions {
+				if id, ok := idx.RecordID(pos); ok {
+					fmt.Printf("Record: %s\n", id)
+					continue
+				}
+				showMatchContext(idx.SourceFile, pos, idx.ChunkSize, "")
+			}
+		}
+
+		return nil
+
+	case "similar-to":
+		if *input == "" || *at < 0 {
+			return fmt.Errorf("input and offset must be specified")
+		}
+
+		// Check if the input file exists
+		if _, err := os.Stat(*input); os.IsNotExist(err) {
+			return fmt.Errorf("input file '%s' does not exist", *input)
+		}
+
+		idx, err := index.LoadWithOptions(*input, loadOpts)
+		if err != nil {
+			return err
+		}
+		if err := fingerprint.check(idx); err != nil {
+			return err
+		}
+		defer idx.Close()
+
+		ref, err := idx.ChunkAt(idx.SourceFile, *at)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Chunk covering offset %d:\n", *at)
+		if err := lookupAndShowPreview(idx.SourceFile, ref.Hash, ref.Start, ref.Length); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		matches, _ := idx.FuzzyLookupFingerprint(ref.Hash, *threshold)
+		found := 0
 		for hash, positions := range matches {
-			fmt.Printf("\nSimHash: %x\n", hash)
 			for _, pos := range positions {
-				showMatchContext(*input, pos, idx.ChunkSize, "")
+				if pos == ref.Start {
+					continue // the passage itself
+				}
+				if found == 0 {
+					fmt.Printf("\nSimilar chunks:\n\n")
+				}
+				found++
+				if err := lookupAndShowPreview(idx.SourceFile, hash, pos, idx.ChunkSize); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+				if sig, ok := idx.MinHashAt(ref.Start); ok {
+					if other, ok := idx.MinHashAt(pos); ok {
+						fmt.Printf("Estimated Jaccard: %.2f%%\n", minhash.Jaccard(sig, other)*100)
+					}
+				}
 			}
 		}
+		if found == 0 {
+			fmt.Println("\nNo similar content found")
+		}
 
 		return nil
-	case "hash":
-		if *input == "" {
-			return fmt.Errorf("input file must be specified")
+
+	case "passages":
+		if *input == "" || *indexPath == "" {
+			return fmt.Errorf("input file and index must be specified")
 		}
 
 		// Check if the input file exists
@@ -238,22 +431,97 @@ func Run(args []string) error {
 			return fmt.Errorf("input file '%s' does not exist", *input)
 		}
 
-		// Generate hyperplanes
-		hyperplanes := simhash.GenerateHyperplanes(simhash.VectorDimensions, simhash.NumHyperplanes)
+		idx, err := index.LoadWithOptions(*indexPath, loadOpts)
+		if err != nil {
+			return err
+		}
+		defer idx.Close()
+
+		return printPassages(os.Stdout, idx, *input)
+
+	case "backup":
+		if *input == "" || *output == "" {
+			return fmt.Errorf("index and archive paths must be specified")
+		}
 
-		if *verbose {
-			logger.Printf("Generated %d hyperplanes\n", len(hyperplanes))
+		// Check if the input file exists
+		if _, err := os.Stat(*input); os.IsNotExist(err) {
+			return fmt.Errorf("input file '%s' does not exist", *input)
 		}
 
-		// Read the file content
-		content, err := os.ReadFile(*input)
+		archive, err := os.Create(*output)
 		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
+			return fmt.Errorf("failed to create archive: %w", err)
 		}
+		defer archive.Close()
 
-		// Calculate hash
-		hash := simhash.Calculate(string(content), hyperplanes)
-		fmt.Printf("%x\n", hash) // Only output the hash
+		manifest, err := index.Backup(*input, archive)
+		if err != nil {
+			os.Remove(*output)
+			return fmt.Errorf("backup failed: %w", err)
+		}
+
+		fmt.Printf("Backed up %s (%d files) to %s\n", *input, len(manifest.Files), *output)
+		return nil
+
+	case "restore":
+		if *input == "" || *output == "" {
+			return fmt.Errorf("archive path and target directory must be specified")
+		}
+
+		archive, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer archive.Close()
+
+		indexFile, manifest, err := index.Restore(archive, *output)
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+
+		fmt.Printf("Restored %d files from %s\n", len(manifest.Files), *input)
+		fmt.Printf("Index file: %s\n", indexFile)
+		return nil
+
+	case "hash":
+		if *input == "" {
+			return fmt.Errorf("input file must be specified")
+		}
+
+		// Check if the input file exists; "-" reads standard input
+		if *input != "-" {
+			if _, err := os.Stat(*input); os.IsNotExist(err) {
+				return fmt.Errorf("input file '%s' does not exist", *input)
+			}
+		}
+
+		// Hash the content as it is read, so any size fits in memory
+		in := os.Stdin
+		if *input != "-" {
+			var err error
+			if in, err = os.Open(*input); err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			defer in.Close()
+		}
+		// The start of the input fixes settings such as the language of code,
+		// as it does for an index of the same file
+		r := bufio.NewReaderSize(in, simhash.SourceHeadSize)
+		head, _ := r.Peek(simhash.SourceHeadSize)
+		fingerprint.source, fingerprint.sourceHead = *input, string(head)
+
+		detector, model, err := fingerprint.detector(*indexPath, simhash.DefaultVectorizer, loadOpts)
+		if err != nil {
+			return err
+		}
+		defer detector.Close()
+
+		hash, err := detector.FingerprintReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		fmt.Printf("%s\n", model.FormatHash(hash)) // Only output model:hash
 		return nil
 
 	case "compare":
@@ -271,27 +539,40 @@ func Run(args []string) error {
 			return fmt.Errorf("second input file '%s' does not exist", *secondInput)
 		}
 
-		// secondInput := fs.String("i2", "", "Second input file path")
-		if *secondInput == "" {
-			return fmt.Errorf("second input file must be specified")
+		// Comparisons default to 3-gram vectors, which suit whole documents
+		detector, model, err := fingerprint.detector(*indexPath, "ngram", loadOpts)
+		if err != nil {
+			return err
 		}
-
-		// Read first file
-		content1, err := os.ReadFile(*input)
+		defer detector.Close()
+		calibration, err := loadCalibration(*calibrationPath, model)
 		if err != nil {
-			return fmt.Errorf("error reading %s: %w", *input, err)
+			return err
+		}
+		detector.SetCalibration(calibration)
+		minhashConfig, err := minhashSettings.resolve(*indexPath, loadOpts)
+		if err != nil {
+			return err
+		}
+		hasher, err := minhash.NewHasher(minhashConfig)
+		if err != nil {
+			return err
 		}
 
-		// Read second file
-		content2, err := os.ReadFile(*secondInput)
+		// Both files are hashed as they are read, for the fingerprint and
+		// the MinHash signature at once, so neither is held in memory
+		fp1, sig1, err := hashFile(detector, hasher, *input)
 		if err != nil {
-			return fmt.Errorf("error reading %s: %w", *secondInput, err)
+			return err
+		}
+		fp2, sig2, err := hashFile(detector, hasher, *secondInput)
+		if err != nil {
+			return err
 		}
 
-		detector := simhash.NewDocumentSimilarity()
-		// in this case the value ignored is the similarity number which is basically the level of similarity.
-		// in this case the value ignored is the similarity number which is basically the level of similarity.
-		_, details := detector.CompareDocuments(string(content1), string(content2))
+		_, details := detector.CompareFingerprints(fp1, fp2)
+		details += jaccardReport(minhashConfig, sig1, sig2) + "\n"
+		details += fmt.Sprintf("Model: %s\n", model.ID())
 
 		fmt.Println(details)
 
@@ -304,6 +585,143 @@ func Run(args []string) error {
 			fmt.Printf("Report saved to %s\n", *output)
 		}
 
+	case "tune-lsh":
+		// Tune for the fingerprints of an index, measuring layouts on it,
+		// or for -bits alone
+		bits := *bits
+		var idx *index.Index
+		if *input != "" {
+			var err error
+			if idx, err = index.LoadWithOptions(*input, loadOpts); err != nil {
+				return err
+			}
+			defer idx.Close()
+			if err := fingerprint.check(idx); err != nil {
+				return err
+			}
+			bits = idx.Bits
+		} else if bits == 0 {
+			bits = simhash.DefaultFingerprintBits
+		}
+		sample := *sample
+		if sample == 0 {
+			sample = 200
+		}
+		return tuneLSH(os.Stdout, idx, bits, *threshold, *recall, sample)
+
+	case "evaluate":
+		if *input == "" {
+			return fmt.Errorf("labelled pairs file must be specified")
+		}
+
+		pairs, err := readLabelledPairs(*input)
+		if err != nil {
+			return err
+		}
+		// Score the fingerprints compare computes, or those of -index
+		detector, model, err := fingerprint.detector(*indexPath, "ngram", loadOpts)
+		if err != nil {
+			return err
+		}
+		defer detector.Close()
+		evaluation := detector.Evaluate(pairs.pairs)
+		// Learned hyperplanes are scored against the random ones the seed
+		// generates, to show what learning gained
+		var random *simhash.Evaluation
+		if model.PlanesDigest != "" && model.Algorithm == simhash.Hyperplane {
+			e := detector.WithHyperplanes(model.Seeded().Hyperplanes()).Evaluate(pairs.pairs)
+			random = &e
+		}
+		if err := detector.Err(); err != nil {
+			return err
+		}
+		return printEvaluation(os.Stdout, evaluation, random, pairs, *threshold, *format)
+
+	case "learn-planes":
+		if *input == "" || *output == "" {
+			return fmt.Errorf("input and output file paths must be specified")
+		}
+		if *planesPath != "" {
+			return fmt.Errorf("learn-planes writes hyperplanes to -o; -planes is for using them")
+		}
+
+		// Check if the input file exists
+		if _, err := os.Stat(*input); os.IsNotExist(err) {
+			return fmt.Errorf("input file '%s' does not exist", *input)
+		}
+
+		model, err := fingerprint.model(simhash.DefaultVectorizer)
+		if err != nil {
+			return err
+		}
+		method, err := simhash.ParsePlaneMethod(*planeMethod)
+		if err != nil {
+			return err
+		}
+
+		// Sample chunks exactly as index splits them
+		opts := chunk.ChunkOptions{
+			ChunkSize:        *size,
+			OverlapSize:      *overlapSize,
+			SplitOnBoundary:  *splitBoundary,
+			BoundaryChars:    *boundaryChars,
+			MaxChunkSize:     *maxChunkSize,
+			PreserveNewlines: *preserveNewlines,
+			Logger:           logger,
+			Verbose:          *verbose,
+			Vectorizer:       model.Vectorizer,
+			Normalizer:       model.Normalizer,
+			Language:         model.Language,
+			Algorithm:        model.Algorithm,
+			Bits:             model.Bits,
+			Seed:             &model.Seed,
+		}
+
+		start := time.Now()
+		hyperplanes, model, sample, err := learnPlanes(*input, *idsPath, model, opts, method, *sample)
+		if err != nil {
+			return err
+		}
+		if err := savePlanes(*output, model, method, len(sample), hyperplanes); err != nil {
+			return err
+		}
+
+		fmt.Printf("Learned %d hyperplanes with %s from %d samples in %v\n",
+			len(hyperplanes), method, len(sample), time.Since(start))
+		fmt.Printf("Bit entropy on the sample: %.3f learned, %.3f random\n",
+			simhash.BitEntropy(sample, hyperplanes), simhash.BitEntropy(sample, model.Hyperplanes()))
+		fmt.Printf("Model: %s\n", model.WithHyperplanes(hyperplanes).ID())
+		return nil
+
+	case "calibrate":
+		if *input == "" || *output == "" {
+			return fmt.Errorf("labelled pairs and output file must be specified")
+		}
+
+		// Fit on the fingerprints compare computes, or those of -index
+		detector, model, err := fingerprint.detector(*indexPath, "ngram", loadOpts)
+		if err != nil {
+			return err
+		}
+		defer detector.Close()
+		calibration, err := fitCalibration(*input, detector, model)
+		if err != nil {
+			return err
+		}
+		if err := detector.Err(); err != nil {
+			return err
+		}
+		if err := saveCalibration(*output, calibration); err != nil {
+			return err
+		}
+
+		fmt.Printf("Fitted calibration for model %s on %d pairs (spread %.3f)\n",
+			model.ID(), calibration.Samples, calibration.Spread)
+		for _, p := range calibration.Points {
+			fmt.Printf("  distance %5.1f%% -> similarity %.2f%%\n", 100*p.Fraction, 100*p.Similarity)
+		}
+		return nil
+
 	case "moderate":
 		if *input == "" {
 			return fmt.Errorf("input file must be specified")
@@ -347,22 +765,44 @@ func printUsage(fs *flag.FlagSet) {
 	fmt.Println("  jamtext -c <command> [options]")
 	fmt.Println("\nCommands:")
 	fmt.Println("  index     - Create index from text file")
+	fmt.Println("  index-vectors - Create index from precomputed vectors (JSON lines or raw float32)")
 	fmt.Println("  lookup    - Exact lookup by SimHash")
 	fmt.Println("  fuzzy     - Fuzzy lookup by SimHash with threshold")
+	fmt.Println("  similar-to - Fuzzy lookup starting from a byte offset in the source")
+	fmt.Println("  passages  - Locate passages of a document in an index built with -winnow")
 	fmt.Println("  hash      - Calculate SimHash for a file")
 	fmt.Println("  stats     - Show index statistics")
 	fmt.Println("  compare   - Compare two text files for similarity")
+	fmt.Println("  calibrate - Fit Hamming distance to similarity on labelled pairs")
+	fmt.Println("  tune-lsh  - Recommend LSH bands for a threshold and target recall")
+	fmt.Println("  evaluate  - Score duplicate detection on labelled pairs")
+	fmt.Println("  learn-planes - Learn hyperplanes from a sample of a corpus (use them with -planes)")
+	fmt.Println("  backup    - Archive an index and its shards into one .tar.gz file")
+	fmt.Println("  restore   - Unpack an index archive into a directory")
 	fmt.Println("  moderate  - Check content against moderation wordlist")
 	fmt.Println("\nOptions:")
 	fs.PrintDefaults()
 	fmt.Println("\nExamples:")
 	fmt.Println("  ./textindex -c moderate -i <input_file.txt> -wordlist <moderation_wordlist.txt> -level <moderation_level>")
 	fmt.Println("  ./textindex -c index -i <input_file.txt> -o <index_file.idx> -s <chunk_size> --log [options = logs.logs ]")
+	fmt.Println("  ./textindex -c index-vectors -i <vectors.jsonl> -o <index_file.idx>")
+	fmt.Println("  ./textindex -c index-vectors -i <vectors.f32> -ids <ids.txt> -vectorizer vector:dims=<dims> -o <index_file.idx>")
 	fmt.Println("  ./textindex -c fuzzy -i <index_file.idx> -h <simhash_value> -threshold <threshold_value>")
 	fmt.Println("  ./textindex -c compare -i <doc1.txt> -i2 <doc2.txt> -o <report.txt>")
+	fmt.Println("  ./textindex -c calibrate -i <pairs.jsonl> -o <calibration.json>")
+	fmt.Println("  ./textindex -c learn-planes -i <corpus.txt> -o <planes.json> [-method pca|itq]")
+	fmt.Println("  ./textindex -c index -i <corpus.txt> -o <index_file.idx> -planes <planes.json>")
+	fmt.Println("  ./textindex -c evaluate -i <pairs.jsonl> -planes <planes.json>")
+	fmt.Println("  ./textindex -c evaluate -i <pairs.jsonl> -index <index_file.idx> -threshold <threshold_value>")
 	fmt.Println("  ./textindex -c lookup -i <index_file.idx> -h <simhash_value>")
+	fmt.Println("  ./textindex -c similar-to -i <index_file.idx> -at <byte_offset> -threshold <threshold_value>")
+	fmt.Println("  ./textindex -c passages -i <suspect.txt> -index <index_file.idx>")
 	fmt.Println("  ./textindex -c stats -i <index_file.idx>")
-	fmt.Println("  ./textindex -c hash -i <input_file.txt>")
+	fmt.Println("  ./textindex -c tune-lsh -i <index_file.idx> -threshold <threshold_value> -recall 0.95")
+	fmt.Println("  ./textindex -c hash -i <input_file.txt> -index <index_file.idx>")
+	fmt.Println("  ./textindex -c hash -i - < <input_file.txt>")
+	fmt.Println("  ./textindex -c backup -i <index_file.idx> -o <archive.tar.gz>")
+	fmt.Println("  ./textindex -c restore -i <archive.tar.gz> -o <target_dir>")
 }
 
 // Add this function to help verify matches
@@ -607,7 +1047,7 @@ func truncateContext(text string, size int) string {
 	return text[:size/2] + "..." + text[len(text)-size/2:]
 }
 
-func lookupAndShowPreview(sourceFile string, hash simhash.SimHash, pos int64, chunkSize int) error {
+func lookupAndShowPreview(sourceFile string, hash simhash.Fingerprint, pos int64, chunkSize int) error {
 	content, err := chunk.ReadChunk(sourceFile, pos, chunkSize)
 	if err != nil {
 		return fmt.Errorf("failed to read chunk at position %d: %w", pos, err)
@@ -619,7 +1059,7 @@ func lookupAndShowPreview(sourceFile string, hash simhash.SimHash, pos int64, ch
 		preview = preview[:50] + "..."
 	}
 
-	fmt.Printf("Hash: %x\n", hash)
+	fmt.Printf("Hash: %s\n", hash)
 	fmt.Printf("Position: %d\n", pos)
 	fmt.Printf("Preview:\n---\n%s\n---\n", preview)
 	return nil
@@ -1,11 +1,19 @@
 package cli
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"jamtext/internal/index"
+	"jamtext/internal/simhash"
 )
 
 // Helper function to capture stdout during test execution
@@ -441,6 +449,26 @@ func TestRunStatsCommand(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "stats as json",
+			args: []string{
+				"program",
+				"-c", "stats",
+				"-i", inputPath,
+				"-format", "json",
+			},
+			wantErr: false,
+		},
+		{
+			name: "stats with unknown format",
+			args: []string{
+				"program",
+				"-c", "stats",
+				"-i", inputPath,
+				"-format", "xml",
+			},
+			wantErr: true,
+		},
 		{
 			name: "stats with logging enabled",
 			args: []string{
@@ -557,3 +585,1044 @@ func createValidIndex(t *testing.T, tmpDir string) (string, string) {
 	}
 	return indexFile, hash
 }
+
+func TestRunSimilarToCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath, _ := createValidIndex(t, tmpDir)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "similar-to with covered offset",
+			args: []string{
+				"program",
+				"-c", "similar-to",
+				"-i", inputPath,
+				"-at", "5",
+			},
+			wantErr: false,
+		},
+		{
+			name: "similar-to with offset past the end",
+			args: []string{
+				"program",
+				"-c", "similar-to",
+				"-i", inputPath,
+				"-at", "100000",
+			},
+			wantErr: true,
+		},
+		{
+			name: "similar-to without offset",
+			args: []string{
+				"program",
+				"-c", "similar-to",
+				"-i", inputPath,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := captureOutput(func() error {
+				return Run(tt.args)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunBackupAndRestoreCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	indexPath, validHash := createValidIndex(t, tmpDir)
+	archivePath := filepath.Join(tmpDir, "index.tar.gz")
+	restoreDir := filepath.Join(tmpDir, "restored")
+
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "backup", "-i", indexPath, "-o", archivePath})
+	}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "restore", "-i", archivePath, "-o", restoreDir})
+	})
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if !strings.Contains(output, filepath.Join(restoreDir, "index.idx")) {
+		t.Errorf("Expected restored index path in output, got %q", output)
+	}
+
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", filepath.Join(restoreDir, "index.idx"), "-h", validHash})
+	}); err != nil {
+		t.Errorf("lookup on restored index failed: %v", err)
+	}
+
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "restore", "-i", indexPath, "-o", restoreDir})
+	}); err == nil {
+		t.Error("Expected restore of a non-archive to fail")
+	}
+}
+
+func TestRunVectorizerSelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-vectorizer", "ngram:n=4"}); err != nil {
+		t.Fatalf("index with ngram vectorizer failed: %v", err)
+	}
+
+	// hash -index reuses the vectorizer and hyperplanes of the index
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash, "-vectorizer", "ngram:n=4,dims=128"})
+	})
+	if err != nil {
+		t.Fatalf("lookup with matching vectorizer failed: %v", err)
+	}
+	if !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the indexed chunk to be found, got %q", output)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash, "-vectorizer", "frequency"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "ngram") {
+		t.Errorf("expected vectorizer mismatch error, got %v", err)
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-vectorizer", "nope"}); err == nil {
+		t.Error("expected error for unknown vectorizer")
+	}
+}
+
+func TestRunExecVectorizerNeedsFlag(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the embedding command")
+	}
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The command leaves a marker behind whenever it runs
+	marker := filepath.Join(tmpDir, "ran")
+	embed := filepath.Join(tmpDir, "embed.sh")
+	script := "#!/bin/sh\ntouch " + marker + "\nwhile read -r line; do echo '{\"vector\": [1, 2, 3, 4]}'; done\n"
+	if err := os.WriteFile(embed, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+	spec := "exec:cmd=" + embed + ",dims=4"
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-vectorizer", spec}); err != nil {
+		t.Fatalf("index with exec vectorizer failed: %v", err)
+	}
+	if err := os.Remove(marker); err != nil {
+		t.Fatalf("indexing did not run the command: %v", err)
+	}
+
+	// The command stored in the index only runs when the flags name it
+	for _, command := range []string{"hash", "compare"} {
+		args := []string{"program", "-c", command, "-i", inputFile, "-i2", inputFile, "-index", indexFile}
+		_, err := captureOutput(func() error { return Run(args) })
+		if err == nil || !strings.Contains(err.Error(), "-vectorizer") {
+			t.Errorf("%s: expected an error asking for -vectorizer, got %v", command, err)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatalf("%s ran the command stored in the index", command)
+		}
+	}
+
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile, "-vectorizer", spec})
+	}); err != nil {
+		t.Fatalf("hash with a matching -vectorizer failed: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("hash with a matching -vectorizer did not run the command")
+	}
+}
+
+func TestRunShingleVectorizer(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("the committee approved the budget after a long debate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reorderedFile := filepath.Join(tmpDir, "reordered.txt")
+	if err := os.WriteFile(reorderedFile, []byte("the budget approved the committee after a long debate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-vectorizer", "shingle:k=2"}); err != nil {
+		t.Fatalf("index with shingle vectorizer failed: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", strings.TrimSpace(output)})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the indexed chunk to be found, got %q, %v", output, err)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", inputFile, "-i2", reorderedFile, "-vectorizer", "shingle:k=2"})
+	})
+	if err != nil {
+		t.Fatalf("compare with shingle vectorizer failed: %v", err)
+	}
+	if strings.Contains(output, "Hamming Distance: 0\n") {
+		t.Errorf("reordered text should not compare as identical with shingles, got %q", output)
+	}
+}
+
+func TestRunNormalization(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("The café’s menu lists crêpes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	variantFile := filepath.Join(tmpDir, "variant.txt")
+	if err := os.WriteFile(variantFile, []byte("THE  CAFE'S ＭＥＮＵ lists crepes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-normalize", "nfkc,fold,diacritics,punct,space"}); err != nil {
+		t.Fatalf("index with normalization failed: %v", err)
+	}
+
+	// The variant spelling normalizes to the indexed text
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", variantFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the variant spelling to find the indexed chunk, got %q, %v", output, err)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash, "-normalize", "none"})
+	})
+	if err == nil {
+		t.Error("expected normalization mismatch error")
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-normalize", "stem"}); err == nil {
+		t.Error("expected error for unknown normalization step")
+	}
+}
+
+func TestRunLanguage(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("The runners were running quickly"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	variantFile := filepath.Join(tmpDir, "variant.txt")
+	if err := os.WriteFile(variantFile, []byte("a runner runs quickly"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-lang", "en"}); err != nil {
+		t.Fatalf("index with language failed: %v", err)
+	}
+
+	// Both texts reduce to the same stems once stopwords are dropped
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", variantFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the inflected text to find the indexed chunk, got %q, %v", output, err)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash, "-lang", "none"})
+	})
+	if err == nil {
+		t.Error("expected language mismatch error")
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-lang", "klingon"}); err == nil {
+		t.Error("expected error for unknown language")
+	}
+}
+
+func TestRunCharikarAlgorithm(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-algorithm", "charikar"}); err != nil {
+		t.Fatalf("index with charikar algorithm failed: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the indexed chunk to be found, got %q, %v", output, err)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash, "-algorithm", "hyperplane"})
+	})
+	if err == nil {
+		t.Error("expected algorithm mismatch error")
+	}
+
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", inputFile, "-i2", inputFile, "-algorithm", "charikar"})
+	}); err != nil {
+		t.Errorf("compare with charikar algorithm failed: %v", err)
+	}
+}
+
+func TestRunMinHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-minhash", "64", "-shingle", "2"}); err != nil {
+		t.Fatalf("index with MinHash failed: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", inputFile, "-i2", inputFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("compare with index failed: %v", err)
+	}
+	if !strings.Contains(output, "Estimated Jaccard similarity: 100.00% (MinHash, 64 hashes over 2-word shingles)") {
+		t.Errorf("expected the index MinHash settings in the comparison, got %q", output)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", inputFile, "-i2", inputFile, "-index", indexFile, "-minhash", "128"})
+	})
+	if err == nil {
+		t.Error("expected MinHash length mismatch error")
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-minhash", "-5"}); err == nil {
+		t.Error("expected an error for a negative MinHash length")
+	}
+}
+
+func TestRunPassages(t *testing.T) {
+	tmpDir := t.TempDir()
+	copied := "The committee reviewed every submission twice before publishing the final rankings"
+	corpus := filepath.Join(tmpDir, "corpus.txt")
+	corpusText := strings.Repeat("Unrelated corpus text about rivers and mountains. ", 100) + copied + "." +
+		strings.Repeat(" More unrelated text about the weather.", 100)
+	if err := os.WriteFile(corpus, []byte(corpusText), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	suspect := filepath.Join(tmpDir, "suspect.txt")
+	if err := os.WriteFile(suspect, []byte("My own introduction. "+copied+". Your own conclusion."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", corpus, "-o", indexFile, "-winnow", "20", "-window", "10"})
+	})
+	if err != nil {
+		t.Fatalf("index with winnowing failed: %v", err)
+	}
+	if !strings.Contains(output, "passage fingerprints") {
+		t.Errorf("expected the index to report passage fingerprints, got %q", output)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "passages", "-i", suspect, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("passages failed: %v", err)
+	}
+	start := strings.Index(corpusText, copied)
+	if !strings.Contains(output, "1 passages of suspect.txt found in corpus.txt") ||
+		!strings.Contains(output, fmt.Sprintf("21-%d", 21+len(copied))) ||
+		!strings.Contains(output, fmt.Sprintf("%d-%d", start, start+len(copied))) {
+		t.Errorf("expected the copied sentence with its byte ranges, got %q", output)
+	}
+
+	// An index built without -winnow cannot locate passages
+	plain := filepath.Join(tmpDir, "plain.idx")
+	if err := Run([]string{"program", "-c", "index", "-i", corpus, "-o", plain}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "passages", "-i", suspect, "-index", plain})
+	})
+	if err == nil || !strings.Contains(err.Error(), "-winnow") {
+		t.Errorf("expected an error asking for -winnow, got %v", err)
+	}
+}
+
+func TestRunWideFingerprints(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-bits", "128"}); err != nil {
+		t.Fatalf("index with 128-bit fingerprints failed: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash with index failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+	if _, digits := simhash.SplitModelHash(hash); len(digits) != 32 {
+		t.Fatalf("expected 32 hex digits, got %q", hash)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the indexed chunk to be found, got %q, %v", output, err)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "fuzzy", "-i", indexFile, "-h", hash, "-bits", "64"})
+	})
+	if err == nil {
+		t.Error("expected fingerprint width mismatch error")
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-bits", "100"}); err == nil {
+		t.Error("expected error for unsupported fingerprint width")
+	}
+}
+
+func TestRunModelHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("index failed: %v", err)
+	}
+	model := simhash.DefaultModel().ID()
+	if !strings.Contains(output, "Model: "+model) {
+		t.Errorf("expected index to report model %s, got %q", model, output)
+	}
+
+	// Without -index the same flags give the same model and hash
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile})
+	})
+	if err != nil {
+		t.Fatalf("hash failed: %v", err)
+	}
+	hash := strings.TrimSpace(output)
+	if id, _ := simhash.SplitModelHash(hash); id != model {
+		t.Fatalf("expected model:hash with model %s, got %q", model, hash)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", hash})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the indexed chunk to be found, got %q, %v", output, err)
+	}
+
+	// A different seed is a different model, whose hashes are rejected
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-seed", "7"})
+	})
+	if err != nil {
+		t.Fatalf("hash with seed failed: %v", err)
+	}
+	other := strings.TrimSpace(output)
+	if id, _ := simhash.SplitModelHash(other); id == model {
+		t.Fatalf("expected another model for seed 7, got %q", other)
+	}
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "fuzzy", "-i", indexFile, "-h", other})
+	})
+	if err == nil || !strings.Contains(err.Error(), "model") {
+		t.Errorf("expected a model mismatch error, got %v", err)
+	}
+
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile, "-seed", "7"})
+	})
+	if err == nil {
+		t.Error("expected seed mismatch error")
+	}
+
+	// Seed 0 is a seed like any other, not the default
+	zeroIndex := filepath.Join(tmpDir, "zero.idx")
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", inputFile, "-o", zeroIndex, "-seed", "0"})
+	}); err != nil {
+		t.Fatalf("index with seed 0 failed: %v", err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-seed", "0"})
+	})
+	if err != nil {
+		t.Fatalf("hash with seed 0 failed: %v", err)
+	}
+	zero := strings.TrimSpace(output)
+	if id, _ := simhash.SplitModelHash(zero); id == model {
+		t.Fatalf("expected another model for seed 0, got %q", zero)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", zeroIndex, "-h", zero})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the chunk indexed with seed 0 to be found, got %q, %v", output, err)
+	}
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile, "-seed", "0"})
+	})
+	if err == nil {
+		t.Error("expected seed 0 to mismatch the default seed")
+	}
+}
+
+func TestRunHashStdin(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	content := strings.Repeat("Streamed content is hashed as it is read. ", 3000)
+	if err := os.WriteFile(inputFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range []string{"hyperplane", "charikar"} {
+		fromFile, err := captureOutput(func() error {
+			return Run([]string{"program", "-c", "hash", "-i", inputFile, "-algorithm", algorithm})
+		})
+		if err != nil {
+			t.Fatalf("hash failed: %v", err)
+		}
+
+		stdin, err := os.Open(inputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldStdin := os.Stdin
+		os.Stdin = stdin
+		fromStdin, err := captureOutput(func() error {
+			return Run([]string{"program", "-c", "hash", "-i", "-", "-algorithm", algorithm})
+		})
+		os.Stdin = oldStdin
+		stdin.Close()
+		if err != nil {
+			t.Fatalf("hash of stdin failed: %v", err)
+		}
+
+		if fromStdin != fromFile {
+			t.Errorf("%s: stdin hashed to %q, file to %q", algorithm, fromStdin, fromFile)
+		}
+	}
+}
+
+func TestRunCodeVectorizer(t *testing.T) {
+	tmpDir := t.TempDir()
+	original := filepath.Join(tmpDir, "original.go")
+	if err := os.WriteFile(original, []byte("package a\n\n// Max returns the larger value\nfunc Max(a, b int) int {\n\tif a > b {\n\t\treturn a\n\t}\n\treturn b\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(tmpDir, "renamed.go")
+	if err := os.WriteFile(renamed, []byte("package b\nfunc Larger(x, y int) int { if x > y { return x }; return y }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([]string, 2)
+	for i, path := range []string{original, renamed} {
+		output, err := captureOutput(func() error {
+			return Run([]string{"program", "-c", "hash", "-i", path, "-vectorizer", "code"})
+		})
+		if err != nil {
+			t.Fatalf("hash with the code vectorizer failed: %v", err)
+		}
+		hashes[i] = output
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("renamed and reformatted code hashed to %q, original to %q", hashes[1], hashes[0])
+	}
+
+	// Without -normalize, code keeps its line breaks and case
+	indexFile := filepath.Join(tmpDir, "code.idx")
+	if err := Run([]string{"program", "-c", "index", "-i", original, "-o", indexFile, "-vectorizer", "code:lang=go"}); err != nil {
+		t.Fatalf("index with the code vectorizer failed: %v", err)
+	}
+	idx, err := index.Load(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.Normalizer.String(); got != simhash.CodeNormalizer {
+		t.Errorf("index normalization = %q, want %q", got, simhash.CodeNormalizer)
+	}
+
+	// lang=auto is fixed to the language of the indexed file, and hashing
+	// the same file gives the same model
+	autoIndex := filepath.Join(tmpDir, "auto.idx")
+	if err := Run([]string{"program", "-c", "index", "-i", original, "-o", autoIndex, "-vectorizer", "code"}); err != nil {
+		t.Fatalf("index with the code vectorizer failed: %v", err)
+	}
+	autoIdx, err := index.Load(autoIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := autoIdx.Vectorizer.Params["lang"]; got != "go" {
+		t.Errorf("index of a Go file has lang=%s, want go", got)
+	}
+	if id, _ := simhash.SplitModelHash(hashes[0]); id != autoIdx.Model().ID() {
+		t.Errorf("hash %q is not from the index model %s", hashes[0], autoIdx.Model().ID())
+	}
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", original, "-index", autoIndex, "-vectorizer", "code"})
+	}); err != nil {
+		t.Errorf("-vectorizer code should select the index vectorizer: %v", err)
+	}
+}
+
+func TestRunCalibration(t *testing.T) {
+	tmpDir := t.TempDir()
+	file1 := filepath.Join(tmpDir, "a.txt")
+	file2 := filepath.Join(tmpDir, "b.txt")
+	if err := os.WriteFile(file1, []byte("The quick brown fox jumps over the lazy dog"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file2, []byte("The quick brown fox jumped over the lazy dog"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", file1, "-i2", file2})
+	})
+	if err != nil {
+		t.Fatalf("compare failed: %v", err)
+	}
+	if !strings.Contains(output, "Estimated cosine similarity: ") || !strings.Contains(output, "95% CI") {
+		t.Errorf("expected an estimated cosine with its interval, got %q", output)
+	}
+
+	pairs := filepath.Join(tmpDir, "pairs.jsonl")
+	lines := []string{
+		`{"a": "The quick brown fox jumps over the lazy dog", "b": "The quick brown fox jumps over the lazy dog", "similarity": 1}`,
+		`{"a": "The quick brown fox jumps over the lazy dog", "b": "The quick brown fox jumped over the lazy dog", "similarity": 0.9}`,
+		`{"a": "The quick brown fox jumps over the lazy dog", "b": "Completely unrelated words about tax law", "similarity": 0}`,
+	}
+	if err := os.WriteFile(pairs, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	calibrationFile := filepath.Join(tmpDir, "calibration.json")
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "calibrate", "-i", pairs, "-o", calibrationFile})
+	})
+	if err != nil {
+		t.Fatalf("calibrate failed: %v", err)
+	}
+	if !strings.Contains(output, "on 3 pairs") {
+		t.Errorf("expected a fit summary, got %q", output)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", file1, "-i2", file1, "-calibration", calibrationFile})
+	})
+	if err != nil {
+		t.Fatalf("compare with calibration failed: %v", err)
+	}
+	if !strings.Contains(output, "Calibrated similarity: 100.00%") {
+		t.Errorf("expected the fitted similarity of identical files, got %q", output)
+	}
+
+	// A calibration only applies to the model it was fitted on
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "compare", "-i", file1, "-i2", file2, "-calibration", calibrationFile, "-bits", "128"})
+	})
+	if err == nil {
+		t.Error("expected a model mismatch error")
+	}
+
+	// A pair without a usable similarity is an error, not a similarity of 0
+	for _, bad := range []string{
+		`{"a": "The quick brown fox", "b": "The quick brown fox", "duplicate": true}`,
+		`{"a": "The quick brown fox", "b": "The quick brown fox", "similarity": 90}`,
+	} {
+		if err := os.WriteFile(pairs, []byte(lines[0]+"\n"+bad+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = captureOutput(func() error {
+			return Run([]string{"program", "-c", "calibrate", "-i", pairs, "-o", calibrationFile})
+		})
+		if err == nil || !strings.Contains(err.Error(), ":2:") || !strings.Contains(err.Error(), "similarity") {
+			t.Errorf("%s: expected an error naming line 2 and the similarity, got %v", bad, err)
+		}
+	}
+}
+
+func TestRunTuneLSH(t *testing.T) {
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "tune-lsh", "-threshold", "3", "-recall", "0.95"})
+	})
+	if err != nil {
+		t.Fatalf("tune-lsh failed: %v", err)
+	}
+	if !strings.Contains(output, "Recommended: -lsh-bands 8 -band-size 8") || !strings.Contains(output, "S-curve") {
+		t.Errorf("expected 8 bands of 8 bits to be recommended, got %q", output)
+	}
+
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "sample.txt")
+	if err := os.WriteFile(inputFile, []byte("Sample content for indexing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.idx")
+
+	// The recommended layout is applied when indexing and belongs to the model
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-lsh-bands", "8", "-band-size", "8"})
+	}); err != nil {
+		t.Fatalf("index with LSH layout failed: %v", err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "tune-lsh", "-i", indexFile, "-threshold", "3"})
+	})
+	if err != nil {
+		t.Fatalf("tune-lsh on index failed: %v", err)
+	}
+	if !strings.Contains(output, "Measured recall") || !strings.Contains(output, "(current)") {
+		t.Errorf("expected measurements on the index, got %q", output)
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-lsh-bands", "8"})
+	})
+	if err != nil {
+		t.Fatalf("hash with LSH layout failed: %v", err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "lookup", "-i", indexFile, "-h", strings.TrimSpace(output)})
+	})
+	if err != nil || !strings.Contains(output, "Found matches") {
+		t.Errorf("expected the hash of the same model to be found, got %q, %v", output, err)
+	}
+
+	if err := Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-lsh-bands", "8", "-band-size", "16"}); err == nil {
+		t.Error("expected error for bands that do not cover the fingerprint")
+	}
+	_, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "stats", "-i", indexFile, "-lsh-bands", "4"})
+	})
+	if err == nil {
+		t.Error("expected LSH bands mismatch error")
+	}
+}
+
+func TestRunEvaluate(t *testing.T) {
+	tmpDir := t.TempDir()
+	pairs := filepath.Join(tmpDir, "pairs.jsonl")
+	lines := []string{
+		`{"a": "The quick brown fox jumps over the lazy dog", "b": "The quick brown fox jumps over the lazy dog.", "duplicate": true}`,
+		`{"a": "Rain is expected over the weekend in the north", "b": "Rain expected this weekend across the north", "duplicate": true}`,
+		`{"a": "Stock markets fell sharply on Monday", "b": "Cooking pasta requires salted boiling water", "duplicate": false}`,
+	}
+	if err := os.WriteFile(pairs, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "evaluate", "-i", pairs, "-threshold", "0"})
+	})
+	if err != nil {
+		t.Fatalf("evaluate failed: %v", err)
+	}
+	for _, want := range []string{"Evaluated 3 pairs (2 duplicates)", "ROC AUC:", "Best F1:", "Worst misclassifications at threshold 0", "Rain is expected"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got %q", want, output)
+		}
+	}
+
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "evaluate", "-i", pairs, "-format", "json"})
+	})
+	if err != nil || !strings.Contains(output, `"thresholds"`) {
+		t.Errorf("expected JSON output, got %q, %v", output, err)
+	}
+
+	if err := os.WriteFile(pairs, []byte("{not json}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run([]string{"program", "-c", "evaluate", "-i", pairs}); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("expected an error naming the bad line, got %v", err)
+	}
+
+	// A pair without a label is an error, not a pair of different texts
+	unlabelled := lines[0] + "\n" + `{"a": "Stock markets fell", "b": "Stock markets fell", "similarity": 1}` + "\n"
+	if err := os.WriteFile(pairs, []byte(unlabelled), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run([]string{"program", "-c", "evaluate", "-i", pairs}); err == nil || !strings.Contains(err.Error(), ":2:") || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected an error naming line 2 and the label, got %v", err)
+	}
+}
+
+func TestRunIndexVectors(t *testing.T) {
+	tmpDir := t.TempDir()
+	vectors := [][]float32{
+		{1, 0, 0, 0.5},
+		{0, 1, 0, -0.5},
+		{0, 0, 1, 0.25},
+	}
+
+	var lines []string
+	var raw []byte
+	for i, v := range vectors {
+		lines = append(lines, fmt.Sprintf(`{"id": "doc-%d", "vector": [%g, %g, %g, %g]}`, i, v[0], v[1], v[2], v[3]))
+		for _, x := range v {
+			raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(x))
+		}
+	}
+	jsonl := filepath.Join(tmpDir, "vectors.jsonl")
+	if err := os.WriteFile(jsonl, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f32 := filepath.Join(tmpDir, "vectors.f32")
+	if err := os.WriteFile(f32, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ids := filepath.Join(tmpDir, "ids.txt")
+	if err := os.WriteFile(ids, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dimensions come from the first JSON line
+	indexFile := filepath.Join(tmpDir, "vectors.idx")
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index-vectors", "-i", jsonl, "-o", indexFile, "-index-dir", tmpDir})
+	})
+	if err != nil {
+		t.Fatalf("index-vectors failed: %v", err)
+	}
+	if !strings.Contains(output, "Indexed 3 vectors") {
+		t.Errorf("expected a count of vectors, got %q", output)
+	}
+
+	// A query vector is hashed like any query text and found by its ID
+	query := filepath.Join(tmpDir, "query.json")
+	if err := os.WriteFile(query, []byte("[0, 0.95, 0.05, -0.5]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", query, "-index", indexFile})
+	})
+	if err != nil {
+		t.Fatalf("hash of a query vector failed: %v", err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "fuzzy", "-i", indexFile, "-h", strings.TrimSpace(hash), "-threshold", "10"})
+	})
+	if err != nil {
+		t.Fatalf("fuzzy failed: %v", err)
+	}
+	if !strings.Contains(output, "Record: doc-1") {
+		t.Errorf("expected the nearest record, got %q", output)
+	}
+
+	// Raw float32 vectors give the same model and fingerprints
+	rawIndex := filepath.Join(tmpDir, "raw.idx")
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index-vectors", "-i", f32, "-ids", ids, "-vectorizer", "vector:dims=4",
+			"-o", rawIndex, "-index-dir", tmpDir})
+	}); err != nil {
+		t.Fatalf("index-vectors of raw vectors failed: %v", err)
+	}
+	a, err := index.Load(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := index.Load(rawIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Model().ID() != b.Model().ID() {
+		t.Errorf("JSON-lines model %s, raw model %s", a.Model().ID(), b.Model().ID())
+	}
+	if id, ok := b.RecordID(2); !ok || id != "c" {
+		t.Errorf("RecordID(2) = %q, %v; want the third line of the IDs file", id, ok)
+	}
+
+	if err := Run([]string{"program", "-c", "index-vectors", "-i", f32, "-o", rawIndex, "-index-dir", tmpDir}); err == nil {
+		t.Error("expected an error for raw vectors without dimensions")
+	}
+	if err := Run([]string{"program", "-c", "index-vectors", "-i", jsonl, "-o", rawIndex, "-vectorizer", "vector:dims=8", "-index-dir", tmpDir}); err == nil {
+		t.Error("expected an error for vectors of other dimensions")
+	}
+}
+
+func TestRunLearnPlanes(t *testing.T) {
+	tmpDir := t.TempDir()
+	topics := [][]string{
+		{"market", "stock", "price", "trade", "bank", "rate", "bond", "fund"},
+		{"game", "team", "player", "score", "coach", "season", "match", "goal"},
+		{"cell", "gene", "protein", "virus", "patient", "drug", "trial", "dose"},
+	}
+	var corpus strings.Builder
+	for i := 0; i < 300; i++ {
+		words := topics[i%len(topics)]
+		fmt.Fprintf(&corpus, "the %s and the %s of a %s were %s. ", words[i%8], words[(i/3)%8], words[(i/7)%8], words[(i/11)%8])
+	}
+	inputFile := filepath.Join(tmpDir, "corpus.txt")
+	if err := os.WriteFile(inputFile, []byte(corpus.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	planes := filepath.Join(tmpDir, "planes.json")
+	output, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "learn-planes", "-i", inputFile, "-o", planes, "-s", "1024", "-sample", "100"})
+	})
+	if err != nil {
+		t.Fatalf("learn-planes failed: %v", err)
+	}
+	if !strings.Contains(output, "Learned 64 hyperplanes with pca") || !strings.Contains(output, "Bit entropy") {
+		t.Errorf("unexpected learn-planes output %q", output)
+	}
+
+	// The index stores the learned hyperplanes, and queries with -planes or
+	// -index hash alike
+	indexFile := filepath.Join(tmpDir, "learned.idx")
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", inputFile, "-o", indexFile, "-s", "1024", "-planes", planes, "-index-dir", tmpDir})
+	}); err != nil {
+		t.Fatalf("index with -planes failed: %v", err)
+	}
+	idx, err := index.Load(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadPlanes(planes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(idx.Hyperplanes, saved.Hyperplanes) {
+		t.Error("index does not use the learned hyperplanes")
+	}
+	withPlanes, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-planes", planes})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withIndex, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "hash", "-i", inputFile, "-index", indexFile, "-planes", planes})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withPlanes != withIndex || !strings.HasPrefix(withPlanes, idx.Model().ID()+":") {
+		t.Errorf("hash with -planes %q, with -index %q, index model %s", withPlanes, withIndex, idx.Model().ID())
+	}
+
+	// Evaluation scores the random hyperplanes too
+	pairs := filepath.Join(tmpDir, "pairs.jsonl")
+	lines := []string{
+		`{"a": "the market and the stock of a bank were rate", "b": "the market and the stock of a bank were bond", "duplicate": true}`,
+		`{"a": "the game and the team of a coach were score", "b": "the cell and the gene of a virus were dose", "duplicate": false}`,
+	}
+	if err := os.WriteFile(pairs, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(func() error {
+		return Run([]string{"program", "-c", "evaluate", "-i", pairs, "-planes", planes})
+	})
+	if err != nil {
+		t.Fatalf("evaluate with -planes failed: %v", err)
+	}
+	if !strings.Contains(output, "Random hyperplanes:") || !strings.Contains(output, "Learned gain:") {
+		t.Errorf("expected a comparison with random hyperplanes, got %q", output)
+	}
+
+	seeded := filepath.Join(tmpDir, "seeded.idx")
+	if _, err := captureOutput(func() error {
+		return Run([]string{"program", "-c", "index", "-i", inputFile, "-o", seeded, "-s", "1024", "-index-dir", tmpDir})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-c", "hash", "-i", inputFile, "-index", seeded, "-planes", planes},
+		{"-c", "hash", "-i", inputFile, "-planes", planes, "-bits", "128"},
+		{"-c", "hash", "-i", inputFile, "-planes", planes, "-vectorizer", "ngram"},
+		{"-c", "learn-planes", "-i", inputFile, "-o", planes, "-method", "lda"},
+	} {
+		if err := Run(append([]string{"program"}, args...)); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
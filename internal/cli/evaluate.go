@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"jamtext/internal/simhash"
+)
+
+const (
+	// worstCount is how many misclassified pairs evaluate lists
+	worstCount = 5
+	// snippetRunes is how much of each text a misclassified pair shows
+	snippetRunes = 60
+)
+
+// labelledPairs are the pairs of a JSON-lines file with the line of each
+type labelledPairs struct {
+	pairs []simhash.LabelledPair
+	lines []int
+}
+
+// readLabelledPairs reads pairs labelled "duplicate": true or false
+func readLabelledPairs(path string) (labelledPairs, error) {
+	var lp labelledPairs
+	err := readJSONLines(path, func(line int, data []byte) error {
+		var pair simhash.LabelledPair
+		if err := json.Unmarshal(data, &pair); err != nil {
+			return err
+		}
+		lp.pairs = append(lp.pairs, pair)
+		lp.lines = append(lp.lines, line)
+		return nil
+	})
+	if err == nil && len(lp.pairs) == 0 {
+		err = fmt.Errorf("%s has no labelled pairs", path)
+	}
+	return lp, err
+}
+
+// printEvaluation writes the scores of an evaluation as a table or as JSON.
+// The table shows the ROC points, the threshold with the best F1 score and
+// the pairs that threshold misclassifies worst. The scores of random
+// hyperplanes, when given, show what learned ones gain over them.
+func printEvaluation(w io.Writer, e simhash.Evaluation, random *simhash.Evaluation, lp labelledPairs, threshold int, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			simhash.Evaluation
+			Random *simhash.Evaluation `json:"random_hyperplanes,omitempty"`
+		}{e, random})
+	case "table", "":
+	default:
+		return fmt.Errorf("unknown evaluation format %q (table|json)", format)
+	}
+
+	duplicates := 0
+	for _, pair := range lp.pairs {
+		if pair.Duplicate {
+			duplicates++
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Evaluated %d pairs (%d duplicates) with %d-bit fingerprints\n", len(lp.pairs), duplicates, e.Bits)
+	fmt.Fprintf(tw, "ROC AUC:\t%.4f\n", e.AUC)
+
+	fmt.Fprintln(tw, "\nThreshold\tPrecision\tRecall\tF1\tFalse positive rate")
+	for _, m := range e.ROC() {
+		fmt.Fprintf(tw, "%d\t%.4f\t%.4f\t%.4f\t%.4f\n", m.Threshold, m.Precision, m.Recall, m.F1, m.FalsePositiveRate)
+	}
+
+	best := e.Best()
+	fmt.Fprintf(tw, "\nBest F1:\t%.4f at threshold %d\n", best.F1, best.Threshold)
+	if random != nil {
+		randomBest := random.Best()
+		fmt.Fprintf(tw, "Random hyperplanes:\tROC AUC %.4f, best F1 %.4f at threshold %d\n",
+			random.AUC, randomBest.F1, randomBest.Threshold)
+		fmt.Fprintf(tw, "Learned gain:\tROC AUC %+.4f, best F1 %+.4f\n", e.AUC-random.AUC, best.F1-randomBest.F1)
+	}
+	at := e.At(threshold)
+	fmt.Fprintf(tw, "At threshold %d:\tprecision %.4f, recall %.4f, F1 %.4f (%d TP, %d FP, %d TN, %d FN)\n",
+		at.Threshold, at.Precision, at.Recall, at.F1,
+		at.TruePositives, at.FalsePositives, at.TrueNegatives, at.FalseNegatives)
+
+	worst := e.Misclassified(threshold, worstCount)
+	if len(worst) > 0 {
+		fmt.Fprintf(tw, "\nWorst misclassifications at threshold %d:\n", threshold)
+		fmt.Fprintln(tw, "Line\tLabel\tDistance\tA\tB")
+		for _, r := range worst {
+			label := "not duplicate"
+			if r.Duplicate {
+				label = "duplicate"
+			}
+			pair := lp.pairs[r.Pair]
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", lp.lines[r.Pair], label, r.Distance, snippet(pair.A), snippet(pair.B))
+		}
+	}
+	return tw.Flush()
+}
+
+// snippet shortens text to one line for a table cell
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > snippetRunes {
+		return string(runes[:snippetRunes]) + "..."
+	}
+	return text
+}
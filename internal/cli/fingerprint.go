@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"fmt"
+
+	"jamtext/internal/index"
+	"jamtext/internal/simhash"
+)
+
+// fingerprintFlags holds the flags that select how fingerprints are computed.
+// Settings recorded in an index always win, and explicit flags that disagree
+// with them are rejected because the hashes would not be comparable.
+type fingerprintFlags struct {
+	vectorizer string
+	normalize  string
+	language   string
+	algorithm  string
+	bits       int
+	seed       int64
+	seedSet    bool // -seed was given, so even a seed of 0 is checked
+	lshBands   int
+	bandSize   int
+	planes     string // Hyperplanes learned by learn-planes
+	source     string // Input whose start fixes settings that depend on it
+	sourceHead string
+}
+
+// resolveVectorizer picks the vectorizer for a command
+func (f fingerprintFlags) resolveVectorizer(idx *index.Index, fallback string) (simhash.VectorizerConfig, error) {
+	if idx != nil {
+		if f.vectorizer != "" {
+			requested, err := simhash.ParseVectorizerConfig(f.vectorizer)
+			if err != nil {
+				return simhash.VectorizerConfig{}, err
+			}
+			if !requested.Selects(idx.Vectorizer) {
+				return simhash.VectorizerConfig{}, fmt.Errorf(
+					"index was built with vectorizer %s, not %s", idx.Vectorizer, requested)
+			}
+		}
+		return idx.Vectorizer, nil
+	}
+
+	spec := f.vectorizer
+	if spec == "" {
+		spec = fallback
+	}
+	return simhash.ParseVectorizerConfig(spec)
+}
+
+// resolveNormalizer picks the text normalization for a command; without
+// -normalize it is the default of the vectorizer
+func (f fingerprintFlags) resolveNormalizer(idx *index.Index, cfg simhash.VectorizerConfig) (simhash.Normalizer, error) {
+	spec := f.normalize
+	if spec == "" {
+		spec = simhash.DefaultNormalizerFor(cfg)
+	}
+	requested, err := simhash.ParseNormalizer(spec)
+	if err != nil {
+		return simhash.Normalizer{}, err
+	}
+	if idx == nil {
+		return requested, nil
+	}
+	if f.normalize != "" && requested != idx.Normalizer {
+		return simhash.Normalizer{}, fmt.Errorf("index was built with normalization %s, not %s", idx.Normalizer, requested)
+	}
+	return idx.Normalizer, nil
+}
+
+// resolveLanguage picks the tokenization language for a command
+func (f fingerprintFlags) resolveLanguage(idx *index.Index) (simhash.Language, error) {
+	requested, err := simhash.ParseLanguage(f.language)
+	if err != nil {
+		return "", err
+	}
+	if idx == nil {
+		return requested, nil
+	}
+	if f.language != "" && requested != idx.Language {
+		return "", fmt.Errorf("index was built with language %s, not %s", idx.Language, requested)
+	}
+	return idx.Language, nil
+}
+
+// resolveAlgorithm picks the fingerprint algorithm for a command
+func (f fingerprintFlags) resolveAlgorithm(idx *index.Index) (simhash.Algorithm, error) {
+	requested, err := simhash.ParseAlgorithm(f.algorithm)
+	if err != nil {
+		return "", err
+	}
+	if idx == nil {
+		return requested, nil
+	}
+	if f.algorithm != "" && requested != idx.Algorithm {
+		return "", fmt.Errorf("index was built with the %s algorithm, not %s", idx.Algorithm, requested)
+	}
+	return idx.Algorithm, nil
+}
+
+// resolveBits picks the fingerprint width for a command
+func (f fingerprintFlags) resolveBits(idx *index.Index) (int, error) {
+	if idx != nil {
+		if f.bits != 0 && f.bits != idx.Bits {
+			return 0, fmt.Errorf("index uses %d-bit fingerprints, not %d", idx.Bits, f.bits)
+		}
+		return idx.Bits, nil
+	}
+
+	if f.bits == 0 {
+		return simhash.DefaultFingerprintBits, nil
+	}
+	return f.bits, simhash.ValidateFingerprintBits(f.bits)
+}
+
+// resolveSeed picks the seed of the hyperplanes and LSH permutations
+func (f fingerprintFlags) resolveSeed(idx *index.Index) (int64, error) {
+	if idx != nil {
+		if f.seedSet && f.seed != idx.Seed {
+			return 0, fmt.Errorf("index was built with seed %d, not %d", idx.Seed, f.seed)
+		}
+		return idx.Seed, nil
+	}
+	return f.seed, nil
+}
+
+// resolveLSHBands picks the number of LSH bands for fingerprints of bits
+// bits. The band count and band size must multiply to the width when both
+// are given; neither selects one band per 16 bits.
+func (f fingerprintFlags) resolveLSHBands(idx *index.Index, bits int) (int, error) {
+	bands := f.lshBands
+	if f.bandSize != 0 {
+		if bits%f.bandSize != 0 {
+			return 0, fmt.Errorf("LSH band size %d does not divide %d-bit fingerprints", f.bandSize, bits)
+		}
+		if bands != 0 && bands*f.bandSize != bits {
+			return 0, fmt.Errorf("%d LSH bands of %d bits cover %d bits, but fingerprints have %d",
+				bands, f.bandSize, bands*f.bandSize, bits)
+		}
+		bands = bits / f.bandSize
+	}
+
+	if idx != nil {
+		if bands != 0 && bands != idx.LSHTable.Bands() {
+			return 0, fmt.Errorf("index uses %d LSH bands, not %d", idx.LSHTable.Bands(), bands)
+		}
+		return idx.LSHTable.Bands(), nil
+	}
+
+	if bands == 0 {
+		return bits / simhash.LSHBandBits, nil
+	}
+	return bands, simhash.ValidateLSHBands(bits, bands)
+}
+
+// model builds the fingerprint model selected by the flags alone. Learned
+// hyperplanes bring the settings they were learned with.
+func (f fingerprintFlags) model(fallback string) (simhash.Model, error) {
+	cfg, err := f.resolveVectorizer(nil, fallback)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	if f.source != "" {
+		cfg = cfg.ForSource(f.source, f.sourceHead)
+	}
+	normalizer, err := f.resolveNormalizer(nil, cfg)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	language, err := f.resolveLanguage(nil)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	algorithm, err := f.resolveAlgorithm(nil)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	bits, err := f.resolveBits(nil)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	seed, err := f.resolveSeed(nil)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	model := simhash.Model{
+		Vectorizer: cfg,
+		Normalizer: normalizer,
+		Language:   language,
+		Algorithm:  algorithm,
+		Bits:       bits,
+		Seed:       seed,
+	}
+	if f.planes != "" {
+		planes, err := loadPlanes(f.planes)
+		if err != nil {
+			return simhash.Model{}, err
+		}
+		if model, err = planes.apply(f, model); err != nil {
+			return simhash.Model{}, err
+		}
+	}
+	if model.LSHBands, err = f.resolveLSHBands(nil, model.Bits); err != nil {
+		return simhash.Model{}, err
+	}
+	return model, nil
+}
+
+// parseHash parses a hash given to an index command. A model:hash prefix
+// must name the model of the index.
+func parseHash(idx *index.Index, s string) (simhash.Fingerprint, error) {
+	model, hash := simhash.SplitModelHash(s)
+	if model != "" {
+		if id := idx.Model().ID(); model != id {
+			return simhash.Fingerprint{}, fmt.Errorf("hash is from model %s, but the index uses model %s", model, id)
+		}
+	}
+	fp, err := simhash.ParseFingerprint(hash, idx.Bits)
+	if err != nil {
+		return simhash.Fingerprint{}, fmt.Errorf("invalid hash: %w", err)
+	}
+	return fp, nil
+}
+
+// check rejects flags that disagree with the settings of an index
+func (f fingerprintFlags) check(idx *index.Index) error {
+	if _, err := f.resolveVectorizer(idx, ""); err != nil {
+		return err
+	}
+	if _, err := f.resolveNormalizer(idx, idx.Vectorizer); err != nil {
+		return err
+	}
+	if _, err := f.resolveLanguage(idx); err != nil {
+		return err
+	}
+	if _, err := f.resolveAlgorithm(idx); err != nil {
+		return err
+	}
+	if _, err := f.resolveBits(idx); err != nil {
+		return err
+	}
+	if _, err := f.resolveLSHBands(idx, idx.Bits); err != nil {
+		return err
+	}
+	if _, err := f.resolveSeed(idx); err != nil {
+		return err
+	}
+	return f.checkPlanes(idx)
+}
+
+// checkCommand refuses a vectorizer that runs a command when a file named
+// it rather than the flags: an index or hyperplanes file from elsewhere
+// must not run whatever command it holds. Once -vectorizer is given, the
+// check against the file has already made sure it is the same command.
+func (f fingerprintFlags) checkCommand(cfg simhash.VectorizerConfig, origin string) error {
+	if cfg.RunsCommand() && f.vectorizer == "" {
+		return fmt.Errorf("%s vectorizes text by running %q; pass -vectorizer %q to run it",
+			origin, cfg.Params["cmd"], cfg.String())
+	}
+	return nil
+}
+
+// detector builds a document similarity detector and returns it with its
+// model, taking vectorizer, normalization, language, algorithm, width,
+// hyperplanes and learned corpus statistics from an index when one is given
+func (f fingerprintFlags) detector(indexFile, fallback string, opts index.LoadOptions) (*simhash.DocumentSimilarity, simhash.Model, error) {
+	if indexFile == "" {
+		model, err := f.model(fallback)
+		if err != nil {
+			return nil, simhash.Model{}, err
+		}
+		vectorizer, err := model.NewVectorizer()
+		if err != nil {
+			return nil, simhash.Model{}, err
+		}
+		return simhash.NewDocumentSimilarityWithAlgorithm(model.Algorithm, model.Bits, model.Hyperplanes(), vectorizer), model, nil
+	}
+
+	idx, err := index.LoadWithOptions(indexFile, opts)
+	if err != nil {
+		return nil, simhash.Model{}, err
+	}
+	defer idx.Close()
+
+	if err := f.check(idx); err != nil {
+		return nil, simhash.Model{}, err
+	}
+	if err := f.checkCommand(idx.Vectorizer, "index "+indexFile); err != nil {
+		return nil, simhash.Model{}, err
+	}
+	if idx.Algorithm == simhash.Hyperplane {
+		if err := simhash.ValidateHyperplanes(idx.Hyperplanes, idx.Vectorizer.Dimensions()); err != nil {
+			return nil, simhash.Model{}, err
+		}
+	}
+	vectorizer, err := idx.NewVectorizer()
+	if err != nil {
+		return nil, simhash.Model{}, err
+	}
+	return simhash.NewDocumentSimilarityWithAlgorithm(idx.Algorithm, idx.Bits, idx.Hyperplanes, vectorizer), idx.Model(), nil
+}
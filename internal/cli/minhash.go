@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"jamtext/internal/index"
+	"jamtext/internal/minhash"
+	"jamtext/internal/simhash"
+)
+
+// minhashFlags holds the flags that select how MinHash signatures are
+// computed. As with fingerprints, the settings of an index win.
+type minhashFlags struct {
+	hashes  int // 0 leaves MinHash off when indexing and selects the default otherwise
+	shingle int
+}
+
+// indexConfig returns the MinHash settings for a new index; the zero Config
+// when signatures were not requested
+func (f minhashFlags) indexConfig() (minhash.Config, error) {
+	if f.hashes == 0 {
+		return minhash.Config{}, nil
+	}
+	cfg := minhash.NewConfig(f.hashes, f.shingle)
+	return cfg, cfg.Validate()
+}
+
+// resolve picks the MinHash settings for comparing texts, taking them from
+// the index at indexFile when it stores signatures
+func (f minhashFlags) resolve(indexFile string, opts index.LoadOptions) (minhash.Config, error) {
+	if indexFile != "" {
+		idx, err := index.LoadWithOptions(indexFile, opts)
+		if err != nil {
+			return minhash.Config{}, err
+		}
+		defer idx.Close()
+
+		if idx.MinHash.Enabled() {
+			if f.hashes != 0 && f.hashes != idx.MinHash.NumHashes {
+				return minhash.Config{}, fmt.Errorf("index uses %d MinHash hashes, not %d", idx.MinHash.NumHashes, f.hashes)
+			}
+			return idx.MinHash, nil
+		}
+	}
+
+	hashes := f.hashes
+	if hashes == 0 {
+		hashes = minhash.DefaultConfig().NumHashes
+	}
+	cfg := minhash.NewConfig(hashes, f.shingle)
+	return cfg, cfg.Validate()
+}
+
+// jaccardReport estimates the Jaccard similarity of two texts from their
+// signatures
+func jaccardReport(cfg minhash.Config, sig1, sig2 minhash.Signature) string {
+	j := minhash.Jaccard(sig1, sig2)
+	return fmt.Sprintf("Estimated Jaccard similarity: %.2f%% (MinHash, %d hashes over %d-word shingles)",
+		j*100, cfg.NumHashes, cfg.ShingleSize)
+}
+
+// hashFile computes the fingerprint and MinHash signature of a file in one
+// pass over it
+func hashFile(detector *simhash.DocumentSimilarity, hasher *minhash.Hasher, path string) (simhash.Fingerprint, minhash.Signature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return simhash.Fingerprint{}, nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := hasher.NewWriter()
+	fp, err := detector.FingerprintReader(io.TeeReader(f, w))
+	if err != nil {
+		return simhash.Fingerprint{}, nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return fp, w.Signature(), nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"jamtext/internal/index"
+	"jamtext/internal/winnow"
+)
+
+// winnowFlags holds the flags that select how passage fingerprints are
+// selected when indexing
+type winnowFlags struct {
+	k      int // 0 stores no passage fingerprints
+	window int
+}
+
+// indexConfig returns the winnowing settings for a new index; the zero
+// Config when passage fingerprints were not requested
+func (f winnowFlags) indexConfig() (winnow.Config, error) {
+	if f.k == 0 {
+		return winnow.Config{}, nil
+	}
+	cfg := winnow.Config{K: f.k, Window: f.window}
+	return cfg, cfg.Validate()
+}
+
+// printPassages lists the passages of the document at path that also occur
+// in the source file of idx, with their byte ranges in both
+func printPassages(w io.Writer, idx *index.Index, path string) error {
+	winnower, err := idx.NewWinnower()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var query []winnow.Fingerprint
+	if err := winnower.Read(f, func(fp winnow.Fingerprint) { query = append(query, fp) }); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	passages, err := idx.Passages(query)
+	if err != nil {
+		return err
+	}
+
+	// The fingerprints only bound a passage to within a window; both texts
+	// are compared around it to find where the copy starts and ends
+	if len(passages) > 0 {
+		src, err := os.Open(idx.SourceFile)
+		if err != nil {
+			return fmt.Errorf("failed to open the indexed source: %w", err)
+		}
+		defer src.Close()
+		for i, p := range passages {
+			if passages[i], err = winnower.Extend(p, f, src); err != nil {
+				return err
+			}
+		}
+	}
+
+	name, source := filepath.Base(path), filepath.Base(idx.SourceFile)
+	if len(passages) == 0 {
+		fmt.Fprintf(w, "No passages of %s found in %s\n", name, source)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	cfg := winnower.Config()
+	fmt.Fprintf(tw, "%d passages of %s found in %s (k=%d, window %d; passages of %d+ characters are always found):\n",
+		len(passages), name, source, cfg.K, cfg.Window, cfg.Guarantee())
+	fmt.Fprintf(tw, "%s bytes\t%s bytes\tFingerprints\tText\n", name, source)
+	for _, p := range passages {
+		text := make([]byte, p.QueryEnd-p.QueryStart)
+		n, _ := f.ReadAt(text, p.QueryStart)
+		fmt.Fprintf(tw, "%d-%d\t%d-%d\t%d\t%s\n", p.QueryStart, p.QueryEnd, p.SourceStart, p.SourceEnd,
+			p.Fingerprints, snippet(string(text[:n])))
+	}
+
+	covered := coveredBytes(passages)
+	if size := info.Size(); size > 0 {
+		fmt.Fprintf(tw, "\nShared: %d of %d bytes of %s (%.1f%%)\n", covered, size, name, 100*float64(covered)/float64(size))
+	}
+	return tw.Flush()
+}
+
+// coveredBytes counts the bytes of the query inside at least one of
+// passages, which are ordered by their start in the query
+func coveredBytes(passages []winnow.Passage) int64 {
+	var covered, end int64
+	for _, p := range passages {
+		start := max(p.QueryStart, end)
+		if p.QueryEnd > start {
+			covered += p.QueryEnd - start
+		}
+		end = max(end, p.QueryEnd)
+	}
+	return covered
+}
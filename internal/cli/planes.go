@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"jamtext/internal/chunk"
+	"jamtext/internal/index"
+	"jamtext/internal/simhash"
+)
+
+// defaultLearnSample is how many chunks learn-planes learns from without
+// -sample
+const defaultLearnSample = 5000
+
+// planesFile holds hyperplanes learned by learn-planes with the settings of
+// the vectors they were learned from, which every use must share. The width
+// is the number of hyperplanes.
+type planesFile struct {
+	Vectorizer  string      `json:"vectorizer"`
+	Normalizer  string      `json:"normalize"`
+	Language    string      `json:"lang"`
+	Method      string      `json:"method"`
+	Seed        int64       `json:"seed"`
+	Samples     int         `json:"samples"`
+	Digest      string      `json:"digest"`
+	Hyperplanes [][]float64 `json:"hyperplanes"`
+}
+
+// learnPlanes learns hyperplanes for model from a sample of the chunks of
+// path, or of its vectors with the vector vectorizer, and returns them with
+// the model, whose vector dimensions may be taken from the file, and the
+// sample
+func learnPlanes(path, idsPath string, model simhash.Model, opts chunk.ChunkOptions, method simhash.PlaneMethod, count int) ([][]float64, simhash.Model, [][]float64, error) {
+	if model.Algorithm != simhash.Hyperplane {
+		return nil, model, nil, fmt.Errorf("hyperplanes are learned for the hyperplane algorithm, not %s", model.Algorithm)
+	}
+	if count == 0 {
+		count = defaultLearnSample
+	}
+
+	var sample [][]float64
+	var err error
+	if model.Vectorizer.Name == "vector" {
+		sample, model, err = sampleVectorFile(path, idsPath, model, count)
+	} else if model.Vectorizer, err = model.Vectorizer.ForFile(path); err == nil {
+		opts.Vectorizer = model.Vectorizer
+		sample, err = chunk.SampleVectors(path, opts, count)
+	}
+	if err != nil {
+		return nil, model, nil, err
+	}
+
+	hyperplanes, err := simhash.LearnHyperplanes(sample, model.Bits, method, model.Seed)
+	if err != nil {
+		return nil, model, nil, err
+	}
+	return hyperplanes, model, sample, nil
+}
+
+// sampleVectorFile samples up to count vectors of a file index-vectors
+// reads. Without dimensions, the model takes those of the first vector.
+func sampleVectorFile(path, idsPath string, model simhash.Model, count int) ([][]float64, simhash.Model, error) {
+	dims := 0
+	if model.Vectorizer.Params["dims"] != "" {
+		dims = model.Vectorizer.Dimensions()
+	}
+
+	rng := rand.New(rand.NewSource(model.Seed))
+	var sample [][]float64
+	seen := 0
+	add := func(id string, vector []float64) error {
+		if dims == 0 {
+			dims = len(vector)
+		}
+		if len(vector) != dims {
+			return fmt.Errorf("record %s has %d dimensions, expected %d", id, len(vector), dims)
+		}
+		seen++
+		if len(sample) < count {
+			sample = append(sample, vector)
+		} else if i := rng.Intn(seen); i < count {
+			sample[i] = vector
+		}
+		return nil
+	}
+
+	var err error
+	if isRawVectorFile(path) {
+		if dims == 0 {
+			return nil, model, fmt.Errorf("raw float32 vectors need their dimensions, e.g. -vectorizer vector:dims=384")
+		}
+		err = readRawVectors(path, idsPath, dims, add)
+	} else {
+		err = readVectorLines(path, add)
+	}
+	if err != nil {
+		return nil, model, err
+	}
+	if len(sample) == 0 {
+		return nil, model, fmt.Errorf("%s has no vectors", path)
+	}
+	model.Vectorizer = simhash.VectorizerConfig{
+		Name:   "vector",
+		Params: map[string]string{"dims": strconv.Itoa(dims)},
+	}
+	return sample, model, nil
+}
+
+// savePlanes writes learned hyperplanes and the settings of model as JSON
+func savePlanes(path string, model simhash.Model, method simhash.PlaneMethod, samples int, hyperplanes [][]float64) error {
+	data, err := json.Marshal(planesFile{
+		Vectorizer:  model.Vectorizer.String(),
+		Normalizer:  model.Normalizer.String(),
+		Language:    string(model.Language),
+		Method:      string(method),
+		Seed:        model.Seed,
+		Samples:     samples,
+		Digest:      simhash.HyperplanesDigest(hyperplanes),
+		Hyperplanes: hyperplanes,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// loadPlanes reads hyperplanes saved by savePlanes
+func loadPlanes(path string) (planesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return planesFile{}, fmt.Errorf("failed to read hyperplanes: %w", err)
+	}
+	var p planesFile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return planesFile{}, fmt.Errorf("invalid hyperplanes %s: %w", path, err)
+	}
+	if len(p.Hyperplanes) == 0 {
+		return planesFile{}, fmt.Errorf("%s has no hyperplanes", path)
+	}
+	if p.Digest != "" && p.Digest != simhash.HyperplanesDigest(p.Hyperplanes) {
+		return planesFile{}, fmt.Errorf("hyperplanes in %s do not match their digest %s", path, p.Digest)
+	}
+	return p, nil
+}
+
+// apply gives model the learned hyperplanes with the vectorizer,
+// normalization, language and width they were learned with. Explicit flags
+// must agree with those, as with the settings of an index.
+func (p planesFile) apply(f fingerprintFlags, model simhash.Model) (simhash.Model, error) {
+	cfg, err := simhash.ParseVectorizerConfig(p.Vectorizer)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	if f.vectorizer != "" && !model.Vectorizer.Selects(cfg) {
+		return simhash.Model{}, fmt.Errorf("hyperplanes were learned with vectorizer %s, not %s", cfg, model.Vectorizer)
+	}
+	if err := f.checkCommand(cfg, "hyperplanes file "+f.planes); err != nil {
+		return simhash.Model{}, err
+	}
+	normalizer, err := simhash.ParseNormalizer(p.Normalizer)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	if f.normalize != "" && model.Normalizer != normalizer {
+		return simhash.Model{}, fmt.Errorf("hyperplanes were learned with normalization %s, not %s", normalizer, model.Normalizer)
+	}
+	language, err := simhash.ParseLanguage(p.Language)
+	if err != nil {
+		return simhash.Model{}, err
+	}
+	if f.language != "" && model.Language != language {
+		return simhash.Model{}, fmt.Errorf("hyperplanes were learned with language %s, not %s", language, model.Language)
+	}
+	if model.Algorithm != simhash.Hyperplane {
+		return simhash.Model{}, fmt.Errorf("learned hyperplanes need the hyperplane algorithm, not %s", model.Algorithm)
+	}
+	bits := len(p.Hyperplanes)
+	if f.bits != 0 && f.bits != bits {
+		return simhash.Model{}, fmt.Errorf("%d hyperplanes were learned, not %d", bits, f.bits)
+	}
+	if err := simhash.ValidateFingerprintBits(bits); err != nil {
+		return simhash.Model{}, err
+	}
+	if err := simhash.ValidateHyperplanes(p.Hyperplanes, cfg.Dimensions()); err != nil {
+		return simhash.Model{}, err
+	}
+
+	model.Vectorizer = cfg
+	model.Normalizer = normalizer
+	model.Language = language
+	model.Bits = bits
+	return model.WithHyperplanes(p.Hyperplanes), nil
+}
+
+// checkPlanes rejects -planes when the index was built with other
+// hyperplanes
+func (f fingerprintFlags) checkPlanes(idx *index.Index) error {
+	if f.planes == "" {
+		return nil
+	}
+	p, err := loadPlanes(f.planes)
+	if err != nil {
+		return err
+	}
+	digest := simhash.HyperplanesDigest(p.Hyperplanes)
+	if built := idx.Model().PlanesDigest; built != digest {
+		if built == "" {
+			built = "generated from its seed"
+		}
+		return fmt.Errorf("index was built with hyperplanes %s, not %s from %s", built, digest, f.planes)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"jamtext/internal/index"
+)
+
+// printStats writes index statistics as an aligned table or as JSON
+func printStats(w io.Writer, stats index.IndexStats, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "table", "":
+	default:
+		return fmt.Errorf("unknown stats format %q (table|json)", format)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "Index Statistics:")
+	fmt.Fprintf(tw, "Source file:\t%s\n", stats.SourceFile)
+	fmt.Fprintf(tw, "Chunk size:\t%d bytes\n", stats.ChunkSize)
+	fmt.Fprintf(tw, "Fingerprint:\t%d bits\n", stats.FingerprintBits)
+	fmt.Fprintf(tw, "Model:\t%s\n", stats.ModelID)
+	fmt.Fprintf(tw, "Created:\t%v\n", stats.CreationTime)
+	fmt.Fprintf(tw, "Chunks:\t%d\n", stats.TotalChunks)
+	if stats.TotalRecords > 0 {
+		fmt.Fprintf(tw, "Vector records:\t%d\n", stats.TotalRecords)
+	}
+	fmt.Fprintf(tw, "Unique hashes:\t%d\n", stats.UniqueHashes)
+	fmt.Fprintf(tw, "Total positions:\t%d\n", stats.TotalPositions)
+	fmt.Fprintf(tw, "Memory usage:\t%s (estimated, shards in memory)\n", formatBytes(stats.MemoryUsage))
+	fmt.Fprintf(tw, "On disk:\t%s\n", formatBytes(stats.DiskBytes))
+	fmt.Fprintf(tw, "LSH buckets:\t%d\n", stats.LSHBuckets)
+
+	fmt.Fprintf(tw, "\nShards: %d\n", stats.ShardCount)
+	fmt.Fprintln(tw, "ID\tHashes\tPositions\tOn disk\tIn memory")
+	for _, s := range stats.Shards {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%v\n", s.ShardID, s.UniqueHashes, s.Positions, formatBytes(s.DiskBytes), s.InMemory)
+	}
+
+	printHistogram(tw, "LSH bucket sizes (hashes per bucket)", stats.LSHBucketSizes)
+	printHistogram(tw, "Postings per hash", stats.PostingsPerHash)
+
+	if len(stats.MostDuplicated) > 0 {
+		fmt.Fprintln(tw, "\nMost duplicated hashes:")
+		fmt.Fprintln(tw, "Hash\tPositions")
+		for _, hc := range stats.MostDuplicated {
+			fmt.Fprintf(tw, "%s\t%d\n", hc.Hash, hc.Count)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func printHistogram(w io.Writer, title string, bins []index.HistogramBin) {
+	if len(bins) == 0 {
+		return
+	}
+
+	var max int64
+	for _, bin := range bins {
+		if bin.Count > max {
+			max = bin.Count
+		}
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, bin := range bins {
+		label := fmt.Sprintf("%d", bin.Min)
+		if bin.Max != bin.Min {
+			label = fmt.Sprintf("%d-%d", bin.Min, bin.Max)
+		}
+		bar := strings.Repeat("#", int(1+bin.Count*29/max))
+		if bin.Count == 0 {
+			bar = ""
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", label, bin.Count, bar)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"jamtext/internal/index"
+	"jamtext/internal/simhash"
+)
+
+// curveRows is roughly how many distances of the S-curve tune-lsh prints
+const curveRows = 12
+
+// tuneLSH prints how every LSH layout for bits-bit fingerprints performs at
+// threshold and recommends one for the target recall. With an index, every
+// layout is also measured on a sample of its hashes.
+func tuneLSH(w io.Writer, idx *index.Index, bits, threshold int, recall float64, sample int) error {
+	best, estimates, err := simhash.TuneLSH(bits, threshold, recall)
+	if err != nil {
+		return err
+	}
+
+	var measured map[int]index.LSHMeasurement
+	if idx != nil {
+		bands := make([]int, len(estimates))
+		for i, e := range estimates {
+			bands[i] = e.Bands
+		}
+		measurements, err := idx.MeasureLSH(threshold, sample, bands...)
+		if err != nil {
+			return err
+		}
+		measured = make(map[int]index.LSHMeasurement, len(measurements))
+		for _, m := range measurements {
+			measured[m.Bands] = m
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "LSH layouts for %d-bit fingerprints, threshold %d, target recall %.0f%%:\n", bits, threshold, 100*recall)
+	header := "Bands\tBand size\tRecall\tCandidates"
+	if measured != nil {
+		header += "\tMeasured recall\tCandidates/query"
+	}
+	fmt.Fprintln(tw, header)
+	for _, e := range estimates {
+		line := fmt.Sprintf("%d\t%d\t%.2f%%\t%.4f%%", e.Bands, e.BandSize, 100*e.Recall, 100*e.CandidateRate)
+		if m, ok := measured[e.Bands]; ok && m.Neighbors > 0 {
+			line += fmt.Sprintf("\t%.2f%% (%d/%d)\t%.1f", 100*m.Recall(), m.Found, m.Neighbors, m.Candidates)
+		} else if ok {
+			line += fmt.Sprintf("\tno neighbors\t%.1f", m.Candidates)
+		}
+		if idx != nil && e.Bands == idx.LSHTable.Bands() {
+			line += "\t(current)"
+		}
+		fmt.Fprintln(tw, line)
+	}
+	if m, ok := measured[best.Bands]; ok {
+		fmt.Fprintf(tw, "Measured on %d of the index's hashes\n", m.Queries)
+	}
+
+	fmt.Fprintf(tw, "\nS-curve of %d bands of %d bits:\n", best.Bands, best.BandSize)
+	fmt.Fprintln(tw, "Distance\tCandidate probability")
+	curve := simhash.LSHCurve(bits, best.Bands)
+	end := threshold
+	for end < bits && curve[end] >= 0.01 {
+		end++
+	}
+	step := max(1, end/curveRows)
+	for d := 0; d <= end; d++ {
+		if d%step == 0 || d == threshold || d == end {
+			fmt.Fprintf(tw, "%d\t%.2f%%\n", d, 100*curve[d])
+		}
+	}
+
+	if best.Recall < recall {
+		fmt.Fprintf(tw, "\nNo layout reaches %.0f%% recall at distance %d; the closest reaches %.2f%%\n",
+			100*recall, threshold, 100*best.Recall)
+	}
+	fmt.Fprintf(tw, "\nRecommended: -lsh-bands %d -band-size %d\n", best.Bands, best.BandSize)
+	return tw.Flush()
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"jamtext/internal/index"
+	"jamtext/internal/simhash"
+)
+
+// vectorRecord is one line of a JSON-lines vector file. The ID may be a
+// string or a number; records without one are numbered.
+type vectorRecord struct {
+	ID     json.RawMessage `json:"id"`
+	Vector []float64       `json:"vector"`
+}
+
+// isRawVectorFile reports whether index-vectors reads path as raw
+// little-endian float32 rather than JSON lines
+func isRawVectorFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".f32", ".bin":
+		return true
+	}
+	return false
+}
+
+// indexVectors builds an index of the vectors in path. The model must use
+// the vector vectorizer, so queries are vectors too; when it gives no
+// dimensions they are taken from the first vector.
+func indexVectors(path, idsPath string, model simhash.Model, indexDir string) (*index.Index, error) {
+	if model.Vectorizer.Name != "vector" {
+		return nil, fmt.Errorf("index-vectors stores vectors as given; use -vectorizer vector, not %s", model.Vectorizer)
+	}
+	if model.Algorithm != simhash.Hyperplane {
+		return nil, fmt.Errorf("vectors are projected through hyperplanes, not hashed with the %s algorithm", model.Algorithm)
+	}
+	dims := 0
+	if model.Vectorizer.Params["dims"] != "" {
+		dims = model.Vectorizer.Dimensions()
+	}
+
+	var idx *index.Index
+	add := func(id string, vector []float64) error {
+		if idx == nil {
+			if dims == 0 {
+				dims = len(vector)
+				model.Vectorizer = simhash.VectorizerConfig{
+					Name:   "vector",
+					Params: map[string]string{"dims": strconv.Itoa(dims)},
+				}
+			}
+			var err error
+			if idx, err = newModelIndex(path, model, indexDir); err != nil {
+				return err
+			}
+		}
+		_, err := idx.AddVector(id, vector)
+		return err
+	}
+
+	var err error
+	if isRawVectorFile(path) {
+		if dims == 0 {
+			return nil, fmt.Errorf("raw float32 vectors need their dimensions, e.g. -vectorizer vector:dims=384")
+		}
+		err = readRawVectors(path, idsPath, dims, add)
+	} else {
+		if idsPath != "" {
+			return nil, fmt.Errorf("JSON-lines vectors carry their own IDs; -ids is for raw float32 files")
+		}
+		err = readVectorLines(path, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return nil, fmt.Errorf("%s has no vectors", path)
+	}
+	return idx, nil
+}
+
+// newModelIndex creates an empty index whose fingerprints follow model
+func newModelIndex(source string, model simhash.Model, indexDir string) (*index.Index, error) {
+	idx := index.New(source, 0, model.Hyperplanes(), indexDir)
+	idx.Vectorizer = model.Vectorizer
+	idx.Normalizer = model.Normalizer
+	idx.Language = model.Language
+	idx.Algorithm = model.Algorithm
+	if err := idx.SetBits(model.Bits); err != nil {
+		return nil, err
+	}
+	if err := idx.SetSeed(model.Seed); err != nil {
+		return nil, err
+	}
+	if err := idx.SetLSHBands(model.LSHBands); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readVectorLines hands the records of a JSON-lines file to add
+func readVectorLines(path string, add func(id string, vector []float64) error) error {
+	n := 0
+	return readJSONLines(path, func(line int, data []byte) error {
+		var record vectorRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		id := strconv.Itoa(n)
+		if len(record.ID) > 0 && string(record.ID) != "null" {
+			if err := json.Unmarshal(record.ID, &id); err != nil {
+				id = string(record.ID) // a number
+			}
+		}
+		n++
+		return add(id, record.Vector)
+	})
+}
+
+// readRawVectors hands add the vectors of a file of little-endian float32
+// values, dims per vector. IDs are the lines of idsPath, or record numbers
+// without one.
+func readRawVectors(path, idsPath string, dims int, add func(id string, vector []float64) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var ids *bufio.Scanner
+	if idsPath != "" {
+		idsFile, err := os.Open(idsPath)
+		if err != nil {
+			return err
+		}
+		defer idsFile.Close()
+		ids = bufio.NewScanner(idsFile)
+	}
+
+	r := bufio.NewReader(f)
+	buf := make([]byte, 4*dims)
+	for n := 0; ; n++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("%s ends inside vector %d; are the vectors %d-dimensional?", path, n, dims)
+			}
+			return err
+		}
+
+		id := strconv.Itoa(n)
+		if ids != nil {
+			if !ids.Scan() {
+				if err := ids.Err(); err != nil {
+					return err
+				}
+				return fmt.Errorf("%s has fewer IDs than %s has vectors", idsPath, path)
+			}
+			id = ids.Text()
+		}
+
+		vector := make([]float64, dims)
+		for i := range vector {
+			vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+		}
+		if err := add(id, vector); err != nil {
+			return err
+		}
+	}
+
+	if ids != nil && ids.Scan() {
+		return fmt.Errorf("%s has more IDs than %s has vectors", idsPath, path)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package index
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	manifestName    = "MANIFEST.json"
+	manifestVersion = 1
+	metaEntry       = "index.idx"
+	shardDirEntry   = "shards/"
+)
+
+// Manifest describes the contents of an index backup archive
+type Manifest struct {
+	Version    int            `json:"version"`
+	IndexName  string         `json:"index_name"`
+	SourceFile string         `json:"source_file"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Files      []ManifestFile `json:"files"`
+}
+
+// ManifestFile records the size and checksum of one archived file
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup writes the index metadata and every blob it owns to w as a
+// gzip-compressed tar archive. The manifest with checksums is written last
+// so the archive can be produced in a single pass over the shards. Only the
+// blobs the metadata names are archived, so stale files left beside the
+// shards are not. Neither is the source file: the manifest records its path,
+// and a restored index needs the file there or under LoadOptions.SourceRoot.
+func Backup(indexFile string, w io.Writer) (*Manifest, error) {
+	meta, err := readMeta(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	meta.resolve(indexFile, LoadOptions{})
+	storage, err := OpenStorage(meta.IndexDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index storage: %w", err)
+	}
+
+	metaData, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	shards, side := meta.blobNames()
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := &Manifest{
+		Version:    manifestVersion,
+		IndexName:  filepath.Base(indexFile),
+		SourceFile: meta.SourceFile,
+		CreatedAt:  time.Now(),
+	}
+
+	addFile := func(name string, data []byte) error {
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+		return writeTarEntry(tw, name, data)
+	}
+
+	if err := addFile(metaEntry, metaData); err != nil {
+		return nil, err
+	}
+	for _, name := range shards {
+		data, err := storage.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := addFile(shardDirEntry+name, data); err != nil {
+			return nil, err
+		}
+	}
+	// Side blobs are only saved by indexes that use them
+	for _, name := range side {
+		data, err := storage.Get(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := addFile(shardDirEntry+name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarEntry(tw, manifestName, manifestData); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Restore unpacks a backup archive into dir, verifies every checksum and
+// points the stored IndexDir at dir so the index works at its new location. It
+// returns the path of the restored index file.
+func Restore(r io.Reader, dir string) (string, *Manifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	// Files are staged in a directory of their own until the manifest
+	// confirms them, so no staged name can clash with another
+	staging, err := os.MkdirTemp(dir, ".restore-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Mkdir(filepath.Join(staging, shardDirEntry), 0o755); err != nil {
+		return "", nil, err
+	}
+	staged := make(map[string]ManifestFile)
+
+	var manifest *Manifest
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if hdr.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return "", nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		target, err := stagingPath(staging, hdr.Name)
+		if err != nil {
+			return "", nil, err
+		}
+
+		file, err := os.Create(target)
+		if err != nil {
+			return "", nil, err
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(file, hash), tr)
+		file.Close()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		staged[hdr.Name] = ManifestFile{Name: hdr.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return "", nil, fmt.Errorf("archive has no manifest")
+	}
+	if manifest.Version > manifestVersion {
+		return "", nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	for _, want := range manifest.Files {
+		got, ok := staged[want.Name]
+		if !ok {
+			return "", nil, fmt.Errorf("archive is missing %s", want.Name)
+		}
+		if got != want {
+			return "", nil, fmt.Errorf("checksum mismatch for %s", want.Name)
+		}
+	}
+
+	indexName := filepath.Base(manifest.IndexName)
+	if indexName == "." || indexName == ".." || indexName == string(filepath.Separator) {
+		return "", nil, fmt.Errorf("invalid index name %q in manifest", manifest.IndexName)
+	}
+
+	// Move the verified files into place; anything unlisted is left in the
+	// staging directory and removed with it
+	indexFile := filepath.Join(dir, indexName)
+	for _, file := range manifest.Files {
+		final := indexFile
+		if file.Name != metaEntry {
+			final = filepath.Join(dir, strings.TrimPrefix(file.Name, shardDirEntry))
+			if final == indexFile {
+				return "", nil, fmt.Errorf("archive entry %q would replace the index file", file.Name)
+			}
+		}
+		from, _ := stagingPath(staging, file.Name)
+		if err := os.Rename(from, final); err != nil {
+			return "", nil, err
+		}
+	}
+
+	meta, err := readMeta(indexFile)
+	if err != nil {
+		return "", nil, err
+	}
+	if !meta.RelativePaths {
+		meta.relativize(indexFile)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	meta.IndexDir, meta.IndexDirAbs = portablePath(absDir, absDir)
+	if err := writeMeta(indexFile, meta); err != nil {
+		return "", nil, err
+	}
+
+	return indexFile, manifest, nil
+}
+
+// stagingPath maps an archive entry to its extraction path in the staging
+// directory, rejecting names that could escape it
+func stagingPath(staging, name string) (string, error) {
+	base := strings.TrimPrefix(name, shardDirEntry)
+	if name != metaEntry && (base == name || base != path.Base(base) || base == ".." || base == ".") {
+		return "", fmt.Errorf("unexpected archive entry %q", name)
+	}
+	return filepath.Join(staging, filepath.FromSlash(name)), nil
+}
+
+// blobNames returns the storage names of the blobs an index owns: its
+// shards, which it always has, and the side blobs it saves when it uses them
+func (m *indexMeta) blobNames() (shards, side []string) {
+	idx := &Index{ShardFilename: m.ShardFilename}
+	for i := 0; i < m.ShardCount; i++ {
+		shards = append(shards, idx.shardName(i))
+	}
+	side = []string{
+		idx.chunkRefsName(),
+		idx.minhashName(),
+		idx.passagesName(),
+		idx.recordsName(),
+		idx.vectorizerStateName(),
+	}
+	return shards, side
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
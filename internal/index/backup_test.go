@@ -0,0 +1,181 @@
+package index
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"jamtext/internal/simhash"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), filepath.Join(tmpDir, "shards"))
+	if err := idx.AddChunk(simhash.SimHash(0x1234).Fingerprint(), 0, 100); err != nil {
+		t.Fatalf("AddChunk failed: %v", err)
+	}
+
+	indexFile := filepath.Join(tmpDir, "book.idx")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A shard left over from an earlier, larger build is not part of the index
+	if err := idx.Storage.Put(idx.shardName(1), []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Backup(indexFile, &archive)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	// Metadata, one shard and the chunk positions
+	var names []string
+	for _, file := range manifest.Files {
+		names = append(names, file.Name)
+	}
+	want := []string{"index.idx", "shards/test.txt.shard.0", "shards/test.txt.shard.pos"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("archived %v, want %v", names, want)
+	}
+
+	restoreDir := filepath.Join(tmpDir, "restored")
+	restoredFile, _, err := Restore(bytes.NewReader(archive.Bytes()), restoreDir)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restoredFile != filepath.Join(restoreDir, "book.idx") {
+		t.Errorf("Restore() index file = %s", restoredFile)
+	}
+	entries, err := os.ReadDir(restoreDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".restore-") {
+			t.Errorf("Restore left its staging directory %s behind", entry.Name())
+		}
+	}
+
+	restored, err := Load(restoredFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if restored.IndexDir != restoreDir {
+		t.Errorf("Expected IndexDir %s, got %s", restoreDir, restored.IndexDir)
+	}
+	positions, err := restored.Lookup(0x1234)
+	if err != nil || len(positions) != 1 {
+		t.Errorf("Expected one position after restore, got %v (%v)", positions, err)
+	}
+	if _, err := restored.ChunkAt("test.txt", 50); err != nil {
+		t.Errorf("ChunkAt after restore failed: %v", err)
+	}
+}
+
+func TestRestoreRejectsCorruptArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), filepath.Join(tmpDir, "shards"))
+	idx.Add(0x1234, 0)
+	indexFile := filepath.Join(tmpDir, "book.idx")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := Backup(indexFile, &archive); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// Flip a byte in the shard while keeping the manifest intact
+	var tampered bytes.Buffer
+	gzr, _ := gzip.NewReader(&archive)
+	tr := tar.NewReader(gzr)
+	gzw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gzw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name == "shards/"+idx.ShardFilename+".0" {
+			data[len(data)-1] ^= 0xFF
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	gzw.Close()
+
+	if _, _, err := Restore(&tampered, filepath.Join(tmpDir, "restored")); err == nil {
+		t.Error("Expected checksum error for tampered archive")
+	}
+}
+
+func TestRestoreKeepsEntriesApart(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), filepath.Join(tmpDir, "shards"))
+	idx.Add(0x1234, 0)
+	indexFile := filepath.Join(tmpDir, "book.idx")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	var archive bytes.Buffer
+	if _, err := Backup(indexFile, &archive); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// Add a blob named like the metadata entry, listed in the manifest
+	var rebuilt bytes.Buffer
+	gzr, _ := gzip.NewReader(&archive)
+	tr := tar.NewReader(gzr)
+	gzw := gzip.NewWriter(&rebuilt)
+	tw := tar.NewWriter(gzw)
+	extra := []byte("not the metadata")
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name == manifestName {
+			var manifest Manifest
+			json.Unmarshal(data, &manifest)
+			sum := sha256.Sum256(extra)
+			manifest.Files = append(manifest.Files, ManifestFile{
+				Name:   shardDirEntry + metaEntry,
+				Size:   int64(len(extra)),
+				SHA256: hex.EncodeToString(sum[:]),
+			})
+			writeTarEntry(tw, shardDirEntry+metaEntry, extra)
+			data, _ = json.Marshal(manifest)
+		}
+		writeTarEntry(tw, hdr.Name, data)
+	}
+	tw.Close()
+	gzw.Close()
+
+	restoreDir := filepath.Join(tmpDir, "restored")
+	restoredFile, _, err := Restore(&rebuilt, restoreDir)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := Load(restoredFile); err != nil {
+		t.Errorf("Load failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(restoreDir, metaEntry))
+	if err != nil || !bytes.Equal(data, extra) {
+		t.Errorf("restored %s = %q (%v), want %q", metaEntry, data, err, extra)
+	}
+}
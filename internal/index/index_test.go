@@ -1,11 +1,18 @@
 package index
 
 import (
+	"bytes"
+	"encoding/gob"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
 func TestNew(t *testing.T) {
@@ -300,4 +307,628 @@ func TestSaveAndLoad(t *testing.T) {
 	if err != nil || len(positions2) != 1 || positions2[0] != pos2 {
 		t.Errorf("Expected postion %d for hash %x, got %v", pos2, hash2, positions2)
 	}
-}
\ No newline at end of file
+}
+
+func TestVectorizerPersists(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg, err := simhash.ParseVectorizerConfig("ngram:n=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	idx.Vectorizer = cfg
+	idx.VectorizerState = []byte("learned")
+	idx.Normalizer = simhash.Normalizer{NFKC: true, StripDiacritics: true}
+	idx.Language = simhash.English
+	idx.Algorithm = simhash.Charikar
+	if err := idx.Add(0x1234, 0); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !loadedIdx.Vectorizer.Equal(cfg) {
+		t.Errorf("Vectorizer = %v, want %v", loadedIdx.Vectorizer, cfg)
+	}
+	if string(loadedIdx.VectorizerState) != "learned" {
+		t.Errorf("VectorizerState = %q, want %q", loadedIdx.VectorizerState, "learned")
+	}
+	if loadedIdx.Normalizer != idx.Normalizer {
+		t.Errorf("Normalizer = %s, want %s", loadedIdx.Normalizer, idx.Normalizer)
+	}
+	if loadedIdx.Language != simhash.English {
+		t.Errorf("Language = %q, want %q", loadedIdx.Language, simhash.English)
+	}
+	if loadedIdx.Algorithm != simhash.Charikar {
+		t.Errorf("Algorithm = %q, want %q", loadedIdx.Algorithm, simhash.Charikar)
+	}
+}
+
+func TestMinHashPersists(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+
+	sig := minhash.Signature{1, 2, 3, 4}
+	if err := idx.AddMinHash(0, sig); err == nil {
+		t.Error("expected an error adding a signature to an index without MinHash")
+	}
+
+	cfg := minhash.Config{NumHashes: 4, ShingleSize: 2, Seed: 1, Bands: 4}
+	if err := idx.SetMinHash(cfg); err != nil {
+		t.Fatalf("SetMinHash failed: %v", err)
+	}
+	if err := idx.AddMinHash(0, sig); err != nil {
+		t.Fatalf("AddMinHash failed: %v", err)
+	}
+	if err := idx.AddMinHash(100, minhash.Signature{1, 2, 3, 9}); err != nil {
+		t.Fatalf("AddMinHash failed: %v", err)
+	}
+	if err := idx.AddMinHash(200, minhash.Signature{1, 2}); err == nil {
+		t.Error("expected an error for a signature of the wrong length")
+	}
+	if err := idx.SetMinHash(minhash.NewConfig(8, 2)); err == nil {
+		t.Error("expected an error changing MinHash settings of an index with signatures")
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loadedIdx.MinHash != cfg {
+		t.Errorf("MinHash = %+v, want %+v", loadedIdx.MinHash, cfg)
+	}
+	if got, ok := loadedIdx.MinHashAt(0); !ok || !reflect.DeepEqual(got, sig) {
+		t.Errorf("MinHashAt(0) = %v, %v, want %v", got, ok, sig)
+	}
+
+	matches, err := loadedIdx.JaccardLookup(sig, 0.5)
+	if err != nil {
+		t.Fatalf("JaccardLookup failed: %v", err)
+	}
+	want := []JaccardMatch{{Pos: 0, Jaccard: 1}, {Pos: 100, Jaccard: 0.75}}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("JaccardLookup = %v, want %v", matches, want)
+	}
+}
+
+func TestPassagesPersist(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+
+	fp := winnow.Fingerprint{Hash: 7, Pos: 0, Start: 0, End: 12}
+	if err := idx.AddPassageFingerprint(fp); err == nil {
+		t.Error("expected an error adding a fingerprint to an index without winnowing")
+	}
+	if _, err := idx.Passages([]winnow.Fingerprint{fp}); err == nil {
+		t.Error("expected an error matching passages in an index without winnowing")
+	}
+
+	cfg := winnow.Config{K: 8, Window: 4}
+	if err := idx.SetWinnow(cfg); err != nil {
+		t.Fatalf("SetWinnow failed: %v", err)
+	}
+	winnower, err := idx.NewWinnower()
+	if err != nil {
+		t.Fatalf("NewWinnower failed: %v", err)
+	}
+	source := "One passage of the source is copied word for word into the query."
+	for _, fp := range winnower.Fingerprints(source) {
+		if err := idx.AddPassageFingerprint(fp); err != nil {
+			t.Fatalf("AddPassageFingerprint failed: %v", err)
+		}
+	}
+	if err := idx.SetWinnow(winnow.DefaultConfig()); err == nil {
+		t.Error("expected an error changing winnowing settings of an index with fingerprints")
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loadedIdx.Winnow != cfg || loadedIdx.PassageFingerprints() != idx.PassageFingerprints() {
+		t.Errorf("loaded %+v with %d fingerprints, want %+v with %d",
+			loadedIdx.Winnow, loadedIdx.PassageFingerprints(), cfg, idx.PassageFingerprints())
+	}
+
+	query := winnower.Fingerprints("Notes: copied word for word into it")
+	passages, err := loadedIdx.Passages(query)
+	if err != nil {
+		t.Fatalf("Passages failed: %v", err)
+	}
+	if len(passages) != 1 || source[passages[0].SourceStart:passages[0].SourceEnd] == "" {
+		t.Fatalf("Passages = %+v, want the copied words", passages)
+	}
+	// Only the selected k-grams are known, so the passage may stop short of
+	// the copy's ends
+	if got := source[passages[0].SourceStart:passages[0].SourceEnd]; !strings.Contains(got, "word for word") {
+		t.Errorf("passage covers %q of the source", got)
+	}
+}
+
+func TestChunkAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 100, simhash.GenerateHyperplanes(128, 64), tmpDir)
+
+	// Chunks are added out of order, as the worker pool delivers them
+	refs := []ChunkRef{
+		{Hash: simhash.SimHash(0x3333).Fingerprint(), Start: 180, Length: 60},
+		{Hash: simhash.SimHash(0x1111).Fingerprint(), Start: 0, Length: 100},
+		{Hash: simhash.SimHash(0x2222).Fingerprint(), Start: 90, Length: 100},
+		{Hash: simhash.SimHash(0x4444).Fingerprint(), Start: 300, Length: 200},
+		{Hash: simhash.SimHash(0x5555).Fingerprint(), Start: 320, Length: 10},
+	}
+	for _, ref := range refs {
+		if err := idx.AddChunk(ref.Hash, ref.Start, ref.Length); err != nil {
+			t.Fatalf("AddChunk failed: %v", err)
+		}
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		doc      string
+		offset   int64
+		wantHash simhash.SimHash
+		wantErr  bool
+	}{
+		{name: "start of file", doc: "test.txt", offset: 0, wantHash: 0x1111},
+		{name: "overlap prefers later chunk", doc: "test.txt", offset: 95, wantHash: 0x2222},
+		{name: "last byte", doc: "test.txt", offset: 239, wantHash: 0x3333},
+		{name: "gap between chunks", doc: "test.txt", offset: 240, wantErr: true},
+		{name: "inside a short chunk", doc: "test.txt", offset: 325, wantHash: 0x5555},
+		{name: "longer earlier chunk", doc: "test.txt", offset: 400, wantHash: 0x4444},
+		{name: "past the end", doc: "test.txt", offset: 500, wantErr: true},
+		{name: "other document", doc: "other.txt", offset: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := loadedIdx.ChunkAt(tt.doc, tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ChunkAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ref.Hash != tt.wantHash.Fingerprint() {
+				t.Errorf("ChunkAt() hash = %s, want %x", ref.Hash, tt.wantHash)
+			}
+		})
+	}
+}
+
+func TestFuzzyLookupAfterLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err := idx.Add(0xFF00, 100); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	results, found := loadedIdx.FuzzyLookup(0xFF01, 1)
+	if !found || len(results[0xFF00]) != 1 {
+		t.Errorf("Expected loaded index to find 0xFF00, got %v", results)
+	}
+}
+
+func TestPortablePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	buildDir := filepath.Join(tmpDir, "build")
+	sourceFile := filepath.Join(buildDir, "data", "book.txt")
+	if err := os.MkdirAll(filepath.Dir(sourceFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourceFile, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := New(sourceFile, 4096, simhash.GenerateHyperplanes(128, 64), filepath.Join(buildDir, "indexes", "shards"))
+	if err := idx.Add(0x1234, 0); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	indexFile := filepath.Join(buildDir, "indexes", "book.idx")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Move the whole tree, as when mounting it elsewhere
+	movedDir := filepath.Join(tmpDir, "mounted")
+	if err := os.Rename(buildDir, movedDir); err != nil {
+		t.Fatal(err)
+	}
+	movedIndex := filepath.Join(movedDir, "indexes", "book.idx")
+
+	loaded, err := Load(movedIndex)
+	if err != nil {
+		t.Fatalf("Load after move failed: %v", err)
+	}
+	if want := filepath.Join(movedDir, "data", "book.txt"); loaded.SourceFile != want {
+		t.Errorf("Expected source file %s, got %s", want, loaded.SourceFile)
+	}
+	if positions, _ := loaded.Lookup(0x1234); len(positions) != 1 {
+		t.Errorf("Expected shard to load from moved directory, got %v", positions)
+	}
+
+	// Explicit overrides win over the stored paths
+	overridden, err := LoadWithOptions(movedIndex, LoadOptions{
+		SourceRoot: "/srv/texts",
+		IndexDir:   filepath.Join(movedDir, "indexes", "shards"),
+	})
+	if err != nil {
+		t.Fatalf("Load with overrides failed: %v", err)
+	}
+	if overridden.SourceFile != filepath.Join("/srv/texts", "book.txt") {
+		t.Errorf("Expected overridden source file, got %s", overridden.SourceFile)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+
+	// 0x1234 occurs three times, 0x5678 twice, 0x9abc once
+	for i, hash := range []simhash.SimHash{0x1234, 0x5678, 0x1234, 0x9abc, 0x1234, 0x5678} {
+		if err := idx.AddChunk(hash.Fingerprint(), int64(i*100), 100); err != nil {
+			t.Fatalf("AddChunk failed: %v", err)
+		}
+	}
+	if err := Save(idx, filepath.Join(tmpDir, "index.gob")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Drop the shards from memory so they are read back from storage
+	if err := idx.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if stats.UniqueHashes != 3 || stats.TotalPositions != 6 || stats.TotalChunks != 6 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if len(stats.Shards) != 1 || stats.Shards[0].InMemory || stats.Shards[0].DiskBytes == 0 {
+		t.Errorf("Expected one on-disk shard, got %+v", stats.Shards)
+	}
+	if stats.MemoryUsage != 0 {
+		t.Errorf("Expected no memory usage with all shards on disk, got %d", stats.MemoryUsage)
+	}
+	if stats.LSHBuckets == 0 {
+		t.Error("Expected LSH buckets to be counted")
+	}
+
+	wantPostings := []HistogramBin{{Min: 1, Max: 1, Count: 1}, {Min: 2, Max: 3, Count: 2}}
+	if len(stats.PostingsPerHash) != len(wantPostings) {
+		t.Fatalf("PostingsPerHash = %v, want %v", stats.PostingsPerHash, wantPostings)
+	}
+	for i, bin := range wantPostings {
+		if stats.PostingsPerHash[i] != bin {
+			t.Errorf("PostingsPerHash[%d] = %v, want %v", i, stats.PostingsPerHash[i], bin)
+		}
+	}
+
+	if len(stats.MostDuplicated) != 2 || stats.MostDuplicated[0] != (HashCount{Hash: simhash.SimHash(0x1234).Fingerprint(), Count: 3}) {
+		t.Errorf("MostDuplicated = %v", stats.MostDuplicated)
+	}
+}
+
+func TestWideFingerprints(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 128), tmpDir)
+	if err := idx.SetBits(128); err != nil {
+		t.Fatalf("SetBits failed: %v", err)
+	}
+
+	hash, _ := simhash.ParseFingerprint("0123456789abcdeffedcba9876543210", 128)
+	if err := idx.AddChunk(hash, 0, 100); err != nil {
+		t.Fatalf("AddChunk failed: %v", err)
+	}
+	if err := idx.Add(0x1234, 100); err == nil {
+		t.Error("expected width mismatch error when adding a 64-bit hash")
+	}
+	if err := idx.SetBits(256); err == nil {
+		t.Error("expected error when changing the width of a non-empty index")
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loadedIdx.Bits != 128 {
+		t.Errorf("Bits = %d, want 128", loadedIdx.Bits)
+	}
+
+	positions, err := loadedIdx.LookupFingerprint(hash)
+	if err != nil || len(positions) != 1 || positions[0] != 0 {
+		t.Errorf("LookupFingerprint() = %v, %v, want [0]", positions, err)
+	}
+
+	// Flipping two bits in the upper half still finds the chunk
+	near := hash
+	near.SetBit(100)
+	near.SetBit(127)
+	matches, found := loadedIdx.FuzzyLookupFingerprint(near, 3)
+	if !found || len(matches[hash]) != 1 {
+		t.Errorf("FuzzyLookupFingerprint() = %v, %v", matches, found)
+	}
+
+	ref, err := loadedIdx.ChunkAt("test.txt", 50)
+	if err != nil || ref.Hash != hash {
+		t.Errorf("ChunkAt() = %+v, %v, want hash %s", ref, err, hash)
+	}
+}
+
+func TestLoadLegacyShard(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err := idx.Add(0x1234, 100); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Overwrite the shard with the encoding used before fingerprints had a width
+	var buf bytes.Buffer
+	legacy := map[simhash.SimHash][]int64{0x1234: {100}, 0x5678: {200}}
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Storage.Put(idx.shardName(0), buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	positions, err := loadedIdx.Lookup(0x5678)
+	if err != nil || len(positions) != 1 || positions[0] != 200 {
+		t.Errorf("Lookup() = %v, %v, want [200]", positions, err)
+	}
+}
+
+func TestModelPersistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, nil, tmpDir)
+	if err := idx.SetSeed(7); err != nil {
+		t.Fatalf("SetSeed failed: %v", err)
+	}
+	idx.Hyperplanes = idx.Model().Hyperplanes()
+	if err := idx.Add(0x1234, 100); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := idx.SetSeed(8); err == nil {
+		t.Error("expected error when changing the seed of a non-empty index")
+	}
+	model := idx.Model()
+	if model.PlanesDigest != "" {
+		t.Errorf("seeded hyperplanes got digest %s", model.PlanesDigest)
+	}
+
+	// Seeded hyperplanes are not stored, only the model that regenerates them
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	meta, err := readMeta(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Hyperplanes != nil || meta.ModelID != model.ID() || meta.Seed != 7 {
+		t.Errorf("meta stores %d hyperplanes, model %s, seed %d", len(meta.Hyperplanes), meta.ModelID, meta.Seed)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loadedIdx.Hyperplanes, idx.Hyperplanes) || loadedIdx.Model().ID() != model.ID() {
+		t.Error("loaded index does not reproduce the model")
+	}
+
+	// A model ID that the settings do not reproduce is rejected
+	meta.ModelID = "00000000"
+	if err := writeMeta(indexFile, meta); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(indexFile); err == nil {
+		t.Error("expected error for an irreproducible model")
+	}
+}
+
+func TestModelCustomHyperplanes(t *testing.T) {
+	tmpDir := t.TempDir()
+	custom := simhash.GenerateHyperplanesWithSeed(128, 64, 99)
+	idx := New("test.txt", 4096, custom, tmpDir)
+	model := idx.Model()
+	if model.PlanesDigest == "" {
+		t.Fatal("custom hyperplanes got no digest")
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loadedIdx.Hyperplanes, custom) || loadedIdx.Model().ID() != model.ID() {
+		t.Error("custom hyperplanes were not kept")
+	}
+}
+
+func TestMeasureLSH(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+
+	// Pairs of hashes two bits apart, far from the other pairs
+	for i := int64(0); i < 20; i++ {
+		base := simhash.SimHash(uint64(i) * 0x9e3779b97f4a7c15)
+		if err := idx.Add(base, i*200); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Add(base^0x11, i*200+100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	measurements, err := idx.MeasureLSH(2, 10, 1, 64)
+	if err != nil {
+		t.Fatalf("MeasureLSH failed: %v", err)
+	}
+	single, bitwise := measurements[0], measurements[1]
+	if single.Queries != 10 || single.Neighbors != 10 {
+		t.Errorf("measured %d queries with %d neighbors, want 10 and 10", single.Queries, single.Neighbors)
+	}
+	// One 64-bit band only matches identical hashes
+	if single.Found != 0 || single.Candidates != 0 {
+		t.Errorf("1 band: %+v, want no candidates", single)
+	}
+	// One band per bit makes nearly every hash a candidate
+	if bitwise.Recall() != 1 || bitwise.Candidates < 30 {
+		t.Errorf("64 bands: %+v, want full recall and most hashes as candidates", bitwise)
+	}
+
+	if _, err := idx.MeasureLSH(2, 10, 3); err == nil {
+		t.Error("expected error for bands that do not divide the width")
+	}
+}
+
+func TestLSHBandsPersistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	idx := New("test.txt", 4096, simhash.GenerateHyperplanes(128, 64), tmpDir)
+	if err := idx.SetLSHBands(8); err != nil {
+		t.Fatalf("SetLSHBands failed: %v", err)
+	}
+	if err := idx.SetLSHBands(5); err == nil {
+		t.Error("expected error for bands that do not divide the width")
+	}
+	if err := idx.Add(0x1234, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.SetLSHBands(4); err == nil {
+		t.Error("expected error when changing the bands of a non-empty index")
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.gob")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loadedIdx, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loadedIdx.LSHTable.Bands() != 8 || loadedIdx.Model().ID() != idx.Model().ID() {
+		t.Errorf("loaded index has %d bands and model %s", loadedIdx.LSHTable.Bands(), loadedIdx.Model().ID())
+	}
+	matches, found := loadedIdx.FuzzyLookup(0x1235, 1)
+	if !found || len(matches[0x1234]) != 1 {
+		t.Errorf("FuzzyLookup() = %v, %v", matches, found)
+	}
+}
+
+func TestAddVector(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg, err := simhash.ParseVectorizerConfig("vector:dims=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := New("vectors.jsonl", 0, simhash.GenerateHyperplanesWithSeed(8, 64, simhash.DefaultSeed), tmpDir)
+	idx.Vectorizer = cfg
+
+	vectors := map[string][]float64{
+		"north": {1, 0.5, 0, 0, 0, 0, 0, 0.1},
+		"south": {-1, -0.5, 0, 0, 0, 0, 0, -0.1},
+	}
+	hashes := make(map[string]simhash.Fingerprint)
+	for _, id := range []string{"north", "south"} {
+		hash, err := idx.AddVector(id, vectors[id])
+		if err != nil {
+			t.Fatalf("AddVector(%s) failed: %v", id, err)
+		}
+		hashes[id] = hash
+	}
+	if _, err := idx.AddVector("short", []float64{1, 2, 3}); err == nil {
+		t.Error("expected an error for a vector of other dimensions")
+	}
+	if _, err := idx.AddVector("nan", []float64{1, math.NaN(), 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("expected an error for a vector with NaN")
+	}
+	chunked := New("test.txt", 4096, idx.Hyperplanes, tmpDir)
+	if err := chunked.AddChunk(hashes["north"], 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunked.AddVector("mixed", vectors["north"]); err == nil {
+		t.Error("expected an error adding a vector to an index of chunks")
+	}
+
+	// A vector's fingerprint is the one its text form gets from the model
+	vectorizer, err := idx.NewVectorizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := simhash.CalculateFingerprint(simhash.Hyperplane, 64, "[1, 0.5, 0, 0, 0, 0, 0, 0.1]", idx.Hyperplanes, vectorizer)
+	if hashes["north"] != want {
+		t.Errorf("AddVector fingerprint %s, text fingerprint %s", hashes["north"], want)
+	}
+
+	indexFile := filepath.Join(tmpDir, "vectors.idx")
+	if err := Save(idx, indexFile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(indexFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Records() != 2 {
+		t.Fatalf("loaded %d records, want 2", loaded.Records())
+	}
+	matches, found := loaded.FuzzyLookupFingerprint(want, 0)
+	if !found {
+		t.Fatal("expected the vector to be found")
+	}
+	for _, pos := range matches[want] {
+		if id, ok := loaded.RecordID(pos); !ok || id != "north" {
+			t.Errorf("RecordID(%d) = %q, %v; want north", pos, id, ok)
+		}
+	}
+	if _, ok := loaded.RecordID(2); ok {
+		t.Error("expected no record past the last one")
+	}
+}
@@ -0,0 +1,158 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"jamtext/internal/minhash"
+)
+
+// JaccardMatch is a chunk whose MinHash signature resembles a query
+type JaccardMatch struct {
+	Pos     int64
+	Jaccard float64 // Estimated Jaccard similarity of the shingle sets
+}
+
+// SetMinHash enables MinHash signatures for an index without any
+func (idx *Index) SetMinHash(cfg minhash.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if len(idx.minhashes) > 0 {
+		return fmt.Errorf("cannot change the MinHash settings of an index with signatures")
+	}
+	idx.MinHash = cfg
+	idx.minhashes = make(map[int64]minhash.Signature)
+	idx.minhashLSH = nil
+	return nil
+}
+
+// AddMinHash records the MinHash signature of the chunk at pos
+func (idx *Index) AddMinHash(pos int64, sig minhash.Signature) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.MinHash.Enabled() {
+		return fmt.Errorf("index does not store MinHash signatures")
+	}
+	if len(sig) != idx.MinHash.NumHashes {
+		return fmt.Errorf("signature has %d hashes, index uses %d", len(sig), idx.MinHash.NumHashes)
+	}
+
+	if idx.minhashes == nil {
+		idx.minhashes = make(map[int64]minhash.Signature)
+	}
+	idx.minhashes[pos] = sig
+	if idx.minhashLSH != nil {
+		idx.minhashLSH.Add(pos, sig)
+	}
+	return nil
+}
+
+// MinHashAt returns the signature of the chunk at pos
+func (idx *Index) MinHashAt(pos int64) (minhash.Signature, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	sig, ok := idx.minhashes[pos]
+	return sig, ok
+}
+
+// JaccardLookup returns the chunks whose estimated Jaccard similarity to sig
+// is at least minJaccard, most similar first. Candidates come from MinHash
+// LSH banding, so pairs well below the banding threshold may be missed.
+func (idx *Index) JaccardLookup(sig minhash.Signature, minJaccard float64) ([]JaccardMatch, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.MinHash.Enabled() {
+		return nil, fmt.Errorf("index does not store MinHash signatures")
+	}
+	if len(sig) != idx.MinHash.NumHashes {
+		return nil, fmt.Errorf("signature has %d hashes, index uses %d", len(sig), idx.MinHash.NumHashes)
+	}
+
+	if idx.minhashLSH == nil {
+		idx.minhashLSH = minhash.NewLSH(idx.MinHash)
+		for pos, s := range idx.minhashes {
+			idx.minhashLSH.Add(pos, s)
+		}
+	}
+
+	var matches []JaccardMatch
+	for _, pos := range idx.minhashLSH.Candidates(sig) {
+		if j := minhash.Jaccard(sig, idx.minhashes[pos]); j >= minJaccard {
+			matches = append(matches, JaccardMatch{Pos: pos, Jaccard: j})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Jaccard != matches[j].Jaccard {
+			return matches[i].Jaccard > matches[j].Jaccard
+		}
+		return matches[i].Pos < matches[j].Pos
+	})
+	return matches, nil
+}
+
+// NewMinHasher builds the hasher that produced the index signatures
+func (idx *Index) NewMinHasher() (*minhash.Hasher, error) {
+	if !idx.MinHash.Enabled() {
+		return nil, fmt.Errorf("index does not store MinHash signatures")
+	}
+	return minhash.NewHasher(idx.MinHash)
+}
+
+// minhashName is the side blob holding the MinHash signatures
+func (idx *Index) minhashName() string {
+	return idx.ShardFilename + ".mh"
+}
+
+// saveMinHashes writes the signatures of an index that stores them
+func (idx *Index) saveMinHashes() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.MinHash.Enabled() {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx.minhashes); err != nil {
+		return err
+	}
+	return idx.Storage.Put(idx.minhashName(), buf.Bytes())
+}
+
+// loadMinHashes reads the signatures of an index that stores them
+func (idx *Index) loadMinHashes() error {
+	if !idx.MinHash.Enabled() {
+		return nil
+	}
+
+	data, err := idx.Storage.Get(idx.minhashName())
+	if errors.Is(err, fs.ErrNotExist) {
+		idx.minhashes = make(map[int64]minhash.Signature)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sigs map[int64]minhash.Signature
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&sigs); err != nil {
+		return err
+	}
+	if sigs == nil {
+		sigs = make(map[int64]minhash.Signature)
+	}
+	idx.minhashes = sigs
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"jamtext/internal/simhash"
@@ -16,46 +17,265 @@ import (
 const (
 	MaxShardSize    = 100000
 	ShardTimeoutMin = 30
+
+	// LSHBandBits is the number of fingerprint bits per LSH band, so wider
+	// fingerprints get more bands rather than stricter ones
+	LSHBandBits = simhash.LSHBandBits
 )
 
+// newLSHTable creates the LSH permutation table for a fingerprint width;
+// zero bands selects one band per LSHBandBits bits
+func newLSHTable(bits, bands int, seed int64) *simhash.PermutationTable {
+	if bands == 0 {
+		bands = bits / LSHBandBits
+	}
+	return simhash.NewPermutationTableWithSeed(bits, bands, seed)
+}
+
 // New creates a new Index
 func New(sourceFile string, chunkSize int, hyperplanes [][]float64, indexDir string) *Index {
 	if indexDir == "" {
 		indexDir = filepath.Join(os.TempDir(), "textindex")
 	}
 
-	os.MkdirAll(indexDir, 0o755)
+	storage, err := OpenStorage(indexDir)
+	if err != nil {
+		storage = errStorage{fmt.Errorf("failed to open index storage %s: %w", indexDir, err)}
+	}
 
 	return &Index{
 		SourceFile:    sourceFile,
 		ChunkSize:     chunkSize,
 		Hyperplanes:   hyperplanes,
+		Vectorizer:    simhash.DefaultVectorizerConfig(),
+		Language:      simhash.NoLanguage,
+		Algorithm:     simhash.DefaultAlgorithm,
+		Bits:          simhash.DefaultFingerprintBits,
+		Seed:          simhash.DefaultSeed,
 		CreationTime:  time.Now(),
-		LSHTable:      simhash.NewPermutationTable(simhash.NumHyperplanes, 4),
+		LSHTable:      newLSHTable(simhash.DefaultFingerprintBits, 0, simhash.DefaultSeed),
 		IndexDir:      indexDir,
+		Storage:       storage,
 		ShardFilename: filepath.Base(sourceFile) + ".shard",
 		Shards: []*IndexShard{{
-			SimHashToPos: make(map[simhash.SimHash][]int64),
+			SimHashToPos: make(map[simhash.Fingerprint][]int64),
 			ShardID:      0,
 			LastAccess:   time.Now(),
 		}},
-		shardMap:     make(map[simhash.SimHash]int),
+		shardMap:     make(map[simhash.Fingerprint]int),
 		cachedShards: make(map[int]*IndexShard),
 		cacheSize:    5, // Cache up to 5 shards in memory
 	}
 }
 
-// Add adds a SimHash and position to the index with LSH support
+// SetBits changes the fingerprint width of an empty index
+func (idx *Index) SetBits(bits int) error {
+	if err := simhash.ValidateFingerprintBits(bits); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, shard := range idx.Shards {
+		if shard != nil && len(shard.SimHashToPos) > 0 {
+			return fmt.Errorf("cannot change the fingerprint width of a non-empty index")
+		}
+	}
+	idx.Bits = bits
+	idx.LSHTable = newLSHTable(bits, 0, idx.Seed)
+	return nil
+}
+
+// SetLSHBands changes the number of LSH bands of an empty index. Each band
+// reads Bits/bands bits, so bands must divide the fingerprint width.
+func (idx *Index) SetLSHBands(bands int) error {
+	if err := simhash.ValidateLSHBands(idx.Bits, bands); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, shard := range idx.Shards {
+		if shard != nil && len(shard.SimHashToPos) > 0 {
+			return fmt.Errorf("cannot change the LSH bands of a non-empty index")
+		}
+	}
+	idx.LSHTable = newLSHTable(idx.Bits, bands, idx.Seed)
+	return nil
+}
+
+// SetSeed changes the seed of the LSH permutations of an empty index. The
+// hyperplanes passed to New must come from the same seed for the index model
+// to be reproducible.
+func (idx *Index) SetSeed(seed int64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, shard := range idx.Shards {
+		if shard != nil && len(shard.SimHashToPos) > 0 {
+			return fmt.Errorf("cannot change the seed of a non-empty index")
+		}
+	}
+	idx.Seed = seed
+	idx.LSHTable = newLSHTable(idx.Bits, idx.LSHTable.Bands(), seed)
+	return nil
+}
+
+// Model returns the fingerprint model of the index. Hyperplanes that were
+// not generated from the seed are identified by their digest.
+func (idx *Index) Model() simhash.Model {
+	model := simhash.Model{
+		Vectorizer: idx.Vectorizer,
+		Normalizer: idx.Normalizer,
+		Language:   idx.Language,
+		Algorithm:  idx.Algorithm,
+		Bits:       idx.Bits,
+		Seed:       idx.Seed,
+		LSHBands:   idx.Bits / LSHBandBits,
+	}
+	if idx.LSHTable != nil {
+		model.LSHBands = idx.LSHTable.Bands()
+	}
+	if !idx.seededHyperplanes(model) {
+		model = model.WithHyperplanes(idx.Hyperplanes)
+	}
+	return model
+}
+
+// seededHyperplanes reports whether the hyperplanes of the index are the
+// ones its model generates, so they need not be stored. Charikar indexes
+// have no hyperplanes that matter.
+func (idx *Index) seededHyperplanes(model simhash.Model) bool {
+	if model.Algorithm == simhash.Charikar || len(idx.Hyperplanes) == 0 {
+		return true
+	}
+	generated := model.Hyperplanes()
+	if len(generated) != len(idx.Hyperplanes) {
+		return false
+	}
+	for i, plane := range generated {
+		if len(plane) != len(idx.Hyperplanes[i]) {
+			return false
+		}
+		for j, v := range plane {
+			if idx.Hyperplanes[i][j] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkWidth rejects fingerprints whose width differs from the index
+func (idx *Index) checkWidth(hash simhash.Fingerprint) error {
+	if hash.Bits() != idx.Bits {
+		return fmt.Errorf("index uses %d-bit fingerprints, got %d bits", idx.Bits, hash.Bits())
+	}
+	return nil
+}
+
+// Add adds a 64-bit SimHash and position to the index with LSH support
 func (idx *Index) Add(hash simhash.SimHash, pos int64) error {
+	return idx.AddFingerprint(hash.Fingerprint(), pos)
+}
+
+// AddFingerprint adds a fingerprint and position to the index with LSH support
+func (idx *Index) AddFingerprint(hash simhash.Fingerprint, pos int64) error {
+	if err := idx.checkWidth(hash); err != nil {
+		return err
+	}
+
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
 	// Add to regular index
 	shard := idx.Shards[idx.ActiveShard]
 	shard.SimHashToPos[hash] = append(shard.SimHashToPos[hash], pos)
+	idx.activeDirty = true
 
 	// Add to LSH buckets
-	signatures := idx.LSHTable.GetBandSignatures(hash)
+	idx.addToBuckets(shard, hash)
+
+	if len(shard.SimHashToPos) >= MaxShardSize {
+		if err := idx.rotateShard(); err != nil {
+			return fmt.Errorf("failed to rotate shard: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddChunk adds a chunk's fingerprint and records its byte range in the
+// position-ordered side index used by ChunkAt
+func (idx *Index) AddChunk(hash simhash.Fingerprint, pos int64, length int) error {
+	if err := idx.AddFingerprint(hash, pos); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	idx.chunks = append(idx.chunks, ChunkRef{Hash: hash, Start: pos, Length: length})
+	idx.chunksSorted = false
+	idx.mu.Unlock()
+	return nil
+}
+
+// ChunkAt returns the chunk of doc that covers the given byte offset. When
+// chunks overlap, the one starting closest to the offset wins.
+func (idx *Index) ChunkAt(doc string, offset int64) (ChunkRef, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if doc != "" && !sameFile(doc, idx.SourceFile) {
+		return ChunkRef{}, fmt.Errorf("document %s is not covered by this index", doc)
+	}
+	if len(idx.chunks) == 0 {
+		return ChunkRef{}, fmt.Errorf("index has no chunk positions; rebuild it to enable offset lookups")
+	}
+
+	idx.sortChunks()
+
+	// Walk back from the last chunk starting at or before the offset. A
+	// longer chunk starting earlier may still cover it, so stop only once no
+	// chunk up to here reaches past the offset.
+	i := sort.Search(len(idx.chunks), func(i int) bool {
+		return idx.chunks[i].Start > offset
+	}) - 1
+	for ; i >= 0 && idx.chunkReach[i] > offset; i-- {
+		if idx.chunks[i].Contains(offset) {
+			return idx.chunks[i], nil
+		}
+	}
+
+	return ChunkRef{}, fmt.Errorf("offset %d is not covered by any chunk", offset)
+}
+
+// sortChunks orders the side index by start offset and records how far the
+// chunks reach; callers hold idx.mu
+func (idx *Index) sortChunks() {
+	if !idx.chunksSorted {
+		sort.Slice(idx.chunks, func(i, j int) bool {
+			return idx.chunks[i].Start < idx.chunks[j].Start
+		})
+		idx.chunksSorted = true
+		idx.chunkReach = nil
+	}
+	if len(idx.chunkReach) == len(idx.chunks) {
+		return
+	}
+
+	idx.chunkReach = make([]int64, len(idx.chunks))
+	var reach int64
+	for i, c := range idx.chunks {
+		reach = max(reach, c.Start+int64(c.Length))
+		idx.chunkReach[i] = reach
+	}
+}
+
+// addToBuckets registers a hash in the shard's LSH buckets
+func (idx *Index) addToBuckets(shard *IndexShard, hash simhash.Fingerprint) {
+	signatures := idx.LSHTable.BandSignatures(hash)
 	for i, sig := range signatures {
 		bucketKey := fmt.Sprintf("%d:%d", i, sig)
 		if shard.LSHBuckets == nil {
@@ -63,58 +283,49 @@ func (idx *Index) Add(hash simhash.SimHash, pos int64) error {
 		}
 		if shard.LSHBuckets[bucketKey] == nil {
 			shard.LSHBuckets[bucketKey] = &LSHBucket{
-				hashes: make(map[simhash.SimHash]struct{}),
+				hashes: make(map[simhash.Fingerprint]struct{}),
 			}
 		}
 		shard.LSHBuckets[bucketKey].hashes[hash] = struct{}{}
 	}
+}
 
-	if len(shard.SimHashToPos) >= MaxShardSize {
-		if err := idx.rotateShard(); err != nil {
-			return fmt.Errorf("failed to rotate shard: %w", err)
-		}
-	}
-
-	return nil
+// shardName returns the storage name of a shard
+func (idx *Index) shardName(shardID int) string {
+	return fmt.Sprintf("%s.%d", idx.ShardFilename, shardID)
 }
 
-// saveShard persists a shard to disk
+// saveShard persists a shard to storage
 func (idx *Index) saveShard(shard *IndexShard) error {
-	filename := filepath.Join(idx.IndexDir, idx.ShardFilename+"."+string(rune('0'+shard.ShardID)))
-	file, err := os.Create(filename)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(shard.SimHashToPos); err != nil {
 		return err
 	}
-	defer file.Close()
-
-	return gob.NewEncoder(file).Encode(shard.SimHashToPos)
+	return idx.Storage.Put(idx.shardName(shard.ShardID), buf.Bytes())
 }
 
-// loadShard loads a shard from disk
+// loadShard loads a shard from storage
 func (idx *Index) loadShard(shardID int) (*IndexShard, error) {
-	filename := filepath.Join(idx.IndexDir, idx.ShardFilename+"."+string(rune('0'+shardID)))
-	file, err := os.Open(filename)
+	data, err := idx.Storage.Get(idx.shardName(shardID))
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	var simHashToPos map[simhash.SimHash][]int64
-	if err := gob.NewDecoder(file).Decode(&simHashToPos); err != nil {
-		return nil, err
-	}
-
-	return &IndexShard{
-		SimHashToPos: simHashToPos,
-		ShardID:      shardID,
-	}, nil
+	return idx.decodeShard(shardID, data)
 }
 
-// loadShardMMap loads a shard from disk using memory-mapped I/O
+// loadShardMMap loads a shard using memory-mapped I/O when the storage has
+// a local file for it, and falls back to a regular read otherwise
 func (idx *Index) loadShardMMap(shardID int) (*IndexShard, error) {
-	filename := filepath.Join(idx.IndexDir, fmt.Sprintf("%s.%d", idx.ShardFilename, shardID))
+	local, ok := idx.Storage.(interface{ Path(name string) string })
+	if !ok {
+		return idx.loadShard(shardID)
+	}
+	path := local.Path(idx.shardName(shardID))
+	if path == "" {
+		return idx.loadShard(shardID)
+	}
 
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	file, err := os.OpenFile(path, os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
@@ -124,13 +335,38 @@ func (idx *Index) loadShardMMap(shardID int) (*IndexShard, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer mmapData.Unmap()
 
-	var shard IndexShard
-	if err := gob.NewDecoder(bytes.NewReader(mmapData)).Decode(&shard); err != nil {
-		return nil, err
+	return idx.decodeShard(shardID, mmapData)
+}
+
+// decodeShard rebuilds a shard from its encoded form
+func (idx *Index) decodeShard(shardID int, data []byte) (*IndexShard, error) {
+	var simHashToPos map[simhash.Fingerprint][]int64
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&simHashToPos); err != nil {
+		// Shards written before fingerprints had a width hold 64-bit SimHashes
+		var legacy map[simhash.SimHash][]int64
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy) != nil {
+			return nil, err
+		}
+		simHashToPos = make(map[simhash.Fingerprint][]int64, len(legacy))
+		for hash, positions := range legacy {
+			simHashToPos[hash.Fingerprint()] = positions
+		}
+	}
+
+	shard := &IndexShard{
+		SimHashToPos: simHashToPos,
+		ShardID:      shardID,
+		LastAccess:   time.Now(),
 	}
 
-	return &shard, nil
+	// LSH buckets are not persisted, rebuild them from the hashes
+	for hash := range simHashToPos {
+		idx.addToBuckets(shard, hash)
+	}
+
+	return shard, nil
 }
 
 // rotateShard persists the current shard and creates a new one
@@ -138,10 +374,11 @@ func (idx *Index) rotateShard() error {
 	if err := idx.saveShard(idx.Shards[idx.ActiveShard]); err != nil {
 		return err
 	}
+	idx.activeDirty = false
 
 	idx.ActiveShard++
 	idx.Shards = append(idx.Shards, &IndexShard{
-		SimHashToPos: make(map[simhash.SimHash][]int64),
+		SimHashToPos: make(map[simhash.Fingerprint][]int64),
 		ShardID:      idx.ActiveShard,
 		LastAccess:   time.Now(),
 	})
@@ -149,15 +386,27 @@ func (idx *Index) rotateShard() error {
 	return nil
 }
 
-// Lookup finds positions for a SimHash
+// Lookup finds positions for a 64-bit SimHash
 func (idx *Index) Lookup(hash simhash.SimHash) ([]int64, error) {
+	return idx.LookupFingerprint(hash.Fingerprint())
+}
+
+// LookupFingerprint finds positions for a fingerprint
+func (idx *Index) LookupFingerprint(hash simhash.Fingerprint) ([]int64, error) {
+	if err := idx.checkWidth(hash); err != nil {
+		return nil, err
+	}
+
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
 	// Check if we know which shard contains this hash
 	if shardID, exists := idx.shardMap[hash]; exists {
 		// Check cache first
-		if shard, ok := idx.cachedShards[shardID]; ok {
+		idx.cacheMu.Lock()
+		shard, ok := idx.cachedShards[shardID]
+		idx.cacheMu.Unlock()
+		if ok {
 			return shard.SimHashToPos[hash], nil
 		}
 
@@ -180,43 +429,18 @@ func (idx *Index) Lookup(hash simhash.SimHash) ([]int64, error) {
 	return nil, nil
 }
 
-// Stats returns statistics about the index
-func (idx *Index) Stats() map[string]interface{} {
-	idx.mu.RLock()
-	defer idx.mu.RUnlock()
-
-	totalEntries := 0
-	totalPositions := 0
-
-	for _, shard := range idx.Shards {
-		if shard != nil {
-			totalEntries += len(shard.SimHashToPos)
-			for _, positions := range shard.SimHashToPos {
-				totalPositions += len(positions)
-			}
-		}
-	}
-
-	return map[string]interface{}{
-		"source_file":     idx.SourceFile,
-		"chunk_size":      idx.ChunkSize,
-		"created":         idx.CreationTime,
-		"shards":          len(idx.Shards),
-		"unique_hashes":   totalEntries,
-		"total_positions": totalPositions,
-	}
-}
-
 // Close performs cleanup operations
 func (idx *Index) Close() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	// Save active shard if needed
-	if len(idx.Shards[idx.ActiveShard].SimHashToPos) > 0 {
+	// Save the active shard if fingerprints were added since it was last
+	// saved; an index opened only to be queried writes nothing
+	if idx.activeDirty {
 		if err := idx.saveShard(idx.Shards[idx.ActiveShard]); err != nil {
 			return err
 		}
+		idx.activeDirty = false
 	}
 
 	// Clear in-memory data to free up resources
@@ -227,18 +451,34 @@ func (idx *Index) Close() error {
 	return nil
 }
 
-// FuzzyLookup finds positions for similar SimHashes using LSH
+// FuzzyLookup finds positions for similar 64-bit SimHashes using LSH
 func (idx *Index) FuzzyLookup(hash simhash.SimHash, threshold int) (map[simhash.SimHash][]int64, bool) {
+	matches, found := idx.FuzzyLookupFingerprint(hash.Fingerprint(), threshold)
+	results := make(map[simhash.SimHash][]int64, len(matches))
+	for fp, positions := range matches {
+		results[fp.SimHash()] = positions
+	}
+	return results, found
+}
+
+// FuzzyLookupFingerprint finds positions for similar fingerprints using LSH
+func (idx *Index) FuzzyLookupFingerprint(hash simhash.Fingerprint, threshold int) (map[simhash.Fingerprint][]int64, bool) {
+	results := make(map[simhash.Fingerprint][]int64)
+	if idx.checkWidth(hash) != nil {
+		return results, false
+	}
+
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	candidates := make(map[simhash.SimHash]struct{})
-	signatures := idx.LSHTable.GetBandSignatures(hash)
+	shards := idx.searchShards()
+	candidates := make(map[simhash.Fingerprint]struct{})
+	signatures := idx.LSHTable.BandSignatures(hash)
 
 	// Collect candidates from LSH buckets
 	for i, sig := range signatures {
 		bucketKey := fmt.Sprintf("%d:%d", i, sig)
-		for _, shard := range idx.Shards {
+		for _, shard := range shards {
 			if shard == nil || shard.LSHBuckets == nil {
 				continue
 			}
@@ -251,12 +491,11 @@ func (idx *Index) FuzzyLookup(hash simhash.SimHash, threshold int) (map[simhash.
 	}
 
 	// Verify candidates with Hamming distance
-	results := make(map[simhash.SimHash][]int64)
 	found := false
 
 	for candidateHash := range candidates {
 		if candidateHash.IsSimilar(hash, threshold) {
-			for _, shard := range idx.Shards {
+			for _, shard := range shards {
 				if shard == nil {
 					continue
 				}
@@ -273,16 +512,50 @@ func (idx *Index) FuzzyLookup(hash simhash.SimHash, threshold int) (map[simhash.
 
 // LSHBucket represents a collection of similar hashes
 type LSHBucket struct {
-	hashes map[simhash.SimHash]struct{}
+	hashes map[simhash.Fingerprint]struct{}
+}
+
+// searchShards returns every shard of the index, loading the ones that are
+// not in memory through the shard cache; callers hold idx.mu
+func (idx *Index) searchShards() []*IndexShard {
+	shards := make([]*IndexShard, len(idx.Shards))
+	for i, shard := range idx.Shards {
+		if shard != nil {
+			shards[i] = shard
+			continue
+		}
+
+		idx.cacheMu.Lock()
+		cached, ok := idx.cachedShards[i]
+		idx.cacheMu.Unlock()
+		if ok {
+			shards[i] = cached
+			continue
+		}
+
+		loaded, err := idx.loadShard(i)
+		if err != nil {
+			continue
+		}
+		idx.cacheShardLRU(i, loaded)
+		shards[i] = loaded
+	}
+	return shards
 }
 
 func (idx *Index) cacheShardLRU(shardID int, shard *IndexShard) {
-	if len(idx.cachedShards) >= idx.cacheSize {
+	idx.cacheMu.Lock()
+	defer idx.cacheMu.Unlock()
+
+	if idx.cachedShards == nil {
+		idx.cachedShards = make(map[int]*IndexShard)
+	}
+	if idx.cacheSize > 0 && len(idx.cachedShards) >= idx.cacheSize {
 		// Evict least recently used shard
 		var oldestTime time.Time
-		var oldestID int
+		oldestID := -1
 		for id, s := range idx.cachedShards {
-			if s.LastAccess.Before(oldestTime) {
+			if oldestID < 0 || s.LastAccess.Before(oldestTime) {
 				oldestTime = s.LastAccess
 				oldestID = id
 			}
@@ -0,0 +1,53 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// portablePath returns target relative to dir together with its absolute
+// form. Remote locations such as s3:// URLs are returned unchanged.
+func portablePath(dir, target string) (rel, abs string) {
+	if target == "" || strings.Contains(target, "://") {
+		return target, target
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return target, target
+	}
+	rel, err = filepath.Rel(dir, abs)
+	if err != nil {
+		return abs, abs
+	}
+	return filepath.ToSlash(rel), abs
+}
+
+// resolvePath turns a stored relative path back into a usable one. The
+// location next to the index file wins; the absolute path recorded at save
+// time is the fallback for indexes that were moved without their sources.
+func resolvePath(dir, rel, abs string) string {
+	if rel == "" || strings.Contains(rel, "://") {
+		return rel
+	}
+
+	candidate := filepath.Join(dir, filepath.FromSlash(rel))
+	if _, err := os.Stat(candidate); err == nil {
+		return candidate
+	}
+	if abs != "" {
+		return abs
+	}
+	return candidate
+}
+
+// sameFile reports whether two paths name the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
@@ -1,84 +1,267 @@
 package index
 
 import (
+	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"time"
 
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
+// indexMeta is the on-disk form of the index metadata file. SourceFile and
+// IndexDir are relative to the index file when RelativePaths is set, with
+// the absolute paths at save time kept as a fallback.
+type indexMeta struct {
+	SourceFile    string
+	ChunkSize     int
+	ShardCount    int
+	Hyperplanes   [][]float64
+	Vectorizer    string
+	Normalizer    string
+	Language      string
+	Algorithm     string
+	Bits          int
+	Seed          int64
+	LSHBands      int
+	ModelID       string
+	MinHash       minhash.Config
+	Winnow        winnow.Config
+	Records       int // Vector records stored by AddVector
+	CreationTime  time.Time
+	IndexDir      string
+	ShardFilename string
+	RelativePaths bool
+	SourceFileAbs string
+	IndexDirAbs   string
+}
+
+// resolve replaces the stored paths with usable ones, applying overrides
+func (m *indexMeta) resolve(indexFile string, opts LoadOptions) {
+	if m.RelativePaths {
+		dir := filepath.Dir(indexFile)
+		m.SourceFile = resolvePath(dir, m.SourceFile, m.SourceFileAbs)
+		m.IndexDir = resolvePath(dir, m.IndexDir, m.IndexDirAbs)
+	}
+	if opts.SourceRoot != "" {
+		m.SourceFile = filepath.Join(opts.SourceRoot, filepath.Base(m.SourceFile))
+	}
+	if opts.IndexDir != "" {
+		m.IndexDir = opts.IndexDir
+	}
+}
+
+// relativize stores the paths relative to the directory of indexFile
+func (m *indexMeta) relativize(indexFile string) {
+	dir, err := filepath.Abs(filepath.Dir(indexFile))
+	if err != nil {
+		return
+	}
+	m.SourceFile, m.SourceFileAbs = portablePath(dir, m.SourceFile)
+	m.IndexDir, m.IndexDirAbs = portablePath(dir, m.IndexDir)
+	m.RelativePaths = true
+}
+
+// readMeta decodes the metadata file of an index
+func readMeta(indexFile string) (indexMeta, error) {
+	var meta indexMeta
+
+	file, err := os.Open(indexFile)
+	if err != nil {
+		return meta, fmt.Errorf("failed to open index file: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(&meta); err != nil {
+		return meta, fmt.Errorf("failed to decode index metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// writeMeta encodes the metadata file of an index
+func writeMeta(indexFile string, meta indexMeta) error {
+	file, err := os.Create(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewEncoder(file).Encode(meta); err != nil {
+		return fmt.Errorf("failed to encode index metadata: %w", err)
+	}
+	return nil
+}
+
 // Save writes the index metadata to a file
 func Save(idx *Index, outputFile string) error {
 	// First save any active shard
 	if err := idx.saveShard(idx.Shards[idx.ActiveShard]); err != nil {
 		return fmt.Errorf("failed to save active shard: %w", err)
 	}
+	idx.activeDirty = false
+
+	if err := idx.saveChunkRefs(); err != nil {
+		return fmt.Errorf("failed to save chunk positions: %w", err)
+	}
+
+	if err := idx.saveMinHashes(); err != nil {
+		return fmt.Errorf("failed to save MinHash signatures: %w", err)
+	}
 
-	// Create metadata structure
-	meta := struct {
-		SourceFile    string
-		ChunkSize     int
-		ShardCount    int
-		Hyperplanes   [][]float64
-		CreationTime  time.Time
-		IndexDir      string
-		ShardFilename string
-	}{
+	if err := idx.savePassages(); err != nil {
+		return fmt.Errorf("failed to save passage fingerprints: %w", err)
+	}
+
+	if err := idx.saveRecords(); err != nil {
+		return fmt.Errorf("failed to save record IDs: %w", err)
+	}
+
+	if idx.VectorizerState != nil {
+		if err := idx.Storage.Put(idx.vectorizerStateName(), idx.VectorizerState); err != nil {
+			return fmt.Errorf("failed to save vectorizer state: %w", err)
+		}
+	}
+
+	// Hyperplanes generated from the seed are regenerated on load, so only
+	// a custom matrix is stored
+	model := idx.Model()
+	var hyperplanes [][]float64
+	if model.PlanesDigest != "" {
+		hyperplanes = idx.Hyperplanes
+	}
+
+	meta := indexMeta{
 		SourceFile:    idx.SourceFile,
 		ChunkSize:     idx.ChunkSize,
 		ShardCount:    len(idx.Shards),
-		Hyperplanes:   idx.Hyperplanes,
+		Hyperplanes:   hyperplanes,
+		Vectorizer:    idx.Vectorizer.String(),
+		Normalizer:    idx.Normalizer.String(),
+		Language:      string(idx.Language),
+		Algorithm:     string(idx.Algorithm),
+		Bits:          idx.Bits,
+		Seed:          idx.Seed,
+		LSHBands:      model.LSHBands,
+		ModelID:       model.ID(),
+		MinHash:       idx.MinHash,
+		Winnow:        idx.Winnow,
+		Records:       idx.Records(),
 		CreationTime:  idx.CreationTime,
 		IndexDir:      idx.IndexDir,
 		ShardFilename: idx.ShardFilename,
 	}
+	meta.relativize(outputFile)
 
-	file, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create index file: %w", err)
-	}
-	defer file.Close()
-
-	if err := gob.NewEncoder(file).Encode(meta); err != nil {
-		return fmt.Errorf("failed to encode index metadata: %w", err)
-	}
+	return writeMeta(outputFile, meta)
+}
 
-	return nil
+// LoadOptions adjusts how an index is opened
+type LoadOptions struct {
+	Storage    Storage // Overrides the storage opened from the stored IndexDir
+	CacheDir   string  // Local cache for shards held in remote storage
+	SourceRoot string  // Directory holding the source file, if it moved
+	IndexDir   string  // Shard location, if it moved
 }
 
 // Load reads an index from a file
 func Load(indexFile string) (*Index, error) {
-	file, err := os.Open(indexFile)
+	return LoadWithOptions(indexFile, LoadOptions{})
+}
+
+// LoadWithOptions reads an index from a file using the given options
+func LoadWithOptions(indexFile string, opts LoadOptions) (*Index, error) {
+	meta, err := readMeta(indexFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open index file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	meta.resolve(indexFile, opts)
 
-	var meta struct {
-		SourceFile    string
-		ChunkSize     int
-		ShardCount    int
-		Hyperplanes   [][]float64
-		CreationTime  time.Time
-		IndexDir      string
-		ShardFilename string
+	// Indexes built before the vectorizer was recorded used the default
+	vectorizer, err := simhash.ParseVectorizerConfig(meta.Vectorizer)
+	if err != nil {
+		return nil, fmt.Errorf("index uses an unsupported vectorizer: %w", err)
+	}
+	// Indexes built before normalization was recorded used none
+	normalizer := simhash.Normalizer{}
+	if meta.Normalizer != "" {
+		if normalizer, err = simhash.ParseNormalizer(meta.Normalizer); err != nil {
+			return nil, fmt.Errorf("index uses an unsupported normalizer: %w", err)
+		}
+	}
+	language, err := simhash.ParseLanguage(meta.Language)
+	if err != nil {
+		return nil, fmt.Errorf("index uses an unsupported language: %w", err)
+	}
+	algorithm, err := simhash.ParseAlgorithm(meta.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("index uses an unsupported algorithm: %w", err)
+	}
+	bits := meta.Bits
+	if bits == 0 {
+		bits = simhash.DefaultFingerprintBits
+	}
+	if err := simhash.ValidateFingerprintBits(bits); err != nil {
+		return nil, err
+	}
+	// Indexes built before the seed was recorded used the default
+	seed := meta.Seed
+	if meta.ModelID == "" && seed == 0 {
+		seed = simhash.DefaultSeed
+	}
+	// and those built before the LSH bands were recorded one per 16 bits
+	if meta.LSHBands != 0 {
+		if err := simhash.ValidateLSHBands(bits, meta.LSHBands); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := gob.NewDecoder(file).Decode(&meta); err != nil {
-		return nil, fmt.Errorf("failed to decode index metadata: %w", err)
+	storage := opts.Storage
+	if storage == nil {
+		if storage, err = OpenStorage(meta.IndexDir); err != nil {
+			return nil, fmt.Errorf("failed to open index storage: %w", err)
+		}
+	}
+	if opts.CacheDir != "" {
+		if storage, err = NewCachedStorage(storage, opts.CacheDir); err != nil {
+			return nil, err
+		}
 	}
 
 	idx := &Index{
 		SourceFile:    meta.SourceFile,
 		ChunkSize:     meta.ChunkSize,
 		Hyperplanes:   meta.Hyperplanes,
+		Vectorizer:    vectorizer,
+		Normalizer:    normalizer,
+		Language:      language,
+		Algorithm:     algorithm,
+		Bits:          bits,
+		Seed:          seed,
+		MinHash:       meta.MinHash,
+		Winnow:        meta.Winnow,
 		CreationTime:  meta.CreationTime,
-		LSHTable:      simhash.NewPermutationTable(simhash.NumHyperplanes, 4),
+		LSHTable:      newLSHTable(bits, meta.LSHBands, seed),
 		IndexDir:      meta.IndexDir,
+		Storage:       storage,
 		ShardFilename: meta.ShardFilename,
 		Shards:        make([]*IndexShard, meta.ShardCount),
+		shardMap:      make(map[simhash.Fingerprint]int),
+		cachedShards:  make(map[int]*IndexShard),
+		cacheSize:     5,
+	}
+
+	model := idx.Model()
+	if idx.Hyperplanes == nil {
+		idx.Hyperplanes = model.Hyperplanes()
+	}
+	if meta.ModelID != "" && meta.ModelID != model.ID() {
+		return nil, fmt.Errorf("index model %s cannot be reproduced (got %s); it was built by an incompatible version", meta.ModelID, model.ID())
 	}
 
 	// Load first shard
@@ -90,5 +273,107 @@ func Load(indexFile string) (*Index, error) {
 		idx.Shards[0] = firstShard
 	}
 
+	if err := idx.loadChunkRefs(); err != nil {
+		return nil, fmt.Errorf("failed to load chunk positions: %w", err)
+	}
+
+	if err := idx.loadMinHashes(); err != nil {
+		return nil, fmt.Errorf("failed to load MinHash signatures: %w", err)
+	}
+
+	if err := idx.loadPassages(); err != nil {
+		return nil, fmt.Errorf("failed to load passage fingerprints: %w", err)
+	}
+
+	if err := idx.loadRecords(meta.Records); err != nil {
+		return nil, fmt.Errorf("failed to load record IDs: %w", err)
+	}
+
+	state, err := idx.Storage.Get(idx.vectorizerStateName())
+	switch {
+	case err == nil:
+		idx.VectorizerState = state
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("failed to load vectorizer state: %w", err)
+	}
+
 	return idx, nil
 }
+
+// vectorizerStateName is the side blob holding learned vectorizer state
+func (idx *Index) vectorizerStateName() string {
+	return idx.ShardFilename + ".vec"
+}
+
+// NewVectorizer builds the vectorizer that produced the index hashes,
+// including its language, normalization and any corpus statistics learned
+// while indexing
+func (idx *Index) NewVectorizer() (simhash.Vectorizer, error) {
+	vectorizer, err := idx.Vectorizer.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Language.Apply(vectorizer); err != nil {
+		return nil, err
+	}
+	vectorizer = idx.Normalizer.Wrap(vectorizer)
+	if cv, ok := vectorizer.(simhash.CorpusVectorizer); ok && idx.VectorizerState != nil {
+		if err := cv.UnmarshalBinary(idx.VectorizerState); err != nil {
+			return nil, fmt.Errorf("invalid vectorizer state: %w", err)
+		}
+	}
+	return vectorizer, nil
+}
+
+// chunkRefsName is the side blob holding the position-ordered chunk index
+func (idx *Index) chunkRefsName() string {
+	return idx.ShardFilename + ".pos"
+}
+
+// saveChunkRefs writes the chunk positions sorted by start offset
+func (idx *Index) saveChunkRefs() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.sortChunks()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx.chunks); err != nil {
+		return err
+	}
+	return idx.Storage.Put(idx.chunkRefsName(), buf.Bytes())
+}
+
+// loadChunkRefs reads the chunk positions; indexes built before positions
+// were recorded simply have none
+func (idx *Index) loadChunkRefs() error {
+	data, err := idx.Storage.Get(idx.chunkRefsName())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var chunks []ChunkRef
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&chunks); err != nil {
+		// Positions written before fingerprints had a width hold 64-bit SimHashes
+		var legacy []struct {
+			Hash   simhash.SimHash
+			Start  int64
+			Length int
+		}
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy) != nil {
+			return err
+		}
+		chunks = make([]ChunkRef, len(legacy))
+		for i, ref := range legacy {
+			chunks[i] = ChunkRef{Hash: ref.Hash.Fingerprint(), Start: ref.Start, Length: ref.Length}
+		}
+	}
+
+	idx.chunks = chunks
+	idx.chunksSorted = true
+	idx.chunkReach = nil
+	return nil
+}
@@ -0,0 +1,146 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"jamtext/internal/simhash"
+)
+
+const (
+	// Rough per-entry costs used to estimate memory usage of a shard
+	hashEntryBytes   = 64 // map entry plus slice header
+	positionBytes    = 8
+	bucketEntryBytes = 48 // bucket key and map entry
+	bucketHashBytes  = 16
+
+	mostDuplicatedCount = 10
+)
+
+// Stats returns statistics about the index. Shard sizes come from the
+// storage without reading the shards; shards that are not in memory are read
+// for the duration of the call to count their hashes.
+func (idx *Index) Stats() (IndexStats, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	stats := IndexStats{
+		SourceFile:      idx.SourceFile,
+		ChunkSize:       idx.ChunkSize,
+		FingerprintBits: idx.Bits,
+		ModelID:         idx.Model().ID(),
+		TotalChunks:     int64(len(idx.chunks)),
+		TotalRecords:    int64(len(idx.records)),
+		ShardCount:      len(idx.Shards),
+		CreationTime:    idx.CreationTime,
+	}
+
+	postings := make(map[simhash.Fingerprint]int)
+	buckets := make(map[string]int)
+
+	for i, shard := range idx.Shards {
+		shardStats := ShardStats{ShardID: i, InMemory: shard != nil}
+
+		size, err := idx.Storage.Size(idx.shardName(i))
+		switch {
+		case err == nil:
+			shardStats.DiskBytes = size
+		case errors.Is(err, fs.ErrNotExist) && shard != nil:
+			// Active shard that has not been written yet
+		default:
+			return stats, fmt.Errorf("failed to read shard %d: %w", i, err)
+		}
+
+		// Only shards that are not in memory are read, to count their hashes
+		if shard == nil {
+			data, err := idx.Storage.Get(idx.shardName(i))
+			if err != nil {
+				return stats, fmt.Errorf("failed to read shard %d: %w", i, err)
+			}
+			if shard, err = idx.decodeShard(i, data); err != nil {
+				return stats, fmt.Errorf("failed to decode shard %d: %w", i, err)
+			}
+		} else {
+			stats.MemoryUsage += shardMemory(shard)
+		}
+
+		shardStats.UniqueHashes = int64(len(shard.SimHashToPos))
+		for hash, positions := range shard.SimHashToPos {
+			shardStats.Positions += int64(len(positions))
+			postings[hash] += len(positions)
+		}
+		for key, bucket := range shard.LSHBuckets {
+			buckets[key] += len(bucket.hashes)
+		}
+
+		stats.DiskBytes += shardStats.DiskBytes
+		stats.TotalPositions += shardStats.Positions
+		stats.Shards = append(stats.Shards, shardStats)
+	}
+
+	stats.UniqueHashes = int64(len(postings))
+	stats.LSHBuckets = len(buckets)
+
+	bucketSizes := make([]int, 0, len(buckets))
+	for _, size := range buckets {
+		bucketSizes = append(bucketSizes, size)
+	}
+	stats.LSHBucketSizes = histogram(bucketSizes)
+
+	counts := make([]HashCount, 0, len(postings))
+	postingSizes := make([]int, 0, len(postings))
+	for hash, count := range postings {
+		counts = append(counts, HashCount{Hash: hash, Count: count})
+		postingSizes = append(postingSizes, count)
+	}
+	stats.PostingsPerHash = histogram(postingSizes)
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Hash.Less(counts[j].Hash)
+	})
+	for _, c := range counts {
+		if len(stats.MostDuplicated) == mostDuplicatedCount || c.Count < 2 {
+			break
+		}
+		stats.MostDuplicated = append(stats.MostDuplicated, c)
+	}
+
+	return stats, nil
+}
+
+// shardMemory estimates the bytes held by a shard's maps
+func shardMemory(shard *IndexShard) int64 {
+	var total int64
+	for _, positions := range shard.SimHashToPos {
+		total += hashEntryBytes + int64(cap(positions))*positionBytes
+	}
+	for _, bucket := range shard.LSHBuckets {
+		total += bucketEntryBytes + int64(len(bucket.hashes))*bucketHashBytes
+	}
+	return total
+}
+
+// histogram groups values into power-of-two bins: 1, 2-3, 4-7, ...
+func histogram(values []int) []HistogramBin {
+	var bins []HistogramBin
+	for _, v := range values {
+		if v < 1 {
+			continue
+		}
+		bin := 0
+		for lo := 1; lo*2 <= v; lo *= 2 {
+			bin++
+		}
+		for len(bins) <= bin {
+			lo := 1 << len(bins)
+			bins = append(bins, HistogramBin{Min: lo, Max: lo*2 - 1})
+		}
+		bins[bin].Count++
+	}
+	return bins
+}
@@ -0,0 +1,260 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage holds the blobs that make up an index: shards and side files.
+// Names are flat, slash-free keys such as "book.txt.shard.0".
+type Storage interface {
+	Get(name string) ([]byte, error)
+	Put(name string, data []byte) error
+	List(prefix string) ([]string, error)
+	Delete(name string) error
+	// Size returns the length of a blob without reading it
+	Size(name string) (int64, error)
+}
+
+// OpenStorage returns the storage backend for an index location. Locations
+// of the form s3://bucket/prefix use S3Storage, anything else is treated as
+// a local directory.
+func OpenStorage(location string) (Storage, error) {
+	if strings.HasPrefix(location, "s3://") {
+		return NewS3StorageFromURL(location)
+	}
+	return NewFSStorage(location)
+}
+
+// FSStorage stores blobs as files in a local directory
+type FSStorage struct {
+	dir string
+}
+
+// NewFSStorage creates a filesystem storage rooted at dir
+func NewFSStorage(dir string) (*FSStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FSStorage{dir: dir}, nil
+}
+
+// Path returns the local file backing a blob, for memory-mapped reads
+func (s *FSStorage) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *FSStorage) Get(name string) ([]byte, error) {
+	return os.ReadFile(s.Path(name))
+}
+
+// Put writes the blob to a temporary file first so readers never see a
+// partially written shard
+func (s *FSStorage) Put(name string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	// CreateTemp makes the file private; indexes are shared like any other
+	// file written with os.Create
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path(name))
+}
+
+func (s *FSStorage) List(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *FSStorage) Delete(name string) error {
+	err := os.Remove(s.Path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FSStorage) Size(name string) (int64, error) {
+	info, err := os.Stat(s.Path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// MemoryStorage keeps blobs in memory, mainly for tests
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryStorage) Get(name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[name]
+	if !ok {
+		return nil, fmt.Errorf("blob %s: %w", name, fs.ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStorage) Put(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryStorage) List(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for name := range s.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, name)
+	return nil
+}
+
+func (s *MemoryStorage) Size(name string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[name]
+	if !ok {
+		return 0, fmt.Errorf("blob %s: %w", name, fs.ErrNotExist)
+	}
+	return int64(len(data)), nil
+}
+
+// CachedStorage reads through a local cache in front of a remote storage,
+// so query nodes only download each shard once
+type CachedStorage struct {
+	remote Storage
+	local  *FSStorage
+}
+
+// NewCachedStorage wraps remote with a local cache directory
+func NewCachedStorage(remote Storage, cacheDir string) (*CachedStorage, error) {
+	local, err := NewFSStorage(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &CachedStorage{remote: remote, local: local}, nil
+}
+
+// Path returns the cached copy of a blob, fetching it first if needed. It
+// returns "" when the blob cannot be cached, so callers read it with Get
+// and see why.
+func (s *CachedStorage) Path(name string) string {
+	path := s.local.Path(name)
+	if _, err := os.Stat(path); err != nil {
+		if _, err := s.Get(name); err != nil {
+			return ""
+		}
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+	}
+	return path
+}
+
+func (s *CachedStorage) Get(name string) ([]byte, error) {
+	if data, err := s.local.Get(name); err == nil {
+		return data, nil
+	}
+
+	data, err := s.remote.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed cache write only costs a refetch later
+	s.local.Put(name, data)
+	return data, nil
+}
+
+func (s *CachedStorage) Put(name string, data []byte) error {
+	if err := s.remote.Put(name, data); err != nil {
+		return err
+	}
+	return s.local.Put(name, data)
+}
+
+func (s *CachedStorage) List(prefix string) ([]string, error) {
+	return s.remote.List(prefix)
+}
+
+func (s *CachedStorage) Delete(name string) error {
+	if err := s.remote.Delete(name); err != nil {
+		return err
+	}
+	return s.local.Delete(name)
+}
+
+// Size answers from the cache when the blob is there, and asks the remote
+// storage without downloading the blob otherwise
+func (s *CachedStorage) Size(name string) (int64, error) {
+	if size, err := s.local.Size(name); err == nil {
+		return size, nil
+	}
+	return s.remote.Size(name)
+}
+
+// errStorage reports the error that prevented a backend from opening on
+// every call, so New can stay infallible
+type errStorage struct {
+	err error
+}
+
+func (s errStorage) Get(string) ([]byte, error)    { return nil, s.err }
+func (s errStorage) Put(string, []byte) error      { return s.err }
+func (s errStorage) List(string) ([]string, error) { return nil, s.err }
+func (s errStorage) Delete(string) error           { return s.err }
+func (s errStorage) Size(string) (int64, error)    { return 0, s.err }
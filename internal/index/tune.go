@@ -0,0 +1,121 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	"jamtext/internal/simhash"
+)
+
+// LSHMeasurement is how an LSH layout performs on the hashes of an index
+type LSHMeasurement struct {
+	Bands      int
+	Queries    int     // Hashes of the index used as queries
+	Neighbors  int     // Other hashes within the threshold of a query
+	Found      int     // Neighbors that shared a band with their query
+	Candidates float64 // Average candidates per query, not counting the query
+}
+
+// Recall returns the fraction of neighbors that LSH found
+func (m LSHMeasurement) Recall() float64 {
+	if m.Neighbors == 0 {
+		return 1
+	}
+	return float64(m.Found) / float64(m.Neighbors)
+}
+
+// bandKey is a band signature in one band
+type bandKey struct {
+	band int
+	sig  uint64
+}
+
+// MeasureLSH measures recall and candidate volume of LSH layouts with the
+// given band counts. Up to sample unique hashes of the index, spread evenly
+// over all of them, are looked up among the rest, and the neighbors within
+// threshold found by a full scan are compared with the LSH candidates.
+func (idx *Index) MeasureLSH(threshold, sample int, bands ...int) ([]LSHMeasurement, error) {
+	if sample <= 0 {
+		return nil, fmt.Errorf("sample size must be positive, got %d", sample)
+	}
+	for _, b := range bands {
+		if err := simhash.ValidateLSHBands(idx.Bits, b); err != nil {
+			return nil, err
+		}
+	}
+
+	idx.mu.RLock()
+	unique := make(map[simhash.Fingerprint]struct{})
+	for _, shard := range idx.searchShards() {
+		if shard == nil {
+			continue
+		}
+		for hash := range shard.SimHashToPos {
+			unique[hash] = struct{}{}
+		}
+	}
+	idx.mu.RUnlock()
+
+	hashes := make([]simhash.Fingerprint, 0, len(unique))
+	for hash := range unique {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Less(hashes[j]) })
+
+	var queries []int
+	if len(hashes) > 0 {
+		step := float64(len(hashes)) / float64(min(sample, len(hashes)))
+		for q := 0.0; int(q) < len(hashes); q += step {
+			queries = append(queries, int(q))
+		}
+	}
+
+	// The neighbors of each query do not depend on the layout
+	neighbors := make([][]int, len(queries))
+	for i, q := range queries {
+		for j, hash := range hashes {
+			if j != q && hash.IsSimilar(hashes[q], threshold) {
+				neighbors[i] = append(neighbors[i], j)
+			}
+		}
+	}
+
+	results := make([]LSHMeasurement, 0, len(bands))
+	for _, b := range bands {
+		table := newLSHTable(idx.Bits, b, idx.Seed)
+		buckets := make(map[bandKey][]int)
+		signatures := make([][]uint64, len(hashes))
+		for i, hash := range hashes {
+			signatures[i] = table.BandSignatures(hash)
+			for band, sig := range signatures[i] {
+				key := bandKey{band, sig}
+				buckets[key] = append(buckets[key], i)
+			}
+		}
+
+		m := LSHMeasurement{Bands: b, Queries: len(queries)}
+		candidates := 0
+		for i, q := range queries {
+			seen := make(map[int]struct{})
+			for band, sig := range signatures[q] {
+				for _, j := range buckets[bandKey{band, sig}] {
+					if j != q {
+						seen[j] = struct{}{}
+					}
+				}
+			}
+			candidates += len(seen)
+			m.Neighbors += len(neighbors[i])
+			for _, j := range neighbors[i] {
+				if _, ok := seen[j]; ok {
+					m.Found++
+				}
+			}
+		}
+		if len(queries) > 0 {
+			m.Candidates = float64(candidates) / float64(len(queries))
+		}
+		results = append(results, m)
+	}
+	return results, nil
+}
@@ -3,12 +3,14 @@ package index
 import (
 	"sync"
 	"time"
+	"jamtext/internal/minhash"
 	"jamtext/internal/simhash"
+	"jamtext/internal/winnow"
 )
 
 // IndexShard represents a portion of the index
 type IndexShard struct {
-	SimHashToPos map[simhash.SimHash][]int64
+	SimHashToPos map[simhash.Fingerprint][]int64
 	LSHBuckets   map[string]*LSHBucket // Added LSH support
 	ShardID      int
 	LastAccess   time.Time
@@ -16,27 +18,93 @@ type IndexShard struct {
 
 // Index stores SimHash mappings with sharding support
 type Index struct {
-	SourceFile    string
-	ChunkSize     int
-	Shards        []*IndexShard
-	ActiveShard   int
-	Hyperplanes   [][]float64
-	CreationTime  time.Time
-	LSHTable      *simhash.PermutationTable
-	IndexDir      string
-	mu            sync.RWMutex
-	ShardFilename string
-	cachedShards  map[int]*IndexShard           // Cache for frequently accessed shards
-	cacheSize     int                           // Maximum number of shards to keep in memory
-	shardMap      map[simhash.SimHash]int       // Maps hashes to their shard IDs
-}
-
-// IndexStats contains statistics about the index
+	SourceFile      string
+	ChunkSize       int
+	Shards          []*IndexShard
+	ActiveShard     int
+	activeDirty     bool // The active shard has fingerprints that were not saved
+	Hyperplanes     [][]float64
+	Vectorizer      simhash.VectorizerConfig // Vectorizer that produced the hashes
+	VectorizerState []byte                   // Learned corpus statistics, if the vectorizer has any
+	Normalizer      simhash.Normalizer       // Text normalization in front of the vectorizer
+	Language        simhash.Language         // Stopwords and stemming of word-based vectorizers
+	Algorithm       simhash.Algorithm        // How features become fingerprints
+	Bits            int                      // Fingerprint width: 64, 128 or 256
+	Seed            int64                    // Seeds the hyperplanes and LSH permutations
+	MinHash         minhash.Config           // MinHash signature settings; zero when none are stored
+	Winnow          winnow.Config            // Passage fingerprint settings; zero when none are stored
+	CreationTime    time.Time
+	LSHTable        *simhash.PermutationTable
+	IndexDir        string
+	Storage         Storage // Backend holding shards, opened from IndexDir
+	mu              sync.RWMutex
+	ShardFilename   string
+	cachedShards    map[int]*IndexShard         // Cache for frequently accessed shards
+	cacheSize       int                         // Maximum number of shards to keep in memory
+	shardMap        map[simhash.Fingerprint]int // Maps hashes to their shard IDs
+	chunks          []ChunkRef                  // Position-ordered side index
+	chunksSorted    bool
+	chunkReach      []int64                     // Furthest end of the sorted chunks up to each one
+	minhashes       map[int64]minhash.Signature // MinHash signature per chunk position
+	minhashLSH      *minhash.LSH                // Built on the first Jaccard lookup
+	passages        *winnow.Index               // Winnowing fingerprints of the whole source file
+	records         []string                    // ID of each vector record, by position
+	projector       *simhash.Projector          // Projects vector records, built by AddVector
+	cacheMu         sync.Mutex
+}
+
+// ChunkRef locates a chunk in the source file together with its fingerprint
+type ChunkRef struct {
+	Hash   simhash.Fingerprint
+	Start  int64
+	Length int
+}
+
+// Contains reports whether the chunk covers the given byte offset
+func (c ChunkRef) Contains(offset int64) bool {
+	return offset >= c.Start && offset < c.Start+int64(c.Length)
+}
+
+// IndexStats contains statistics about the index, computed from every shard
+// in storage rather than only those in memory
 type IndexStats struct {
-	TotalChunks    int64
-	UniqueHashes   int64
-	TotalPositions int64
-	ShardCount     int
-	MemoryUsage    int64
-	CreationTime   time.Time
+	SourceFile      string
+	ChunkSize       int
+	FingerprintBits int
+	ModelID         string
+	TotalChunks     int64
+	TotalRecords    int64 // Vectors stored by AddVector
+	UniqueHashes    int64
+	TotalPositions  int64
+	ShardCount      int
+	MemoryUsage     int64 // Estimated bytes held by shards currently in memory
+	DiskBytes       int64
+	CreationTime    time.Time
+	Shards          []ShardStats
+	LSHBuckets      int
+	LSHBucketSizes  []HistogramBin // Hashes per LSH bucket
+	PostingsPerHash []HistogramBin // Positions per unique hash
+	MostDuplicated  []HashCount
+}
+
+// ShardStats describes a single shard
+type ShardStats struct {
+	ShardID      int
+	UniqueHashes int64
+	Positions    int64
+	DiskBytes    int64
+	InMemory     bool
+}
+
+// HistogramBin counts values in the inclusive range [Min, Max]
+type HistogramBin struct {
+	Min   int
+	Max   int
+	Count int64
+}
+
+// HashCount pairs a hash with the number of positions it occurs at
+type HashCount struct {
+	Hash  simhash.Fingerprint
+	Count int
 }
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+
+	"jamtext/internal/simhash"
+)
+
+// AddVector projects a vector computed elsewhere, such as an embedding,
+// through the hyperplanes of the index and stores its fingerprint as a
+// record with the given ID. Records are numbered in the order they are
+// added, and lookups return that number as the position; RecordID maps it
+// back to the ID. An index holds either records or chunks of a source file.
+func (idx *Index) AddVector(id string, vector []float64) (simhash.Fingerprint, error) {
+	if idx.Algorithm != simhash.Hyperplane {
+		return simhash.Fingerprint{}, fmt.Errorf("vectors are projected through hyperplanes, but the index uses the %s algorithm", idx.Algorithm)
+	}
+	if len(idx.Hyperplanes) < idx.Bits {
+		return simhash.Fingerprint{}, fmt.Errorf("%d-bit fingerprints need %d hyperplanes, got %d", idx.Bits, idx.Bits, len(idx.Hyperplanes))
+	}
+	if err := simhash.ValidateHyperplanes(idx.Hyperplanes, len(vector)); err != nil {
+		return simhash.Fingerprint{}, fmt.Errorf("record %s: %w", id, err)
+	}
+	for i, v := range vector {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return simhash.Fingerprint{}, fmt.Errorf("record %s: component %d is %v", id, i, v)
+		}
+	}
+
+	idx.mu.Lock()
+	if len(idx.chunks) > 0 {
+		idx.mu.Unlock()
+		return simhash.Fingerprint{}, fmt.Errorf("index of %s chunks cannot store vectors", idx.SourceFile)
+	}
+	if idx.projector == nil {
+		idx.projector = simhash.NewProjector(idx.Bits, idx.Hyperplanes)
+	}
+	projector := idx.projector
+	pos := int64(len(idx.records))
+	idx.records = append(idx.records, id)
+	idx.mu.Unlock()
+
+	hash := projector.FingerprintVector(vector)
+	if err := idx.AddFingerprint(hash, pos); err != nil {
+		return simhash.Fingerprint{}, err
+	}
+	return hash, nil
+}
+
+// RecordID returns the ID of the record stored at pos by AddVector
+func (idx *Index) RecordID(pos int64) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if pos < 0 || pos >= int64(len(idx.records)) {
+		return "", false
+	}
+	return idx.records[pos], true
+}
+
+// Records returns the number of records stored by AddVector
+func (idx *Index) Records() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.records)
+}
+
+// recordsName is the side blob holding the record IDs
+func (idx *Index) recordsName() string {
+	return idx.ShardFilename + ".ids"
+}
+
+// saveRecords writes the record IDs of an index of vectors
+func (idx *Index) saveRecords() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx.records); err != nil {
+		return err
+	}
+	return idx.Storage.Put(idx.recordsName(), buf.Bytes())
+}
+
+// loadRecords reads the count record IDs the metadata says were saved
+func (idx *Index) loadRecords(count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	data, err := idx.Storage.Get(idx.recordsName())
+	if err != nil {
+		return err
+	}
+	var records []string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&records); err != nil {
+		return err
+	}
+	if len(records) != count {
+		return fmt.Errorf("found %d record IDs, expected %d", len(records), count)
+	}
+	idx.records = records
+	return nil
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"jamtext/internal/winnow"
+)
+
+// SetWinnow enables passage fingerprints for an index without any
+func (idx *Index) SetWinnow(cfg winnow.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.passages != nil && idx.passages.Len() > 0 {
+		return fmt.Errorf("cannot change the winnowing settings of an index with passage fingerprints")
+	}
+	idx.Winnow = cfg
+	idx.passages = winnow.NewIndex(cfg)
+	return nil
+}
+
+// AddPassageFingerprint records a winnowing fingerprint of the source file
+func (idx *Index) AddPassageFingerprint(fp winnow.Fingerprint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.Winnow.Enabled() {
+		return fmt.Errorf("index does not store passage fingerprints")
+	}
+	if idx.passages == nil {
+		idx.passages = winnow.NewIndex(idx.Winnow)
+	}
+	idx.passages.Add(fp)
+	return nil
+}
+
+// PassageFingerprints returns the number of stored passage fingerprints
+func (idx *Index) PassageFingerprints() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.passages == nil {
+		return 0
+	}
+	return idx.passages.Len()
+}
+
+// Passages locates the passages of a query, given as fingerprints selected
+// by NewWinnower, that also occur in the source file
+func (idx *Index) Passages(query []winnow.Fingerprint) ([]winnow.Passage, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.Winnow.Enabled() || idx.passages == nil {
+		return nil, fmt.Errorf("index does not store passage fingerprints; rebuild it with -winnow")
+	}
+	return idx.passages.Match(query), nil
+}
+
+// NewWinnower builds the winnower that selected the passage fingerprints
+func (idx *Index) NewWinnower() (*winnow.Winnower, error) {
+	if !idx.Winnow.Enabled() {
+		return nil, fmt.Errorf("index does not store passage fingerprints; rebuild it with -winnow")
+	}
+	return winnow.NewWinnower(idx.Winnow)
+}
+
+// passagesName is the side blob holding the passage fingerprints
+func (idx *Index) passagesName() string {
+	return idx.ShardFilename + ".win"
+}
+
+// savePassages writes the passage fingerprints of an index that stores them
+func (idx *Index) savePassages() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.Winnow.Enabled() || idx.passages == nil {
+		return nil
+	}
+
+	data, err := idx.passages.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return idx.Storage.Put(idx.passagesName(), data)
+}
+
+// loadPassages reads the passage fingerprints of an index that stores them
+func (idx *Index) loadPassages() error {
+	if !idx.Winnow.Enabled() {
+		return nil
+	}
+
+	idx.passages = winnow.NewIndex(idx.Winnow)
+	data, err := idx.Storage.Get(idx.passagesName())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return idx.passages.UnmarshalBinary(data)
+}
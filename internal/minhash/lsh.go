@@ -0,0 +1,69 @@
+package minhash
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// LSH finds signatures that agree on every row of at least one band. With b
+// bands of r rows, pairs above a Jaccard similarity of about (1/b)^(1/r)
+// are likely to become candidates.
+type LSH struct {
+	bands   int
+	rows    int
+	buckets []map[uint64][]int64
+}
+
+// NewLSH creates an empty LSH table for signatures of the given config
+func NewLSH(cfg Config) *LSH {
+	l := &LSH{
+		bands:   cfg.Bands,
+		rows:    cfg.NumHashes / cfg.Bands,
+		buckets: make([]map[uint64][]int64, cfg.Bands),
+	}
+	for i := range l.buckets {
+		l.buckets[i] = make(map[uint64][]int64)
+	}
+	return l
+}
+
+// Threshold returns the Jaccard similarity at which a pair has an even
+// chance of becoming a candidate
+func (l *LSH) Threshold() float64 {
+	return math.Pow(1/float64(l.bands), 1/float64(l.rows))
+}
+
+// Add registers a signature under an id
+func (l *LSH) Add(id int64, sig Signature) {
+	for band := range l.buckets {
+		key := l.bandKey(sig, band)
+		l.buckets[band][key] = append(l.buckets[band][key], id)
+	}
+}
+
+// Candidates returns the ids sharing at least one band with sig
+func (l *LSH) Candidates(sig Signature) []int64 {
+	seen := make(map[int64]struct{})
+	var ids []int64
+	for band := range l.buckets {
+		for _, id := range l.buckets[band][l.bandKey(sig, band)] {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// bandKey hashes the rows of one band
+func (l *LSH) bandKey(sig Signature, band int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range sig[band*l.rows : (band+1)*l.rows] {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,30 @@
+package minhash
+
+import (
+	"testing"
+)
+
+func TestLSHCandidates(t *testing.T) {
+	cfg := DefaultConfig()
+	hasher, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := "the quick brown fox jumps over the lazy dog while the farmer sleeps in the afternoon sun near the old barn"
+	near := "the quick brown fox jumps over the lazy dog while the farmer sleeps in the afternoon sun near the red barn"
+	far := "stock markets rallied on tuesday as investors weighed fresh data on inflation and central bank policy"
+
+	lsh := NewLSH(cfg)
+	lsh.Add(1, hasher.Signature(base))
+	lsh.Add(2, hasher.Signature(far))
+
+	candidates := lsh.Candidates(hasher.Signature(near))
+	if len(candidates) != 1 || candidates[0] != 1 {
+		t.Errorf("Candidates = %v, want [1]", candidates)
+	}
+
+	if th := lsh.Threshold(); th <= 0 || th >= 1 {
+		t.Errorf("Threshold = %v, want a value between 0 and 1", th)
+	}
+}
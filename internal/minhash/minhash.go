@@ -0,0 +1,272 @@
+// Package minhash estimates the Jaccard similarity of texts, the fraction of
+// word shingles they share, from fixed-size MinHash signatures.
+package minhash
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"math/rand"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mersenne61 is the prime 2^61-1 used as the modulus of the hash family
+const mersenne61 = 1<<61 - 1
+
+// Config describes how signatures are computed. Signatures are only
+// comparable when they were computed with the same Config.
+type Config struct {
+	NumHashes   int   // Signature length, one hash function per entry
+	ShingleSize int   // Words per shingle
+	Seed        int64 // Seed of the hash function coefficients
+	Bands       int   // LSH bands; must divide NumHashes
+}
+
+// DefaultConfig returns 128 hashes over 3-word shingles, banded 32 x 4
+func DefaultConfig() Config {
+	return Config{NumHashes: 128, ShingleSize: 3, Seed: 1, Bands: 32}
+}
+
+// NewConfig returns a config with the default seed, banded four rows per
+// band when numHashes allows it and one row per band otherwise
+func NewConfig(numHashes, shingleSize int) Config {
+	bands := numHashes
+	if numHashes%4 == 0 {
+		bands = numHashes / 4
+	}
+	return Config{NumHashes: numHashes, ShingleSize: shingleSize, Seed: 1, Bands: bands}
+}
+
+// Enabled reports whether the config describes signatures at all; the zero
+// Config is used by indexes that store none
+func (c Config) Enabled() bool {
+	return c.NumHashes > 0
+}
+
+// Validate checks that the config can build a Hasher
+func (c Config) Validate() error {
+	if c.NumHashes <= 0 {
+		return fmt.Errorf("minhash needs a positive number of hashes, got %d", c.NumHashes)
+	}
+	if c.ShingleSize <= 0 {
+		return fmt.Errorf("minhash shingle size must be positive, got %d", c.ShingleSize)
+	}
+	if c.Bands <= 0 || c.NumHashes%c.Bands != 0 {
+		return fmt.Errorf("minhash bands (%d) must divide the number of hashes (%d)", c.Bands, c.NumHashes)
+	}
+	return nil
+}
+
+// Signature holds the minimum of each hash function over a text's shingles
+type Signature []uint64
+
+// Hasher computes MinHash signatures with k hash functions of the form
+// (a*x + b) mod p, each standing in for a random permutation of shingles
+type Hasher struct {
+	config Config
+	a, b   []uint64
+}
+
+// NewHasher creates a hasher whose coefficients are derived from cfg.Seed
+func NewHasher(cfg Config) (*Hasher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	h := &Hasher{
+		config: cfg,
+		a:      make([]uint64, cfg.NumHashes),
+		b:      make([]uint64, cfg.NumHashes),
+	}
+	for i := range h.a {
+		h.a[i] = 1 + uint64(rng.Int63n(mersenne61-1))
+		h.b[i] = uint64(rng.Int63n(mersenne61))
+	}
+	return h, nil
+}
+
+// Config returns the configuration the hasher was built with
+func (h *Hasher) Config() Config {
+	return h.config
+}
+
+// Signature computes the MinHash signature of text. A text without words
+// gets a signature of all math.MaxUint64.
+func (h *Hasher) Signature(text string) Signature {
+	sig := h.emptySignature()
+	for _, shingle := range Shingles(text, h.config.ShingleSize) {
+		h.add(sig, shingleHash(shingle))
+	}
+	return sig
+}
+
+// emptySignature returns the signature of a text without words
+func (h *Hasher) emptySignature() Signature {
+	sig := make(Signature, h.config.NumHashes)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	return sig
+}
+
+// add lowers sig to the hashes of the shingle hashed to x
+func (h *Hasher) add(sig Signature, x uint64) {
+	x %= mersenne61
+	for i := range sig {
+		if v := addMod(mulMod(h.a[i], x), h.b[i]); v < sig[i] {
+			sig[i] = v
+		}
+	}
+}
+
+// Writer computes a MinHash signature of the text written to it, holding
+// only the last few words rather than the whole text. A word is still held
+// whole until the whitespace after it arrives.
+type Writer struct {
+	hasher  *Hasher
+	sig     Signature
+	pending []byte   // Text after the last whitespace written
+	window  []string // The last ShingleSize words
+	words   int
+}
+
+// NewWriter starts a signature whose text is written in any number of
+// pieces; its Signature is the one Signature computes for the whole text
+func (h *Hasher) NewWriter() *Writer {
+	return &Writer{hasher: h, sig: h.emptySignature()}
+}
+
+// Write adds text to the signature. It never fails.
+func (w *Writer) Write(p []byte) (int, error) {
+	// Whitespace may have been split across writes, so the end of what
+	// was pending is scanned again
+	from := max(0, len(w.pending)-utf8.UTFMax+1)
+	w.pending = append(w.pending, p...)
+	i := bytes.LastIndexFunc(w.pending[from:], unicode.IsSpace)
+	if i < 0 {
+		return len(p), nil
+	}
+	end := from + i
+	_, size := utf8.DecodeRune(w.pending[end:])
+	end += size
+
+	for _, word := range strings.Fields(string(w.pending[:end])) {
+		w.addWord(word)
+	}
+	w.pending = w.pending[:copy(w.pending, w.pending[end:])]
+	return len(p), nil
+}
+
+// addWord adds the shingle a word completes
+func (w *Writer) addWord(word string) {
+	word = strings.ToLower(strings.Trim(word, ".,!?:;\"'()[]{}"))
+	if word == "" {
+		return
+	}
+	size := w.hasher.config.ShingleSize
+	if len(w.window) == size {
+		w.window = append(w.window[:0], w.window[1:]...)
+	}
+	w.window = append(w.window, word)
+	w.words++
+	if w.words >= size {
+		w.hasher.add(w.sig, windowHash(w.window))
+	}
+}
+
+// Signature returns the signature of the text written so far, ending with
+// the word the last write ended in. Nothing may be written after it.
+func (w *Writer) Signature() Signature {
+	for _, word := range strings.Fields(string(w.pending)) {
+		w.addWord(word)
+	}
+	w.pending = nil
+	// A text shorter than one shingle is a single shingle of all its words
+	if w.words > 0 && w.words < w.hasher.config.ShingleSize {
+		w.hasher.add(w.sig, windowHash(w.window))
+	}
+	return w.sig
+}
+
+// Shingles returns the overlapping runs of size words in text, lower-cased
+// and without surrounding punctuation. Texts shorter than one shingle
+// produce a single shingle of all their words.
+func Shingles(text string, size int) []string {
+	var words []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ToLower(strings.Trim(word, ".,!?:;\"'()[]{}"))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) <= size {
+		return []string{strings.Join(words, " ")}
+	}
+
+	shingles := make([]string, 0, len(words)-size+1)
+	for i := 0; i+size <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+size], " "))
+	}
+	return shingles
+}
+
+// Jaccard estimates the Jaccard similarity of the texts behind two
+// signatures as the fraction of positions where they agree
+func Jaccard(a, b Signature) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// shingleHash maps a shingle to 64 bits
+func shingleHash(shingle string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(shingle))
+	return h.Sum64()
+}
+
+// windowHash hashes the shingle of words joined by spaces
+func windowHash(words []string) uint64 {
+	h := fnv.New64a()
+	for i, word := range words {
+		if i > 0 {
+			h.Write([]byte{' '})
+		}
+		h.Write([]byte(word))
+	}
+	return h.Sum64()
+}
+
+// mulMod returns a*b mod 2^61-1 for a, b below the modulus
+func mulMod(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	r := (lo & mersenne61) + (lo>>61 | hi<<3)
+	if r >= mersenne61 {
+		r -= mersenne61
+	}
+	return r
+}
+
+// addMod returns a+b mod 2^61-1 for a, b below the modulus
+func addMod(a, b uint64) uint64 {
+	r := a + b
+	if r >= mersenne61 {
+		r -= mersenne61
+	}
+	return r
+}
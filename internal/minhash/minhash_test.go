@@ -0,0 +1,139 @@
+package minhash
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShingles(t *testing.T) {
+	tests := []struct {
+		text string
+		size int
+		want []string
+	}{
+		{"", 3, nil},
+		{"Hello, world!", 3, []string{"hello world"}},
+		{"the quick brown fox", 3, []string{"the quick brown", "quick brown fox"}},
+		{"A b. A b", 1, []string{"a", "b", "a", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := Shingles(tt.text, tt.size); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Shingles(%q, %d) = %q, want %q", tt.text, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		wantErr bool
+	}{
+		{DefaultConfig(), false},
+		{NewConfig(10, 2), false},
+		{Config{}, true},
+		{Config{NumHashes: 128, ShingleSize: 0, Bands: 32}, true},
+		{Config{NumHashes: 128, ShingleSize: 3, Bands: 30}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSignatureDeterministic(t *testing.T) {
+	text := "the quick brown fox jumps over the lazy dog"
+	h1, err := NewHasher(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := NewHasher(DefaultConfig())
+	if !reflect.DeepEqual(h1.Signature(text), h2.Signature(text)) {
+		t.Error("hashers with the same config produced different signatures")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Seed = 2
+	h3, _ := NewHasher(cfg)
+	if reflect.DeepEqual(h1.Signature(text), h3.Signature(text)) {
+		t.Error("hashers with different seeds produced the same signature")
+	}
+}
+
+func TestWriterMatchesSignature(t *testing.T) {
+	texts := []string{
+		"",
+		"   ",
+		"Hello, world!",
+		"the quick brown fox jumps over the lazy dog",
+		"  (Leading) and trailing   punctuation... ",
+		"全角\u3000スペース\u3000で区切る\u3000言葉",
+		strings.Repeat("one two three, four five. ", 50),
+	}
+	h, err := NewHasher(NewConfig(16, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range texts {
+		want := h.Signature(text)
+		// Pieces of every size cut words, and multi-byte spaces, apart
+		for _, size := range []int{1, 2, 5, len(text) + 1} {
+			w := h.NewWriter()
+			for rest := text; rest != ""; {
+				n := min(size, len(rest))
+				w.Write([]byte(rest[:n]))
+				rest = rest[n:]
+			}
+			if got := w.Signature(); !reflect.DeepEqual(got, want) {
+				t.Errorf("%q written %d bytes at a time: signature differs from Signature", text, size)
+			}
+		}
+	}
+}
+
+func TestJaccardEstimate(t *testing.T) {
+	// a and b share 100 of 300 distinct words
+	var a, b []string
+	for i := 0; i < 200; i++ {
+		a = append(a, fmt.Sprintf("w%d", i))
+	}
+	b = append(b, a[:100]...)
+	for i := 0; i < 100; i++ {
+		b = append(b, fmt.Sprintf("x%d", i))
+	}
+
+	hasher, _ := NewHasher(Config{NumHashes: 256, ShingleSize: 1, Seed: 1, Bands: 64})
+	sigA := hasher.Signature(strings.Join(a, " "))
+	sigB := hasher.Signature(strings.Join(b, " "))
+
+	want := 100.0 / 300.0
+	if got := Jaccard(sigA, sigB); math.Abs(got-want) > 0.1 {
+		t.Errorf("Jaccard = %.3f, want about %.3f", got, want)
+	}
+	if got := Jaccard(sigA, sigA); got != 1 {
+		t.Errorf("Jaccard of identical signatures = %v, want 1", got)
+	}
+	if got := Jaccard(sigA, sigA[:10]); got != 0 {
+		t.Errorf("Jaccard of mismatched lengths = %v, want 0", got)
+	}
+}
+
+func TestMulMod(t *testing.T) {
+	tests := []struct{ a, b, want uint64 }{
+		{0, 5, 0},
+		{mersenne61 - 1, mersenne61 - 1, 1},
+		{1 << 60, 2, 1},
+		{123456789, 987654321, 123456789 * 987654321 % mersenne61},
+	}
+	for _, tt := range tests {
+		if got := mulMod(tt.a, tt.b); got != tt.want {
+			t.Errorf("mulMod(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package simhash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultConfidence is the confidence level of similarity intervals
+const DefaultConfidence = 0.95
+
+// Estimate is a similarity estimated from the Hamming distance between two
+// fingerprints, with a confidence interval
+type Estimate struct {
+	Similarity float64 // Point estimate, a cosine similarity unless fitted to other labels
+	Low        float64
+	High       float64
+	Confidence float64
+	Distance   int
+	Bits       int
+}
+
+// String formats the estimate as percentages with its interval
+func (e Estimate) String() string {
+	return fmt.Sprintf("%.2f%% (%.0f%% CI %.2f%% to %.2f%%)",
+		100*e.Similarity, 100*e.Confidence, 100*e.Low, 100*e.High)
+}
+
+// CalibrationPoint is a point of a fitted calibration curve
+type CalibrationPoint struct {
+	Fraction   float64 `json:"fraction"` // Hamming distance over fingerprint width
+	Similarity float64 `json:"similarity"`
+}
+
+// CalibrationSample is a labelled pair of fingerprints
+type CalibrationSample struct {
+	Distance   int
+	Bits       int
+	Similarity float64 // The similarity the pair should be reported with
+}
+
+// Calibration maps Hamming distance to similarity. Without fitted points it
+// uses the angle formula for random hyperplanes: each bit differs with
+// probability θ/π, where θ is the angle between the two vectors, so a
+// distance of d out of n bits estimates a cosine of cos(πd/n). Charikar
+// fingerprints follow the formula approximately.
+type Calibration struct {
+	Model      string             `json:"model,omitempty"` // ID of the model the curve was fitted on
+	Confidence float64            `json:"confidence"`
+	Points     []CalibrationPoint `json:"points,omitempty"` // Fitted curve, ordered by fraction
+	Spread     float64            `json:"spread,omitempty"` // Standard deviation of the labels around the curve
+	Samples    int                `json:"samples,omitempty"`
+}
+
+// AngleCalibration returns the calibration that uses the angle formula
+func AngleCalibration() Calibration {
+	return Calibration{Confidence: DefaultConfidence}
+}
+
+// Fitted reports whether the calibration was fitted on labelled samples
+func (c Calibration) Fitted() bool {
+	return len(c.Points) > 0
+}
+
+// Label names what the estimates of the calibration measure
+func (c Calibration) Label() string {
+	if c.Fitted() {
+		return "Calibrated similarity"
+	}
+	return "Estimated cosine similarity"
+}
+
+// z returns the normal quantile of the two-sided confidence level
+func (c Calibration) z() float64 {
+	confidence := c.Confidence
+	if confidence <= 0 || confidence >= 1 {
+		confidence = DefaultConfidence
+	}
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// Estimate returns the similarity of two fingerprints that differ in
+// distance of bits bits
+func (c Calibration) Estimate(distance, bits int) Estimate {
+	e := Estimate{Confidence: c.Confidence, Distance: distance, Bits: bits}
+	if e.Confidence <= 0 || e.Confidence >= 1 {
+		e.Confidence = DefaultConfidence
+	}
+	if bits <= 0 {
+		e.Similarity, e.Low, e.High = 1, 1, 1
+		return e
+	}
+
+	p := float64(distance) / float64(bits)
+	z := c.z()
+	if c.Fitted() {
+		e.Similarity = c.interpolate(p)
+		e.Low = math.Max(-1, e.Similarity-z*c.Spread)
+		e.High = math.Min(1, e.Similarity+z*c.Spread)
+		return e
+	}
+
+	// The Wilson interval of the bit flip probability maps to a cosine
+	// interval, with the bounds swapped because cos falls as p rises
+	low, high := wilsonInterval(p, bits, z)
+	e.Similarity = math.Cos(math.Pi * p)
+	e.Low = math.Cos(math.Pi * high)
+	e.High = math.Cos(math.Pi * low)
+	return e
+}
+
+// EstimateFingerprints returns the similarity of two fingerprints
+func (c Calibration) EstimateFingerprints(a, b Fingerprint) Estimate {
+	return c.Estimate(a.HammingDistance(b), a.Bits())
+}
+
+// wilsonInterval returns the Wilson score interval of a proportion p
+// observed over n trials
+func wilsonInterval(p float64, n int, z float64) (low, high float64) {
+	nf := float64(n)
+	z2 := z * z
+	center := (p + z2/(2*nf)) / (1 + z2/nf)
+	margin := z / (1 + z2/nf) * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// interpolate reads the fitted curve at distance fraction p, holding the
+// end values beyond the first and last points
+func (c Calibration) interpolate(p float64) float64 {
+	points := c.Points
+	if p <= points[0].Fraction {
+		return points[0].Similarity
+	}
+	last := points[len(points)-1]
+	if p >= last.Fraction {
+		return last.Similarity
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i].Fraction >= p })
+	a, b := points[i-1], points[i]
+	t := (p - a.Fraction) / (b.Fraction - a.Fraction)
+	return a.Similarity + t*(b.Similarity-a.Similarity)
+}
+
+// FitCalibration fits a calibration curve to labelled samples. The curve is
+// the isotonic regression of the labels on the distance fraction, so more
+// distant pairs are never reported as more similar, and the interval is the
+// spread of the labels around it.
+func FitCalibration(samples []CalibrationSample, confidence float64) (Calibration, error) {
+	if len(samples) < 2 {
+		return Calibration{}, fmt.Errorf("fitting a calibration needs at least 2 samples, got %d", len(samples))
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return Calibration{}, fmt.Errorf("confidence must be between 0 and 1, got %g", confidence)
+	}
+
+	type block struct {
+		fraction, similarity, weight float64
+	}
+	sorted := make([]block, 0, len(samples))
+	for _, s := range samples {
+		if s.Bits <= 0 || s.Distance < 0 || s.Distance > s.Bits {
+			return Calibration{}, fmt.Errorf("invalid sample: distance %d of %d bits", s.Distance, s.Bits)
+		}
+		sorted = append(sorted, block{float64(s.Distance) / float64(s.Bits), s.Similarity, 1})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].fraction < sorted[j].fraction })
+
+	// Pool adjacent blocks until the labels never rise with distance
+	var blocks []block
+	for _, b := range sorted {
+		blocks = append(blocks, b)
+		for n := len(blocks); n > 1; n = len(blocks) {
+			prev, cur := blocks[n-2], blocks[n-1]
+			if prev.fraction != cur.fraction && prev.similarity >= cur.similarity {
+				break
+			}
+			w := prev.weight + cur.weight
+			blocks[n-2] = block{
+				fraction:   (prev.fraction*prev.weight + cur.fraction*cur.weight) / w,
+				similarity: (prev.similarity*prev.weight + cur.similarity*cur.weight) / w,
+				weight:     w,
+			}
+			blocks = blocks[:n-1]
+		}
+	}
+
+	c := Calibration{Confidence: confidence, Samples: len(samples)}
+	for _, b := range blocks {
+		c.Points = append(c.Points, CalibrationPoint{Fraction: b.fraction, Similarity: b.similarity})
+	}
+
+	var squares float64
+	for _, b := range sorted {
+		residual := b.similarity - c.interpolate(b.fraction)
+		squares += residual * residual
+	}
+	c.Spread = math.Sqrt(squares / float64(len(sorted)))
+	return c, nil
+}
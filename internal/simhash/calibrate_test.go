@@ -0,0 +1,132 @@
+package simhash
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAngleCalibration(t *testing.T) {
+	c := AngleCalibration()
+
+	tests := []struct {
+		distance, bits int
+		want           float64
+	}{
+		{0, 64, 1},
+		{32, 64, 0},
+		{64, 64, -1},
+		{16, 64, math.Cos(math.Pi / 4)},
+		{8, 256, math.Cos(math.Pi / 32)},
+	}
+	for _, tt := range tests {
+		e := c.Estimate(tt.distance, tt.bits)
+		if math.Abs(e.Similarity-tt.want) > 1e-9 {
+			t.Errorf("Estimate(%d, %d) = %.4f, want %.4f", tt.distance, tt.bits, e.Similarity, tt.want)
+		}
+		if e.Low > e.Similarity || e.High < e.Similarity || e.Low < -1 || e.High > 1 {
+			t.Errorf("Estimate(%d, %d) interval [%.4f, %.4f] does not hold %.4f", tt.distance, tt.bits, e.Low, e.High, e.Similarity)
+		}
+	}
+
+	// More bits narrow the interval
+	narrow, wide := c.Estimate(64, 256), c.Estimate(16, 64)
+	if narrow.High-narrow.Low >= wide.High-wide.Low {
+		t.Errorf("256-bit interval %v is not narrower than 64-bit %v", narrow, wide)
+	}
+	if !strings.Contains(wide.String(), "95% CI") {
+		t.Errorf("String() = %q", wide.String())
+	}
+}
+
+// The angle formula recovers the cosine of random vectors with the
+// interval's coverage
+func TestAngleCalibrationCoverage(t *testing.T) {
+	hyperplanes := GenerateHyperplanesWithSeed(VectorDimensions, 256, 3)
+	c := AngleCalibration()
+
+	covered := 0
+	trials := 100
+	for i := 0; i < trials; i++ {
+		a := GenerateHyperplanesWithSeed(VectorDimensions, 1, int64(1000+i))[0]
+		b := GenerateHyperplanesWithSeed(VectorDimensions, 1, int64(5000+i))[0]
+		// Mix the vectors so the cosines spread over the range
+		mix := float64(i) / float64(trials)
+		for j := range b {
+			b[j] = mix*a[j] + (1-mix)*b[j]
+		}
+
+		cosine, na, nb := 0.0, 0.0, 0.0
+		for j := range a {
+			cosine += a[j] * b[j]
+			na += a[j] * a[j]
+			nb += b[j] * b[j]
+		}
+		cosine /= math.Sqrt(na * nb)
+
+		fa, fb := NewFingerprint(256), NewFingerprint(256)
+		for bit, plane := range hyperplanes {
+			if dot(a, plane) >= 0 {
+				fa.SetBit(bit)
+			}
+			if dot(b, plane) >= 0 {
+				fb.SetBit(bit)
+			}
+		}
+		if e := c.EstimateFingerprints(fa, fb); e.Low <= cosine && cosine <= e.High {
+			covered++
+		}
+	}
+	if covered < 85 {
+		t.Errorf("interval covered the true cosine %d of %d times", covered, trials)
+	}
+}
+
+func TestFitCalibration(t *testing.T) {
+	samples := []CalibrationSample{
+		{Distance: 0, Bits: 64, Similarity: 1},
+		{Distance: 4, Bits: 64, Similarity: 0.9},
+		{Distance: 8, Bits: 64, Similarity: 0.7},
+		{Distance: 9, Bits: 64, Similarity: 0.8}, // Violates the order and is pooled
+		{Distance: 32, Bits: 64, Similarity: 0},
+	}
+	c, err := FitCalibration(samples, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Fitted() || c.Samples != 5 || c.Label() != "Calibrated similarity" {
+		t.Fatalf("FitCalibration() = %+v", c)
+	}
+	if len(c.Points) != 4 {
+		t.Fatalf("Points = %v, want the violating pair pooled", c.Points)
+	}
+	for i := 1; i < len(c.Points); i++ {
+		if c.Points[i].Similarity > c.Points[i-1].Similarity {
+			t.Errorf("curve rises at %v", c.Points[i])
+		}
+	}
+
+	if e := c.Estimate(0, 64); e.Similarity != 1 {
+		t.Errorf("Estimate(0) = %v", e)
+	}
+	if e := c.Estimate(64, 64); e.Similarity != 0 {
+		t.Errorf("Estimate beyond the last point = %v, want it held at 0", e)
+	}
+	// Widths are compared by fraction
+	if a, b := c.Estimate(2, 64), c.Estimate(8, 256); a.Similarity != b.Similarity {
+		t.Errorf("Estimate(2, 64) = %v, Estimate(8, 256) = %v", a, b)
+	}
+	if e := c.Estimate(16, 64); e.Low >= e.Similarity || e.High <= e.Similarity || e.Confidence != 0.9 {
+		t.Errorf("Estimate(16) = %+v, want an interval from the spread", e)
+	}
+
+	if _, err := FitCalibration(samples[:1], 0.9); err == nil {
+		t.Error("expected error for a single sample")
+	}
+	if _, err := FitCalibration([]CalibrationSample{{Distance: 70, Bits: 64}, {}}, 0.9); err == nil {
+		t.Error("expected error for a distance wider than the fingerprint")
+	}
+	if _, err := FitCalibration(samples, 1); err == nil {
+		t.Error("expected error for confidence 1")
+	}
+}
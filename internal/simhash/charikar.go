@@ -0,0 +1,186 @@
+package simhash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Algorithm selects how the features of a text become a fingerprint
+type Algorithm string
+
+const (
+	// Hyperplane projects the bucketed feature vector onto random hyperplanes
+	Hyperplane Algorithm = "hyperplane"
+	// Charikar hashes every feature to 64 bits and sums its weight, positive
+	// or negative, into each bit. It needs no hyperplanes.
+	Charikar Algorithm = "charikar"
+)
+
+// DefaultAlgorithm is assumed for indexes built before the algorithm was recorded
+const DefaultAlgorithm = Hyperplane
+
+// ParseAlgorithm parses an algorithm name; the empty string selects the default
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch Algorithm(name) {
+	case "":
+		return DefaultAlgorithm, nil
+	case Hyperplane, Charikar:
+		return Algorithm(name), nil
+	}
+	return "", fmt.Errorf("unknown fingerprint algorithm %q (available: %s, %s)", name, Hyperplane, Charikar)
+}
+
+// FeatureExtractor is implemented by vectorizers that can expose their
+// weighted features before they are folded into vector dimensions
+type FeatureExtractor interface {
+	Features(text string) map[string]float64
+}
+
+// CalculateWithAlgorithm computes a 64-bit fingerprint with the given
+// algorithm. Charikar ignores the hyperplanes.
+func CalculateWithAlgorithm(algorithm Algorithm, text string, hyperplanes [][]float64, vectorizer Vectorizer) SimHash {
+	return CalculateFingerprint(algorithm, DefaultFingerprintBits, text, hyperplanes, vectorizer).SimHash()
+}
+
+// CalculateCharikar computes the classic 64-bit SimHash of Charikar (2002)
+func CalculateCharikar(text string, vectorizer Vectorizer) SimHash {
+	return charikarFingerprint(text, vectorizer, DefaultFingerprintBits).SimHash()
+}
+
+// charikarFingerprint sums the weight of every feature into each bit, adding
+// it where the feature's hash has a one and subtracting it otherwise.
+// Features are summed in sorted order: weights that are not whole numbers
+// can round differently in another order and tip a bit whose sum is near
+// zero.
+func charikarFingerprint(text string, vectorizer Vectorizer, width int) Fingerprint {
+	features := vectorFeatures(vectorizer, text)
+	sums := newCharikarSums(width)
+	for _, feature := range sortedKeys(features) {
+		sums.AddFeature(feature, features[feature])
+	}
+	return sums.fingerprint()
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// charikarSums holds the weight summed into each bit of a Charikar fingerprint
+type charikarSums []float64
+
+func newCharikarSums(width int) charikarSums {
+	return make(charikarSums, width)
+}
+
+// AddFeature adds weight to the bits where the feature's hash has a one and
+// subtracts it from the others
+func (sums charikarSums) AddFeature(feature string, weight float64) {
+	base := featureHash(feature)
+	for word := 0; word*64 < len(sums); word++ {
+		h := mix64(base + uint64(word)*0x9e3779b97f4a7c15)
+		for bit := 0; bit < 64; bit++ {
+			if h&(1<<bit) != 0 {
+				sums[word*64+bit] += weight
+			} else {
+				sums[word*64+bit] -= weight
+			}
+		}
+	}
+}
+
+// fingerprint sets the bits whose sum is positive
+func (sums charikarSums) fingerprint() Fingerprint {
+	fp := NewFingerprint(len(sums))
+	for bit, sum := range sums {
+		if sum > 0 {
+			fp.SetBit(bit)
+		}
+	}
+	return fp
+}
+
+// vectorFeatures returns the features of text, using the vector dimensions
+// of vectorizers that are not a FeatureExtractor
+func vectorFeatures(vectorizer Vectorizer, text string) map[string]float64 {
+	if fe, ok := vectorizer.(FeatureExtractor); ok {
+		return fe.Features(text)
+	}
+	features := make(map[string]float64)
+	for i, v := range vectorizer.TextToVector(text) {
+		if v != 0 {
+			features[strconv.Itoa(i)] = v
+		}
+	}
+	return features
+}
+
+// featureHash maps a feature to 64 bits with FNV-1a
+func featureHash(feature string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	return h.Sum64()
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone leaves short strings poorly
+// spread, and adding a multiple of the golden ratio before mixing derives
+// the extra words of wide fingerprints.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Features returns the word counts of text
+func (fv *FrequencyVectorizer) Features(text string) map[string]float64 {
+	counts := newFeatureCounts()
+	fv.countFeatures(text, counts)
+	return counts.features
+}
+
+// countFeatures adds the word counts of text to counts
+func (fv *FrequencyVectorizer) countFeatures(text string, counts *featureCounts) {
+	counts.tokens = appendTokens(counts.tokens[:0], fv.tokenizer, text)
+	for _, token := range counts.tokens {
+		counts.add(token, 1)
+	}
+}
+
+// Features returns the n-gram counts of text, or its word counts when the
+// text is shorter than one n-gram
+func (nv *NGramVectorizer) Features(text string) map[string]float64 {
+	counts := newFeatureCounts()
+	nv.countFeatures(text, counts)
+	return counts.features
+}
+
+// Features returns the TF-IDF weight of every word in text
+func (tv *TFIDFVectorizer) Features(text string) map[string]float64 {
+	counts := newFeatureCounts()
+	tv.countFeatures(text, counts)
+	return counts.features
+}
+
+// countFeatures sets the TF-IDF weight of every word of text in the
+// features of counts, which must be empty. The weights are not whole
+// numbers, so they are never added straight to dimensions.
+func (tv *TFIDFVectorizer) countFeatures(text string, counts *featureCounts) {
+	counts.tokens = appendTokens(counts.tokens[:0], tv.tokenizer, text)
+	features := counts.features
+	for _, token := range counts.tokens {
+		features[token]++
+	}
+	for word, freq := range features {
+		features[word] = freq * tv.IDF(word)
+	}
+}
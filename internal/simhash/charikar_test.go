@@ -0,0 +1,93 @@
+package simhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Algorithm
+		wantErr bool
+	}{
+		{"", Hyperplane, false},
+		{"hyperplane", Hyperplane, false},
+		{"charikar", Charikar, false},
+		{"minhash", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v, want %q (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCalculateCharikar(t *testing.T) {
+	base := "the quick brown fox jumps over the lazy dog while the farmer sleeps in the afternoon sun"
+	similar := "the quick brown fox jumps over the lazy cat while the farmer sleeps in the afternoon sun"
+	different := "quarterly revenue grew by twelve percent driven by strong demand for cloud services"
+
+	vectorizer := NewFrequencyVectorizer(VectorDimensions)
+	h := CalculateCharikar(base, vectorizer)
+
+	if again := CalculateCharikar(base, vectorizer); again != h {
+		t.Errorf("hash is not deterministic: %x != %x", again, h)
+	}
+
+	near := h.HammingDistance(CalculateCharikar(similar, vectorizer))
+	far := h.HammingDistance(CalculateCharikar(different, vectorizer))
+	if near >= far {
+		t.Errorf("similar text distance %d should be below different text distance %d", near, far)
+	}
+
+	if got := CalculateCharikar("", vectorizer); got != 0 {
+		t.Errorf("empty text hash = %x, want 0", got)
+	}
+}
+
+// vectorOnly hides the Features method of the wrapped vectorizer
+type vectorOnly struct{ Vectorizer }
+
+func TestCalculateCharikarWithoutFeatures(t *testing.T) {
+	text := "some text with a handful of words in it"
+	vectorizer := vectorOnly{NewFrequencyVectorizer(VectorDimensions)}
+
+	if CalculateCharikar(text, vectorizer) != CalculateCharikar(text, vectorizer) {
+		t.Error("hash from vector dimensions is not deterministic")
+	}
+}
+
+func TestCalculateWithAlgorithm(t *testing.T) {
+	text := "hyperplanes are ignored by the charikar algorithm"
+	vectorizer := NewNGramVectorizer(VectorDimensions, 3)
+	hyperplanes := GenerateHyperplanes(VectorDimensions, NumHyperplanes)
+
+	if got, want := CalculateWithAlgorithm(Charikar, text, nil, vectorizer), CalculateCharikar(text, vectorizer); got != want {
+		t.Errorf("charikar = %x, want %x", got, want)
+	}
+	if got, want := CalculateWithAlgorithm(Hyperplane, text, hyperplanes, vectorizer), CalculateWithVectorizer(text, hyperplanes, vectorizer); got != want {
+		t.Errorf("hyperplane = %x, want %x", got, want)
+	}
+}
+
+var benchmarkText = strings.Repeat("the quick brown fox jumps over the lazy dog and keeps running ", 64)
+
+func BenchmarkHyperplane(b *testing.B) {
+	vectorizer := NewFrequencyVectorizer(VectorDimensions)
+	hyperplanes := GenerateHyperplanes(VectorDimensions, NumHyperplanes)
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		CalculateWithVectorizer(benchmarkText, hyperplanes, vectorizer)
+	}
+}
+
+func BenchmarkCharikar(b *testing.B) {
+	vectorizer := NewFrequencyVectorizer(VectorDimensions)
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		CalculateCharikar(benchmarkText, vectorizer)
+	}
+}
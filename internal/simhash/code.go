@@ -0,0 +1,430 @@
+package simhash
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CodeNormalizer is the normalization used with the code vectorizer when
+// none is given. Line breaks end comments and Go statements, and case is
+// significant, so neither is folded away.
+const CodeNormalizer = "nfkc,punct"
+
+// CodeVectorizer counts k-token shingles of source code, hashed into a fixed
+// number of dimensions. Comments and layout are dropped, and identifiers and
+// literals can be replaced by their kind, so renaming variables or
+// reformatting a copied function leaves its fingerprint unchanged.
+type CodeVectorizer struct {
+	dimensions int
+	size       int
+	language   string // "go", "c" or "auto"
+	idents     bool   // Replace identifiers by $id
+	literals   bool   // Replace literals by $str, $char and $num
+}
+
+// codeLanguages are the languages the code vectorizer can lex; "c" covers
+// the C family: C, C++, Java, C#, JavaScript, Rust and the like
+var codeLanguages = []string{"auto", "go", "c"}
+
+func init() {
+	RegisterVectorizer("code",
+		map[string]string{"dims": "256", "k": "4", "lang": "auto", "idents": "true", "literals": "true"},
+		func(p VectorizerParams) (Vectorizer, error) {
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			k, err := p.Int("k")
+			if err != nil || k <= 0 {
+				return nil, fmt.Errorf("code shingle size must be a positive integer, got %q", p["k"])
+			}
+			idents, err := p.Bool("idents")
+			if err != nil {
+				return nil, err
+			}
+			literals, err := p.Bool("literals")
+			if err != nil {
+				return nil, err
+			}
+			return NewCodeVectorizer(dims, k, p["lang"], idents, literals)
+		})
+}
+
+// NewCodeVectorizer creates a vectorizer over shingles of size tokens of
+// code in language, which "auto" detects per text. Chunks of one source
+// should share a language; see VectorizerConfig.ForSource.
+func NewCodeVectorizer(dimensions, size int, language string, idents, literals bool) (*CodeVectorizer, error) {
+	known := false
+	for _, l := range codeLanguages {
+		known = known || l == language
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown code language %q (available: %s)", language, strings.Join(codeLanguages, ", "))
+	}
+	return &CodeVectorizer{dimensions: dimensions, size: size, language: language, idents: idents, literals: literals}, nil
+}
+
+// codeTokenKind classifies a token for normalization
+type codeTokenKind int
+
+const (
+	codeOperator codeTokenKind = iota
+	codeKeyword
+	codeIdent
+	codeString
+	codeChar
+	codeNumber
+)
+
+// codePlaceholders stand in for normalized identifiers and literals
+var codePlaceholders = map[codeTokenKind]string{
+	codeIdent:  "$id",
+	codeString: "$str",
+	codeChar:   "$char",
+	codeNumber: "$num",
+}
+
+// Tokens returns the tokens of code after dropping comments and layout and
+// normalizing identifiers and literals as configured
+func (cv *CodeVectorizer) Tokens(code string) []string {
+	lex := lexCFamily
+	if cv.language == "go" || cv.language == "auto" && isGoSource(code) {
+		lex = lexGo
+	}
+
+	var tokens []string
+	lex(code, func(kind codeTokenKind, text string) {
+		literal := kind == codeString || kind == codeChar || kind == codeNumber
+		if kind == codeIdent && cv.idents || literal && cv.literals {
+			text = codePlaceholders[kind]
+		}
+		tokens = append(tokens, text)
+	})
+	return tokens
+}
+
+// countFeatures adds the token shingle counts of code to counts. Code
+// shorter than one shingle is a single shingle of all its tokens.
+func (cv *CodeVectorizer) countFeatures(code string, counts *featureCounts) {
+	addShingles(cv.Tokens(code), cv.size, counts)
+}
+
+// TextToVector converts code to a normalized shingle vector
+func (cv *CodeVectorizer) TextToVector(code string) []float64 {
+	features := cv.Features(code)
+	vector := newHashedVector(cv.dimensions)
+	for _, shingle := range sortedKeys(features) {
+		vector.AddFeature(shingle, features[shingle])
+	}
+	return vector.normalized()
+}
+
+// Features returns the token shingle counts of code
+func (cv *CodeVectorizer) Features(code string) map[string]float64 {
+	counts := newFeatureCounts()
+	cv.countFeatures(code, counts)
+	return counts.features
+}
+
+// Dimensions returns the number of vector dimensions
+func (cv *CodeVectorizer) Dimensions() int {
+	return cv.dimensions
+}
+
+// SourceHeadSize is how much of the start of a source ForSource needs to
+// tell its language
+const SourceHeadSize = 64 * 1024
+
+// codeExtensions map file extensions to the language that lexes them
+var codeExtensions = map[string]string{
+	".go": "go", ".c": "c", ".h": "c", ".cc": "c", ".cpp": "c", ".cxx": "c",
+	".hpp": "c", ".java": "c", ".cs": "c", ".js": "c", ".jsx": "c", ".ts": "c",
+	".tsx": "c", ".rs": "c", ".kt": "c", ".scala": "c", ".swift": "c", ".m": "c",
+}
+
+// ForSource returns the config with the language of the code vectorizer
+// fixed for one source, when it is auto. Chunks of a file lex alike only
+// with one language, and only the first chunk of a Go file starts with its
+// package clause, so the language is taken from the extension of filename,
+// or else from head, the start of the source. Other configs are returned
+// as they are.
+func (c VectorizerConfig) ForSource(filename, head string) VectorizerConfig {
+	if c.Name != "code" {
+		return c
+	}
+	full, err := c.WithDefaults()
+	if err != nil || full.Params["lang"] != "auto" {
+		return c
+	}
+
+	language, ok := codeExtensions[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		language = "c"
+		if isGoSource(head) {
+			language = "go"
+		}
+	}
+	full.Params["lang"] = language
+	return full
+}
+
+// ForFile returns the config fixed for the file at path, as ForSource does
+func (c VectorizerConfig) ForFile(path string) (VectorizerConfig, error) {
+	if c.Name != "code" {
+		return c, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	head := make([]byte, SourceHeadSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return c, err
+	}
+	return c.ForSource(path, string(head[:n])), nil
+}
+
+// Selects reports whether asking for c builds the vectorizer of other,
+// which may have been fixed for a source: the code vectorizer with language
+// auto selects any language
+func (c VectorizerConfig) Selects(other VectorizerConfig) bool {
+	if c.Equal(other) {
+		return true
+	}
+	full, err := c.WithDefaults()
+	if err != nil || full.Name != "code" || full.Params["lang"] != "auto" {
+		return false
+	}
+	pinned, err := other.WithDefaults()
+	if err != nil || pinned.Name != "code" {
+		return false
+	}
+	full.Params["lang"] = pinned.Params["lang"]
+	return full.Equal(pinned)
+}
+
+// isGoSource reports whether code starts with a package clause, after any
+// comments, as every Go file does
+func isGoSource(code string) bool {
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(code))
+	s.Init(file, []byte(code), nil, 0)
+	_, first, _ := s.Scan()
+	_, second, _ := s.Scan()
+	return first == token.PACKAGE && second == token.IDENT
+}
+
+// lexGo hands the tokens of Go source to emit, using the Go scanner.
+// Semicolons are dropped, since most are inserted at line breaks.
+func lexGo(code string, emit func(kind codeTokenKind, text string)) {
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(code))
+	// Chunks of a file start and end anywhere, so errors are ignored
+	s.Init(file, []byte(code), func(token.Position, string) {}, 0)
+
+	for {
+		_, tok, lit := s.Scan()
+		switch {
+		case tok == token.EOF:
+			return
+		case tok == token.SEMICOLON:
+		case tok == token.IDENT:
+			emit(codeIdent, lit)
+		case tok.IsKeyword():
+			emit(codeKeyword, tok.String())
+		case tok == token.STRING:
+			emit(codeString, lit)
+		case tok == token.CHAR:
+			emit(codeChar, lit)
+		case tok.IsLiteral():
+			emit(codeNumber, lit)
+		case tok == token.ILLEGAL:
+			emit(codeOperator, lit)
+		default:
+			emit(codeOperator, tok.String())
+		}
+	}
+}
+
+// cKeywords are the keywords of the C family that the C lexer keeps when
+// identifiers are normalized. Type names such as int are among them, since
+// they carry the structure identifiers are stripped of.
+var cKeywords = makeSet(strings.Fields(`
+	abstract as async auto await bool boolean break byte case catch char class
+	const const_cast constexpr continue crate decltype default delete do double
+	dyn dynamic_cast else enum explicit export extends extern false final
+	finally float fn for foreach friend function goto if impl implements import
+	in inline instanceof int interface is let lock long loop match mod module
+	move mut namespace native new noexcept null nullptr operator out override
+	package private protected pub public readonly ref register reinterpret_cast
+	restrict return self short signed sizeof static static_cast strictfp struct
+	super switch synchronized template this throw throws trait transient true
+	try typedef typename typeof union unsafe unsigned use using var virtual void
+	volatile where while yield`))
+
+// cOperators are the multi-character operators of the C family, longest
+// first so the lexer takes the longest match
+var cOperators = []string{
+	">>>=",
+	"<<=", ">>=", ">>>", "...", "===", "!==", "**=", "&&=", "||=", "??=", "<=>", "->*",
+	"::", "->", "=>", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "??", "?.", "**", ".*",
+}
+
+// lexCFamily hands the tokens of C-family source to emit. It knows the
+// comment and literal syntax the family shares rather than any one grammar,
+// so it never fails.
+func lexCFamily(code string, emit func(kind codeTokenKind, text string)) {
+	for i := 0; i < len(code); {
+		c := code[i]
+		rest := code[i:]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 4
+		case c == '"' || c == '`':
+			n := quotedLength(rest, len(rest), c == '"')
+			emit(codeString, rest[:n])
+			i += n
+		case c == '\'':
+			if n := charLength(rest); n > 0 {
+				emit(codeChar, rest[:n])
+				i += n
+			} else {
+				emit(codeOperator, "'")
+				i++
+			}
+		case isDigit(c) || c == '.' && len(rest) > 1 && isDigit(rest[1]):
+			n := numberLength(rest)
+			emit(codeNumber, rest[:n])
+			i += n
+		default:
+			r, size := utf8.DecodeRuneInString(rest)
+			if isIdentStart(r) {
+				n := size
+				for n < len(rest) {
+					r, size := utf8.DecodeRuneInString(rest[n:])
+					if !isIdentStart(r) && !unicode.IsDigit(r) {
+						break
+					}
+					n += size
+				}
+				kind := codeIdent
+				if _, ok := cKeywords[rest[:n]]; ok {
+					kind = codeKeyword
+				}
+				emit(kind, rest[:n])
+				i += n
+				continue
+			}
+
+			op := rest[:size]
+			for _, candidate := range cOperators {
+				if strings.HasPrefix(rest, candidate) {
+					op = candidate
+					break
+				}
+			}
+			emit(codeOperator, op)
+			i += len(op)
+		}
+	}
+}
+
+// quotedLength returns the length of the literal opened by the quote at the
+// start of s, looking at most limit bytes ahead. Backslashes escape the next
+// byte. A literal that is not closed ends at the limit, or at the line end
+// when it must fit on one line.
+func quotedLength(s string, limit int, oneLine bool) int {
+	limit = min(limit, len(s))
+	for i := 1; i < limit; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			if oneLine {
+				return i
+			}
+		case s[0]:
+			return i + 1
+		}
+	}
+	return limit
+}
+
+// maxCharEscape is the longest escape in a character literal, \u{10FFFF}
+const maxCharEscape = 10
+
+// charLength returns the length of the character literal at the start of s,
+// or 0 when the quote does not open one, as for a Rust lifetime. A literal
+// holds one character or one escape.
+func charLength(s string) int {
+	if len(s) > 1 && s[1] == '\\' {
+		if n := quotedLength(s, 2+maxCharEscape, true); n > 3 && s[n-1] == '\'' {
+			return n
+		}
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(s[1:])
+	if size > 0 && len(s) > 1+size && s[1+size] == '\'' {
+		return size + 2
+	}
+	return 0
+}
+
+// numberLength returns the length of the number literal at the start of s:
+// digits, letters for bases, suffixes and exponents, dots, underscores and
+// the sign of a decimal exponent
+func numberLength(s string) int {
+	hex := strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		switch {
+		case isDigit(c) || c == '.' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case (c == '+' || c == '-') && n > 0 && !hex && (s[n-1] == 'e' || s[n-1] == 'E'):
+		case (c == '+' || c == '-') && n > 0 && hex && (s[n-1] == 'p' || s[n-1] == 'P'):
+		default:
+			return n
+		}
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+// makeSet returns the set of words
+func makeSet(words []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[w] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,183 @@
+package simhash
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodeTokensGo(t *testing.T) {
+	cv, err := NewCodeVectorizer(VectorDimensions, 4, "auto", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := `// Package demo is an example
+package demo
+
+/* Sum adds up values */
+func Sum(values []int) int {
+	total := 0 // running total
+	for _, v := range values { total += v * 2 }
+	return total + len("done") + 'x'
+}
+`
+	got := strings.Join(cv.Tokens(src), " ")
+	want := "package $id func $id ( $id [ ] $id ) $id { $id := $num for $id , $id := range $id { $id += $id * $num } " +
+		"return $id + $id ( $str ) + $char }"
+	if got != want {
+		t.Errorf("Tokens =\n%s\nwant\n%s", got, want)
+	}
+
+	raw, _ := NewCodeVectorizer(VectorDimensions, 4, "go", false, false)
+	if got := raw.Tokens(`x := "a" + 0x1F`); !reflect.DeepEqual(got, []string{"x", ":=", `"a"`, "+", "0x1F"}) {
+		t.Errorf("Tokens without normalization = %q", got)
+	}
+}
+
+func TestCodeTokensCFamily(t *testing.T) {
+	cv, _ := NewCodeVectorizer(VectorDimensions, 4, "auto", true, true)
+
+	src := `#include <stdio.h>
+/* multi-line
+   comment */
+static int count_chars(const char *s, char c) {
+	int n = 0; // matches so far
+	while (*s) { if (*s++ == c) n += 1; }
+	printf("%d\n", n >>= 1.5e-3);
+	return n != '\''; 
+}`
+	got := strings.Join(cv.Tokens(src), " ")
+	want := "# $id < $id . $id > static int $id ( const char * $id , char $id ) { int $id = $num ; " +
+		"while ( * $id ) { if ( * $id ++ == $id ) $id += $num ; } $id ( $str , $id >>= $num ) ; return $id != $char ; }"
+	if got != want {
+		t.Errorf("Tokens =\n%s\nwant\n%s", got, want)
+	}
+
+	// A Rust lifetime is not a character literal
+	if got := strings.Join(cv.Tokens("fn f<'a>(x: &'a str)"), " "); got != "fn $id < ' $id > ( $id : & ' $id $id )" {
+		t.Errorf("lifetime Tokens = %s", got)
+	}
+}
+
+func TestCodeVectorizerIgnoresRenamesAndLayout(t *testing.T) {
+	cv, _ := NewCodeVectorizer(VectorDimensions, 4, "auto", true, true)
+
+	tests := []struct {
+		name              string
+		original, renamed string
+		different         string
+	}{
+		{
+			name:      "go",
+			original:  "package a\n\nfunc max(a, b int) int {\n\tif a > b {\n\t\treturn a\n\t}\n\treturn b\n}\n",
+			renamed:   "package b\n// bigger returns the larger\nfunc bigger(x, y int) int { if x > y { return x }; return y }",
+			different: "package a\n\nfunc sum(xs []int) (t int) {\n\tfor _, x := range xs {\n\t\tt += x\n\t}\n\treturn\n}\n",
+		},
+		{
+			name:      "c",
+			original:  "int max(int a, int b) {\n  if (a > b)\n    return a;\n  return b;\n}",
+			renamed:   "int larger(int first, int second) { /* pick one */ if (first > second) return first; return second; }",
+			different: "int sum(int *xs, int n) { int t = 0; for (int i = 0; i < n; i++) t += xs[i]; return t; }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(cv.Features(tt.original), cv.Features(tt.renamed)) {
+				t.Errorf("renaming changed the features:\n%v\n%v", cv.Features(tt.original), cv.Features(tt.renamed))
+			}
+			if s := cosine(cv.TextToVector(tt.original), cv.TextToVector(tt.different)); s > 0.5 {
+				t.Errorf("different code has cosine %.2f", s)
+			}
+
+			// Keeping identifiers tells the renamed copy apart
+			raw, _ := NewCodeVectorizer(VectorDimensions, 4, tt.name, false, true)
+			if reflect.DeepEqual(raw.Features(tt.original), raw.Features(tt.renamed)) {
+				t.Error("features without identifier normalization should differ")
+			}
+		})
+	}
+}
+
+func TestCodeVectorizerRegistered(t *testing.T) {
+	cfg, err := ParseVectorizerConfig("code:lang=go,k=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.String(); got != "code:dims=256,idents=true,k=3,lang=go,literals=true" {
+		t.Errorf("String() = %q", got)
+	}
+	if DefaultNormalizerFor(cfg) != CodeNormalizer {
+		t.Errorf("DefaultNormalizerFor(%s) = %q, want %q", cfg, DefaultNormalizerFor(cfg), CodeNormalizer)
+	}
+	v, err := cfg.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv, ok := v.(*CodeVectorizer); !ok || cv.size != 3 || cv.language != "go" || !cv.idents {
+		t.Errorf("New() = %#v", v)
+	}
+
+	for _, spec := range []string{"code:lang=cobol", "code:k=0", "code:idents=maybe"} {
+		cfg, err := ParseVectorizerConfig(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.New(); err == nil {
+			t.Errorf("New() for %q should fail", spec)
+		}
+	}
+}
+
+func TestCodeVectorizerForSource(t *testing.T) {
+	auto, err := ParseVectorizerConfig("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filename string
+		head     string
+		want     string
+	}{
+		{"main.go", "// not even Go", "go"},
+		{"main.c", "package main", "c"},
+		{"-", "// Package a\npackage a\n\nfunc A() {}", "go"},
+		{"notes", "int main() { return 0; }", "c"},
+	}
+	for _, tt := range tests {
+		pinned := auto.ForSource(tt.filename, tt.head)
+		if got := pinned.Params["lang"]; got != tt.want {
+			t.Errorf("ForSource(%q, %q) lang = %q, want %q", tt.filename, tt.head, got, tt.want)
+		}
+		if !auto.Selects(pinned) {
+			t.Errorf("auto does not select %s", pinned)
+		}
+	}
+
+	// A Go file lexes as Go in every chunk, not only the one with its
+	// package clause
+	pinned := auto.ForSource("a.go", "package a")
+	v, err := pinned.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := "x := `raw\nstring`"
+	want := []string{"$id", ":=", "$str"}
+	if got := v.(*CodeVectorizer).Tokens(chunk); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokens(%q) = %q, want %q", chunk, got, want)
+	}
+
+	// Explicit languages and other vectorizers are left alone
+	goCfg, _ := ParseVectorizerConfig("code:lang=go")
+	if got := goCfg.ForSource("a.c", ""); !got.Equal(goCfg) {
+		t.Errorf("ForSource changed %s to %s", goCfg, got)
+	}
+	if goCfg.Selects(auto.ForSource("a.c", "")) {
+		t.Error("lang=go should not select lang=c")
+	}
+	ngram, _ := ParseVectorizerConfig("ngram")
+	if got := ngram.ForSource("a.go", "package a"); !got.Equal(ngram) {
+		t.Errorf("ForSource changed %s to %s", ngram, got)
+	}
+}
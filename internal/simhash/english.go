@@ -0,0 +1,343 @@
+package simhash
+
+import (
+	"strings"
+)
+
+// English is the language with Snowball English stopwords and the Porter2
+// stemmer, so "running", "runs" and "run" count as one word
+const English Language = "en"
+
+func init() {
+	RegisterLanguage(string(English), englishStopwords, StemEnglish)
+}
+
+// englishStopwords is the Snowball English stopword list
+var englishStopwords = strings.Fields(`
+	i me my myself we our ours ourselves you your yours yourself yourselves
+	he him his himself she her hers herself it its itself they them their
+	theirs themselves what which who whom this that these those am is are
+	was were be been being have has had having do does did doing would
+	should could ought i'm you're he's she's it's we're they're i've you've
+	we've they've i'd you'd he'd she'd we'd they'd i'll you'll he'll she'll
+	we'll they'll isn't aren't wasn't weren't hasn't haven't hadn't doesn't
+	don't didn't won't wouldn't shan't shouldn't can't cannot couldn't
+	mustn't let's that's who's what's here's there's when's where's why's
+	how's a an the and but if or because as until while of at by for with
+	about against between into through during before after above below to
+	from up down in out on off over under again further then once here
+	there when where why how all any both each few more most other some
+	such no nor not only own same so than too very
+`)
+
+// porter2Exceptions are words the Porter2 algorithm handles specially
+var porter2Exceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli",
+	"only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas",
+	"cosmos": "cosmos", "bias": "bias", "andes": "andes",
+}
+
+// porter2Invariant are left alone once step 1a has run
+var porter2Invariant = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+// StemEnglish reduces a lower-case English word to its stem with the
+// Snowball Porter2 algorithm. Words with characters outside a-z and the
+// apostrophe are returned unchanged.
+func StemEnglish(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if c := word[i]; (c < 'a' || c > 'z') && c != '\'' {
+			return word
+		}
+	}
+	if stem, ok := porter2Exceptions[word]; ok {
+		return stem
+	}
+
+	w := &porter2Word{b: []byte(strings.TrimPrefix(word, "'"))}
+	w.markConsonantY()
+	w.findRegions()
+
+	w.step0()
+	w.step1a()
+	if porter2Invariant[string(w.b)] {
+		return string(w.b)
+	}
+	w.step1b()
+	w.step1c()
+	w.step2()
+	w.step3()
+	w.step4()
+	w.step5()
+
+	return strings.ReplaceAll(string(w.b), "Y", "y")
+}
+
+// porter2Word is a word being stemmed, with consonant y written as Y and
+// the start of regions R1 and R2
+type porter2Word struct {
+	b      []byte
+	r1, r2 int
+}
+
+func isVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// markConsonantY writes Y for an initial y and for a y after a vowel
+func (w *porter2Word) markConsonantY() {
+	for i, c := range w.b {
+		if c == 'y' && (i == 0 || isVowel(w.b[i-1])) {
+			w.b[i] = 'Y'
+		}
+	}
+}
+
+// findRegions sets R1 to start after the first non-vowel following a vowel,
+// and R2 to the same within R1
+func (w *porter2Word) findRegions() {
+	w.r1 = len(w.b)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w.b), prefix) {
+			w.r1 = len(prefix)
+			break
+		}
+	}
+	if w.r1 == len(w.b) {
+		w.r1 = w.regionAfter(0)
+	}
+	w.r2 = w.regionAfter(w.r1)
+}
+
+// regionAfter returns the position after the first non-vowel that follows a
+// vowel at or after start
+func (w *porter2Word) regionAfter(start int) int {
+	for i := start + 1; i < len(w.b); i++ {
+		if !isVowel(w.b[i]) && isVowel(w.b[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w.b)
+}
+
+func (w *porter2Word) hasSuffix(s string) bool {
+	return strings.HasSuffix(string(w.b), s)
+}
+
+// longestSuffix returns the longest of suffixes the word ends with
+func (w *porter2Word) longestSuffix(suffixes ...string) string {
+	longest := ""
+	for _, s := range suffixes {
+		if len(s) > len(longest) && w.hasSuffix(s) {
+			longest = s
+		}
+	}
+	return longest
+}
+
+// inR1 and inR2 report whether a suffix of length n lies in the region
+func (w *porter2Word) inR1(n int) bool { return len(w.b)-n >= w.r1 }
+func (w *porter2Word) inR2(n int) bool { return len(w.b)-n >= w.r2 }
+
+// replace swaps a suffix of length n for repl
+func (w *porter2Word) replace(n int, repl string) {
+	w.b = append(w.b[:len(w.b)-n], repl...)
+}
+
+// containsVowel reports whether b[:end] has a vowel
+func (w *porter2Word) containsVowel(end int) bool {
+	for _, c := range w.b[:end] {
+		if isVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable reports whether b[:end] ends in a short syllable: a
+// vowel followed by a non-vowel other than w, x or Y and preceded by a
+// non-vowel, or a vowel then a non-vowel at the start of the word
+func (w *porter2Word) endsShortSyllable(end int) bool {
+	b := w.b[:end]
+	n := len(b)
+	if n == 2 {
+		return isVowel(b[0]) && !isVowel(b[1])
+	}
+	if n >= 3 {
+		c := b[n-1]
+		return !isVowel(b[n-3]) && isVowel(b[n-2]) && !isVowel(c) && c != 'w' && c != 'x' && c != 'Y'
+	}
+	return false
+}
+
+// isShort reports whether the word ends in a short syllable and R1 is empty
+func (w *porter2Word) isShort() bool {
+	return w.r1 >= len(w.b) && w.endsShortSyllable(len(w.b))
+}
+
+// step0 removes possessive apostrophes
+func (w *porter2Word) step0() {
+	if s := w.longestSuffix("'", "'s", "'s'"); s != "" {
+		w.replace(len(s), "")
+	}
+}
+
+// step1a handles plurals
+func (w *porter2Word) step1a() {
+	switch s := w.longestSuffix("sses", "ied", "ies", "s", "us", "ss"); s {
+	case "sses":
+		w.replace(4, "ss")
+	case "ied", "ies":
+		if len(w.b) > 4 {
+			w.replace(3, "i")
+		} else {
+			w.replace(3, "ie")
+		}
+	case "s":
+		if len(w.b) >= 3 && w.containsVowel(len(w.b)-2) {
+			w.replace(1, "")
+		}
+	}
+}
+
+// step1b handles past tenses and gerunds
+func (w *porter2Word) step1b() {
+	switch s := w.longestSuffix("eed", "eedly", "ed", "edly", "ing", "ingly"); s {
+	case "eed", "eedly":
+		if w.inR1(len(s)) {
+			w.replace(len(s), "ee")
+		}
+	case "ed", "edly", "ing", "ingly":
+		if !w.containsVowel(len(w.b) - len(s)) {
+			return
+		}
+		w.replace(len(s), "")
+		switch {
+		case w.hasSuffix("at"), w.hasSuffix("bl"), w.hasSuffix("iz"):
+			w.b = append(w.b, 'e')
+		case w.endsDouble():
+			w.b = w.b[:len(w.b)-1]
+		case w.isShort():
+			w.b = append(w.b, 'e')
+		}
+	}
+}
+
+// endsDouble reports whether the word ends in one of bb dd ff gg mm nn pp rr tt
+func (w *porter2Word) endsDouble() bool {
+	n := len(w.b)
+	if n < 2 || w.b[n-1] != w.b[n-2] {
+		return false
+	}
+	return strings.IndexByte("bdfgmnprt", w.b[n-1]) >= 0
+}
+
+// step1c turns a final y after a non-vowel into i, unless that non-vowel
+// starts the word
+func (w *porter2Word) step1c() {
+	n := len(w.b)
+	if n > 2 && (w.b[n-1] == 'y' || w.b[n-1] == 'Y') && !isVowel(w.b[n-2]) {
+		w.b[n-1] = 'i'
+	}
+}
+
+var porter2Step2 = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able",
+	"entli": "ent", "izer": "ize", "ization": "ize", "ational": "ate",
+	"ation": "ate", "ator": "ate", "alism": "al", "aliti": "al", "alli": "al",
+	"fulness": "ful", "ousli": "ous", "ousness": "ous", "iveness": "ive",
+	"iviti": "ive", "biliti": "ble", "bli": "ble", "fulli": "ful",
+	"lessli": "less", "ogi": "og", "li": "",
+}
+
+var porter2Step2Suffixes = mapKeys(porter2Step2)
+
+// step2 maps derivational suffixes in R1 to shorter forms
+func (w *porter2Word) step2() {
+	s := w.longestSuffix(porter2Step2Suffixes...)
+	if s == "" || !w.inR1(len(s)) {
+		return
+	}
+	switch s {
+	case "ogi":
+		if len(w.b) < 4 || w.b[len(w.b)-4] != 'l' {
+			return
+		}
+	case "li":
+		if len(w.b) < 3 || strings.IndexByte("cdeghkmnrt", w.b[len(w.b)-3]) < 0 {
+			return
+		}
+	}
+	w.replace(len(s), porter2Step2[s])
+}
+
+var porter2Step3 = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic",
+	"iciti": "ic", "ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+var porter2Step3Suffixes = mapKeys(porter2Step3)
+
+// step3 maps further suffixes in R1; ative must also be in R2
+func (w *porter2Word) step3() {
+	s := w.longestSuffix(porter2Step3Suffixes...)
+	if s == "" || !w.inR1(len(s)) || (s == "ative" && !w.inR2(len(s))) {
+		return
+	}
+	w.replace(len(s), porter2Step3[s])
+}
+
+var porter2Step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion",
+}
+
+// step4 deletes suffixes in R2; ion only after s or t
+func (w *porter2Word) step4() {
+	s := w.longestSuffix(porter2Step4Suffixes...)
+	if s == "" || !w.inR2(len(s)) {
+		return
+	}
+	if s == "ion" {
+		if len(w.b) < 4 || (w.b[len(w.b)-4] != 's' && w.b[len(w.b)-4] != 't') {
+			return
+		}
+	}
+	w.replace(len(s), "")
+}
+
+// step5 deletes a final e in R2, or in R1 when not after a short syllable,
+// and a final l in R2 after another l
+func (w *porter2Word) step5() {
+	n := len(w.b)
+	switch {
+	case w.hasSuffix("e"):
+		if w.inR2(1) || (w.inR1(1) && !w.endsShortSyllable(n-1)) {
+			w.b = w.b[:n-1]
+		}
+	case w.hasSuffix("ll"):
+		if w.inR2(1) {
+			w.b = w.b[:n-1]
+		}
+	}
+}
+
+// mapKeys returns the keys of a suffix table
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
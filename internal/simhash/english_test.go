@@ -0,0 +1,30 @@
+package simhash
+
+import (
+	"testing"
+)
+
+func TestStemEnglish(t *testing.T) {
+	// Expected stems from the Snowball English sample vocabulary
+	tests := map[string]string{
+		"consign": "consign", "consigned": "consign", "consignment": "consign",
+		"consistency": "consist", "consistently": "consist", "consists": "consist",
+		"consolation": "consol", "consolatory": "consolatori", "consolingly": "consol",
+		"consolidated": "consolid", "conspicuously": "conspicu", "conspiracy": "conspiraci",
+		"conspirators": "conspir", "constable": "constabl", "constancy": "constanc",
+		"knackeries": "knackeri", "kneaded": "knead", "knightly": "knight",
+		"knitting": "knit", "knives": "knive", "knocker": "knocker",
+		"caresses": "caress", "ponies": "poni", "ties": "tie", "cats": "cat",
+		"agreed": "agre", "hopping": "hop", "hoping": "hope", "falling": "fall",
+		"filing": "file", "cried": "cri", "sky": "sky", "dying": "die",
+		"running": "run", "runs": "run", "generously": "generous",
+		"communism": "communism", "by": "by", "say": "say", "succeeding": "succeed",
+		"café": "café",
+	}
+
+	for word, want := range tests {
+		if got := StemEnglish(word); got != want {
+			t.Errorf("StemEnglish(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
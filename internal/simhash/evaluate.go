@@ -0,0 +1,185 @@
+package simhash
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// LabelledPair is a pair of documents labelled as duplicates or not
+type LabelledPair struct {
+	A         string `json:"a"`
+	B         string `json:"b"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+// UnmarshalJSON decodes a pair, rejecting one without a label rather than
+// taking it for a pair of different documents
+func (p *LabelledPair) UnmarshalJSON(data []byte) error {
+	var pair struct {
+		A         string `json:"a"`
+		B         string `json:"b"`
+		Duplicate *bool  `json:"duplicate"`
+	}
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if pair.Duplicate == nil {
+		return errors.New(`pair has no "duplicate" label`)
+	}
+	*p = LabelledPair{A: pair.A, B: pair.B, Duplicate: *pair.Duplicate}
+	return nil
+}
+
+// PairResult is the Hamming distance of one labelled pair
+type PairResult struct {
+	Pair      int  `json:"pair"` // Position of the pair in the evaluated slice
+	Distance  int  `json:"distance"`
+	Duplicate bool `json:"duplicate"`
+}
+
+// ThresholdMetrics scores the rule "duplicate when the distance is at most
+// Threshold" against the labels
+type ThresholdMetrics struct {
+	Threshold         int     `json:"threshold"`
+	TruePositives     int     `json:"true_positives"`
+	FalsePositives    int     `json:"false_positives"`
+	TrueNegatives     int     `json:"true_negatives"`
+	FalseNegatives    int     `json:"false_negatives"`
+	Precision         float64 `json:"precision"`
+	Recall            float64 `json:"recall"` // Also the true positive rate of the ROC curve
+	F1                float64 `json:"f1"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// Evaluation holds the distances of labelled pairs and the metrics of every
+// threshold from 0 to the fingerprint width
+type Evaluation struct {
+	Bits       int                `json:"bits"`
+	Results    []PairResult       `json:"results"`
+	Thresholds []ThresholdMetrics `json:"thresholds"`
+	AUC        float64            `json:"auc"` // Area under the ROC curve
+}
+
+// Evaluate fingerprints every pair with the detector's settings and scores
+// each Hamming distance threshold against the labels
+func (ds *DocumentSimilarity) Evaluate(pairs []LabelledPair) Evaluation {
+	results := make([]PairResult, len(pairs))
+	for i, pair := range pairs {
+		results[i] = PairResult{
+			Pair:      i,
+			Distance:  ds.Fingerprint(pair.A).HammingDistance(ds.Fingerprint(pair.B)),
+			Duplicate: pair.Duplicate,
+		}
+	}
+	return NewEvaluation(ds.bits, results)
+}
+
+// NewEvaluation scores the distances of labelled pairs
+func NewEvaluation(bits int, results []PairResult) Evaluation {
+	e := Evaluation{Bits: bits, Results: results}
+
+	positives, negatives := 0, 0
+	dupAt := make([]int, bits+1)
+	otherAt := make([]int, bits+1)
+	for _, r := range results {
+		if r.Duplicate {
+			positives++
+			dupAt[r.Distance]++
+		} else {
+			negatives++
+			otherAt[r.Distance]++
+		}
+	}
+
+	tp, fp := 0, 0
+	for t := 0; t <= bits; t++ {
+		tp += dupAt[t]
+		fp += otherAt[t]
+		m := ThresholdMetrics{
+			Threshold:      t,
+			TruePositives:  tp,
+			FalsePositives: fp,
+			TrueNegatives:  negatives - fp,
+			FalseNegatives: positives - tp,
+		}
+		if tp+fp > 0 {
+			m.Precision = float64(tp) / float64(tp+fp)
+		}
+		if positives > 0 {
+			m.Recall = float64(tp) / float64(positives)
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		if negatives > 0 {
+			m.FalsePositiveRate = float64(fp) / float64(negatives)
+		}
+		e.Thresholds = append(e.Thresholds, m)
+	}
+
+	// The AUC is the chance that a duplicate pair is closer than a
+	// non-duplicate one, counting ties as half
+	if positives > 0 && negatives > 0 {
+		closerOthers := 0
+		var wins float64
+		for d := 0; d <= bits; d++ {
+			wins += float64(dupAt[d]) * (float64(negatives-closerOthers-otherAt[d]) + float64(otherAt[d])/2)
+			closerOthers += otherAt[d]
+		}
+		e.AUC = wins / float64(positives*negatives)
+	}
+	return e
+}
+
+// At returns the metrics of a threshold
+func (e Evaluation) At(threshold int) ThresholdMetrics {
+	threshold = max(0, min(threshold, len(e.Thresholds)-1))
+	return e.Thresholds[threshold]
+}
+
+// Best returns the threshold with the highest F1 score, the lowest on ties
+func (e Evaluation) Best() ThresholdMetrics {
+	best := e.Thresholds[0]
+	for _, m := range e.Thresholds[1:] {
+		if m.F1 > best.F1 {
+			best = m
+		}
+	}
+	return best
+}
+
+// ROC returns the points of the ROC curve where it moves, as thresholds
+// ordered from strictest to loosest
+func (e Evaluation) ROC() []ThresholdMetrics {
+	var points []ThresholdMetrics
+	for i, m := range e.Thresholds {
+		if i == 0 || m.TruePositives != e.Thresholds[i-1].TruePositives ||
+			m.FalsePositives != e.Thresholds[i-1].FalsePositives {
+			points = append(points, m)
+		}
+	}
+	return points
+}
+
+// Misclassified returns up to n pairs that threshold gets wrong, the ones
+// furthest on the wrong side of it first
+func (e Evaluation) Misclassified(threshold, n int) []PairResult {
+	var wrong []PairResult
+	for _, r := range e.Results {
+		if (r.Distance <= threshold) != r.Duplicate {
+			wrong = append(wrong, r)
+		}
+	}
+	margin := func(r PairResult) int {
+		if r.Duplicate {
+			return r.Distance - threshold
+		}
+		return threshold - r.Distance
+	}
+	sort.SliceStable(wrong, func(i, j int) bool { return margin(wrong[i]) > margin(wrong[j]) })
+	if len(wrong) > n {
+		wrong = wrong[:n]
+	}
+	return wrong
+}
@@ -0,0 +1,70 @@
+package simhash
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewEvaluation(t *testing.T) {
+	results := []PairResult{
+		{Pair: 0, Distance: 1, Duplicate: true},
+		{Pair: 1, Distance: 3, Duplicate: true},
+		{Pair: 2, Distance: 9, Duplicate: true},
+		{Pair: 3, Distance: 2, Duplicate: false},
+		{Pair: 4, Distance: 20, Duplicate: false},
+		{Pair: 5, Distance: 30, Duplicate: false},
+	}
+	e := NewEvaluation(64, results)
+	if len(e.Thresholds) != 65 {
+		t.Fatalf("got %d thresholds, want 65", len(e.Thresholds))
+	}
+
+	m := e.At(3)
+	if m.TruePositives != 2 || m.FalsePositives != 1 || m.TrueNegatives != 2 || m.FalseNegatives != 1 {
+		t.Errorf("At(3) = %+v", m)
+	}
+	if math.Abs(m.Precision-2.0/3) > 1e-9 || math.Abs(m.Recall-2.0/3) > 1e-9 || math.Abs(m.F1-2.0/3) > 1e-9 {
+		t.Errorf("At(3) scores = %+v", m)
+	}
+	if m.FalsePositiveRate != 1.0/3 {
+		t.Errorf("At(3) false positive rate = %v", m.FalsePositiveRate)
+	}
+
+	if best := e.Best(); best.Threshold != 9 || best.Recall != 1 {
+		t.Errorf("Best() = %+v, want threshold 9", best)
+	}
+	// 7 of the 9 duplicate/non-duplicate pairs are ordered correctly
+	if math.Abs(e.AUC-7.0/9) > 1e-9 {
+		t.Errorf("AUC = %v, want %v", e.AUC, 7.0/9)
+	}
+
+	roc := e.ROC()
+	if len(roc) != 7 || roc[0].Threshold != 0 || roc[len(roc)-1].FalsePositiveRate != 1 {
+		t.Errorf("ROC() = %+v", roc)
+	}
+
+	wrong := e.Misclassified(3, 5)
+	if len(wrong) != 2 || wrong[0].Pair != 2 || wrong[1].Pair != 3 {
+		t.Errorf("Misclassified(3) = %+v, want pairs 2 then 3", wrong)
+	}
+	if wrong := e.Misclassified(3, 1); len(wrong) != 1 {
+		t.Errorf("Misclassified(3, 1) returned %d pairs", len(wrong))
+	}
+	if m := e.At(100); m.Threshold != 64 {
+		t.Errorf("At(100) = %+v, want the widest threshold", m)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ds := NewDocumentSimilarity()
+	e := ds.Evaluate([]LabelledPair{
+		{A: "The quick brown fox", B: "The quick brown fox", Duplicate: true},
+		{A: "The quick brown fox", B: "Completely unrelated text about taxes", Duplicate: false},
+	})
+	if e.Bits != DefaultFingerprintBits || e.Results[0].Distance != 0 || e.Results[1].Distance == 0 {
+		t.Errorf("Evaluate() = %+v", e)
+	}
+	if e.AUC != 1 {
+		t.Errorf("AUC = %v, want 1", e.AUC)
+	}
+}
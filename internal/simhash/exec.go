@@ -0,0 +1,294 @@
+package simhash
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExecTimeout bounds how long the exec vectorizer waits for one vector
+const DefaultExecTimeout = 30 * time.Second
+
+// ExecVectorizer hands text to a local command and takes the vector it
+// returns, so any embedding model can drive the hyperplane fingerprints
+// without being linked into the binary. The command is started on first use
+// and kept running. It reads one JSON object per line from stdin,
+//
+//	{"text": "..."}
+//
+// and answers each with one line on stdout, either
+//
+//	{"vector": [0.12, -0.03, ...]}
+//	{"error": "message"}
+//
+// Requests are sent one at a time. Anything the command writes to stderr
+// passes through to ours.
+//
+// TextToVector cannot fail, so the first error, whether the command could not
+// start, broke the protocol or answered with a vector of the wrong length,
+// is kept and reported by Err; the command is stopped and every vector from
+// then on is zero. An ExecVectorizer is safe for concurrent use.
+type ExecVectorizer struct {
+	command    []string
+	dimensions int
+	timeout    time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	reader *bufio.Reader
+	err    error
+}
+
+func init() {
+	RegisterVectorizer("exec",
+		map[string]string{"cmd": "", "dims": "", "timeout": DefaultExecTimeout.String()},
+		func(p VectorizerParams) (Vectorizer, error) {
+			if p["dims"] == "" {
+				return nil, fmt.Errorf("exec vectorizer needs dims, the length of the vectors its command returns")
+			}
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			timeout, err := p.Duration("timeout")
+			if err != nil {
+				return nil, err
+			}
+			// Parameters are cut at commas and the command at spaces, with no
+			// quoting, so a quote would reach the command as part of an
+			// argument
+			if strings.ContainsAny(p["cmd"], "\"'") {
+				return nil, fmt.Errorf("exec vectorizer command %q cannot be quoted; wrap it in a script", p["cmd"])
+			}
+			return NewExecVectorizer(strings.Fields(p["cmd"]), dims, timeout)
+		})
+}
+
+// RunsCommand reports whether the config selects the exec vectorizer, which
+// runs a local command. Opening an index or a hyperplanes file that names
+// one must not run it unless the caller asks for it.
+func (c VectorizerConfig) RunsCommand() bool {
+	return c.Name == "exec"
+}
+
+// NewExecVectorizer creates a vectorizer that runs command, a program and its
+// arguments, and expects vectors of the given dimensions from it. The command
+// is not started until the first text is vectorized.
+func NewExecVectorizer(command []string, dimensions int, timeout time.Duration) (*ExecVectorizer, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("exec vectorizer needs a command")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("exec vectorizer timeout must be positive, got %s", timeout)
+	}
+	return &ExecVectorizer{command: command, dimensions: dimensions, timeout: timeout}, nil
+}
+
+// execRequest is one line sent to the command
+type execRequest struct {
+	Text string `json:"text"`
+}
+
+// execResponse is one line received from the command
+type execResponse struct {
+	Vector []float64 `json:"vector"`
+	Error  string    `json:"error"`
+}
+
+// TextToVector returns the vector the command computes for text, or a zero
+// vector once the vectorizer has failed
+func (ev *ExecVectorizer) TextToVector(text string) []float64 {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if ev.err == nil {
+		vector, err := ev.vector(text)
+		if err == nil {
+			return vector
+		}
+		ev.fail(err)
+	}
+	return make([]float64, ev.dimensions)
+}
+
+// vector runs one request, starting the command when it is not running
+func (ev *ExecVectorizer) vector(text string) ([]float64, error) {
+	if ev.cmd == nil {
+		if err := ev.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := json.Marshal(execRequest{Text: text})
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(ev.timeout)
+	if err := setDeadline(ev.stdin.SetWriteDeadline, deadline); err != nil {
+		return nil, err
+	}
+	if _, err := ev.stdin.Write(append(request, '\n')); err != nil {
+		return nil, fmt.Errorf("exec vectorizer: writing to %s: %w", ev.command[0], err)
+	}
+	if err := setDeadline(ev.stdout.SetReadDeadline, deadline); err != nil {
+		return nil, err
+	}
+	line, err := ev.reader.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("exec vectorizer: reading from %s: %w", ev.command[0], err)
+	}
+
+	var response execResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, fmt.Errorf("exec vectorizer: invalid response from %s: %w", ev.command[0], err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("exec vectorizer: %s: %s", ev.command[0], response.Error)
+	}
+	if len(response.Vector) != ev.dimensions {
+		return nil, fmt.Errorf("exec vectorizer: %s returned %d dimensions, expected %d",
+			ev.command[0], len(response.Vector), ev.dimensions)
+	}
+	for _, v := range response.Vector {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("exec vectorizer: %s returned a vector with %v", ev.command[0], v)
+		}
+	}
+	return response.Vector, nil
+}
+
+// start runs the command with pipes to its stdin and stdout. Pipes from
+// os.Pipe take deadlines, which is how requests time out.
+func (ev *ExecVectorizer) start() error {
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return err
+	}
+
+	cmd := exec.Command(ev.command[0], ev.command[1:]...)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	// The command holds its own ends of the pipes now
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return fmt.Errorf("exec vectorizer: %w", err)
+	}
+
+	ev.cmd = cmd
+	ev.stdin = stdinW
+	ev.stdout = stdoutR
+	ev.reader = bufio.NewReader(stdoutR)
+	return nil
+}
+
+// setDeadline sets a pipe deadline where the platform supports them
+func setDeadline(set func(time.Time) error, deadline time.Time) error {
+	if err := set(deadline); err != nil && !errors.Is(err, os.ErrNoDeadline) {
+		return err
+	}
+	return nil
+}
+
+// fail keeps the first error and stops the command
+func (ev *ExecVectorizer) fail(err error) {
+	ev.err = err
+	if ev.cmd != nil {
+		ev.stdin.Close()
+		ev.cmd.Process.Kill()
+		ev.stop()
+	}
+}
+
+// stop waits for the command to exit once its input is closed
+func (ev *ExecVectorizer) stop() error {
+	ev.stdout.Close()
+	err := ev.cmd.Wait()
+	ev.cmd = nil
+	return err
+}
+
+// Close stops the command, giving it the timeout to exit after its input
+// ends. It returns the error the vectorizer failed with, if any.
+func (ev *ExecVectorizer) Close() error {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if ev.cmd == nil {
+		return ev.err
+	}
+	ev.stdin.Close()
+	process := ev.cmd.Process
+	timer := time.AfterFunc(ev.timeout, func() { process.Kill() })
+	err := ev.stop()
+	timer.Stop()
+	if err != nil && ev.err == nil {
+		ev.err = fmt.Errorf("exec vectorizer: %s: %w", ev.command[0], err)
+	}
+	return ev.err
+}
+
+// Err returns the error the vectorizer failed with, if any
+func (ev *ExecVectorizer) Err() error {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	return ev.err
+}
+
+// Dimensions returns the number of vector dimensions
+func (ev *ExecVectorizer) Dimensions() int {
+	return ev.dimensions
+}
+
+// VectorizerErr returns the error a vectorizer that can fail, such as
+// ExecVectorizer, has failed with, looking through normalization. Vectors
+// from a failed vectorizer are meaningless.
+func VectorizerErr(v Vectorizer) error {
+	if ev, ok := baseVectorizer(v).(interface{ Err() error }); ok {
+		return ev.Err()
+	}
+	return nil
+}
+
+// CloseVectorizer releases what a vectorizer holds, such as the command of
+// an ExecVectorizer, looking through normalization
+func CloseVectorizer(v Vectorizer) error {
+	if c, ok := baseVectorizer(v).(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// baseVectorizer returns the vectorizer inside any normalization
+func baseVectorizer(v Vectorizer) Vectorizer {
+	switch v := v.(type) {
+	case *normalizedVectorizer:
+		return baseVectorizer(v.vectorizer)
+	case *normalizedCorpusVectorizer:
+		return baseVectorizer(v.vectorizer)
+	}
+	return v
+}
@@ -0,0 +1,180 @@
+package simhash
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// execHelperEnv selects what the test binary does when it is run as the
+// command of an exec vectorizer
+const execHelperEnv = "JAMTEXT_EXEC_HELPER"
+
+// TestExecHelper is not a test: run by an exec vectorizer, it answers
+// requests with byteVector, or misbehaves as execHelperEnv asks
+func TestExecHelper(t *testing.T) {
+	mode := os.Getenv(execHelperEnv)
+	if mode == "" {
+		return
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(nil, 1<<20)
+	out := json.NewEncoder(os.Stdout)
+	for in.Scan() {
+		var request execRequest
+		if err := json.Unmarshal(in.Bytes(), &request); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		switch mode {
+		case "short":
+			out.Encode(execResponse{Vector: byteVector(request.Text)[:4]})
+		case "error":
+			out.Encode(execResponse{Error: "model not loaded"})
+		case "hang":
+			time.Sleep(time.Minute)
+		default:
+			out.Encode(execResponse{Vector: byteVector(request.Text)})
+		}
+	}
+	os.Exit(0)
+}
+
+// byteVector counts the bytes of text by their value modulo 8
+func byteVector(text string) []float64 {
+	vector := make([]float64, 8)
+	for i := 0; i < len(text); i++ {
+		vector[text[i]%8]++
+	}
+	return vector
+}
+
+// execHelper returns an exec vectorizer running TestExecHelper in mode
+func execHelper(t *testing.T, mode, params string) Vectorizer {
+	t.Helper()
+	t.Setenv(execHelperEnv, mode)
+	cfg, err := ParseVectorizerConfig("exec:cmd=" + os.Args[0] + " -test.run=^TestExecHelper$,dims=8" + params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := cfg.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CloseVectorizer(v) })
+	return v
+}
+
+func TestExecVectorizer(t *testing.T) {
+	v := execHelper(t, "vectors", "")
+
+	texts := []string{"", "The quick brown fox", strings.Repeat("jumps over the lazy dog ", 5000)}
+	for _, text := range texts {
+		if got := v.TextToVector(text); !reflect.DeepEqual(got, byteVector(text)) {
+			t.Errorf("TextToVector(%.20q) = %v, want %v", text, got, byteVector(text))
+		}
+	}
+
+	// The command drives fingerprints like any vectorizer, dense or sparse
+	hyperplanes := GenerateHyperplanesWithSeed(8, 64, DefaultSeed)
+	detector := NewDocumentSimilarityWithAlgorithm(Hyperplane, 64, hyperplanes, DefaultModel().Normalizer.Wrap(v))
+	want := CalculateFingerprint(Hyperplane, 64, "the quick brown fox", hyperplanes, v)
+	if got := detector.Fingerprint("The  quick brown fox"); got != want {
+		t.Errorf("Fingerprint = %s, want %s", got, want)
+	}
+	if err := detector.Err(); err != nil {
+		t.Errorf("Err = %v", err)
+	}
+	if err := CloseVectorizer(v); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestExecVectorizerConcurrent(t *testing.T) {
+	v := execHelper(t, "vectors", "")
+
+	done := make(chan string)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			text := strings.Repeat(fmt.Sprint(i), i+1)
+			if got := v.TextToVector(text); !reflect.DeepEqual(got, byteVector(text)) {
+				done <- fmt.Sprintf("TextToVector(%q) = %v", text, got)
+				return
+			}
+			done <- ""
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if msg := <-done; msg != "" {
+			t.Error(msg)
+		}
+	}
+}
+
+func TestExecVectorizerFailures(t *testing.T) {
+	tests := []struct {
+		mode, params, want string
+	}{
+		{"short", "", "returned 4 dimensions, expected 8"},
+		{"error", "", "model not loaded"},
+		{"hang", ",timeout=200ms", "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			v := execHelper(t, tt.mode, tt.params)
+			if got := v.TextToVector("some text"); !reflect.DeepEqual(got, make([]float64, 8)) {
+				t.Errorf("TextToVector = %v, want a zero vector", got)
+			}
+			err := VectorizerErr(v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Err = %v, want it to mention %q", err, tt.want)
+			}
+			// The first error sticks
+			v.TextToVector("more text")
+			if again := VectorizerErr(v); again != err {
+				t.Errorf("Err changed to %v", again)
+			}
+		})
+	}
+}
+
+func TestExecVectorizerConfig(t *testing.T) {
+	for _, spec := range []string{
+		"exec:dims=8",
+		"exec:cmd=embed",
+		"exec:cmd=embed,dims=0",
+		"exec:cmd=embed,dims=8,timeout=soon",
+		"exec:cmd=embed 'two words',dims=8",
+	} {
+		cfg, err := ParseVectorizerConfig(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.New(); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+
+	v := execHelper(t, "vectors", "")
+	v.(*ExecVectorizer).command = []string{"/nonexistent/embed"}
+	v.TextToVector("text")
+	if err := VectorizerErr(v); err == nil {
+		t.Error("expected an error for a missing command")
+	}
+}
+
+func TestValidateHyperplanes(t *testing.T) {
+	hyperplanes := GenerateHyperplanesWithSeed(8, 64, DefaultSeed)
+	if err := ValidateHyperplanes(hyperplanes, 8); err != nil {
+		t.Errorf("ValidateHyperplanes = %v", err)
+	}
+	if err := ValidateHyperplanes(hyperplanes, 384); err == nil {
+		t.Error("expected an error for 8-dimensional hyperplanes and 384-dimensional vectors")
+	}
+}
@@ -0,0 +1,221 @@
+package simhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultFingerprintBits is the width of a SimHash, and is assumed for
+	// indexes built before the width was recorded
+	DefaultFingerprintBits = 64
+	// MaxFingerprintBits is the widest supported fingerprint
+	MaxFingerprintBits = 256
+
+	fingerprintWords = MaxFingerprintBits / 64
+)
+
+// Fingerprint is a SimHash of 64, 128 or 256 bits. Bit i lives in word i/64,
+// and unused words stay zero so fingerprints are comparable and can key maps.
+type Fingerprint struct {
+	words [fingerprintWords]uint64
+	bits  int
+}
+
+// ValidateFingerprintBits reports whether bits is a supported width
+func ValidateFingerprintBits(bits int) error {
+	switch bits {
+	case 64, 128, 256:
+		return nil
+	}
+	return fmt.Errorf("unsupported fingerprint width %d (use 64, 128 or 256)", bits)
+}
+
+// ValidateHyperplanes reports whether hyperplanes have the dimensions of the
+// vectors they split, as a vector of any other length cannot be projected
+func ValidateHyperplanes(hyperplanes [][]float64, dims int) error {
+	for _, plane := range hyperplanes {
+		if len(plane) != dims {
+			return fmt.Errorf("hyperplanes have %d dimensions but the vectorizer produces %d", len(plane), dims)
+		}
+	}
+	return nil
+}
+
+// NewFingerprint returns an all-zero fingerprint of the given width
+func NewFingerprint(bits int) Fingerprint {
+	return Fingerprint{bits: bits}
+}
+
+// Fingerprint returns the 64-bit fingerprint holding s
+func (s SimHash) Fingerprint() Fingerprint {
+	return Fingerprint{words: [fingerprintWords]uint64{uint64(s)}, bits: 64}
+}
+
+// SimHash returns the lowest 64 bits of the fingerprint
+func (f Fingerprint) SimHash() SimHash {
+	return SimHash(f.words[0])
+}
+
+// Bits returns the width of the fingerprint
+func (f Fingerprint) Bits() int {
+	return f.bits
+}
+
+// Bit reports whether bit i is set
+func (f Fingerprint) Bit(i int) bool {
+	return f.words[i/64]&(1<<(i%64)) != 0
+}
+
+// SetBit sets bit i
+func (f *Fingerprint) SetBit(i int) {
+	f.words[i/64] |= 1 << (i % 64)
+}
+
+// Word returns bits 64*i to 64*i+63
+func (f Fingerprint) Word(i int) uint64 {
+	return f.words[i]
+}
+
+// HammingDistance calculates the number of bit positions where two
+// fingerprints differ
+func (f Fingerprint) HammingDistance(other Fingerprint) int {
+	distance := 0
+	for i := range f.words {
+		distance += bits.OnesCount64(f.words[i] ^ other.words[i])
+	}
+	return distance
+}
+
+// IsSimilar determines if two fingerprints are similar based on a threshold
+func (f Fingerprint) IsSimilar(other Fingerprint, threshold int) bool {
+	return f.HammingDistance(other) <= threshold
+}
+
+// Similarity returns the fraction of matching bits, between 0 and 1
+func (f Fingerprint) Similarity(other Fingerprint) float64 {
+	if f.bits == 0 {
+		return 1
+	}
+	return float64(f.bits-f.HammingDistance(other)) / float64(f.bits)
+}
+
+// Less orders fingerprints by width, then numerically
+func (f Fingerprint) Less(other Fingerprint) bool {
+	if f.bits != other.bits {
+		return f.bits < other.bits
+	}
+	for i := fingerprintWords - 1; i >= 0; i-- {
+		if f.words[i] != other.words[i] {
+			return f.words[i] < other.words[i]
+		}
+	}
+	return false
+}
+
+// String returns the fingerprint as bits/4 hex digits, most significant first
+func (f Fingerprint) String() string {
+	var sb strings.Builder
+	for i := f.bits/64 - 1; i >= 0; i-- {
+		fmt.Fprintf(&sb, "%016x", f.words[i])
+	}
+	return sb.String()
+}
+
+// ParseFingerprint parses a hex fingerprint of the given width. Leading
+// zeros may be omitted, so 64-bit hashes printed with %x still parse.
+func ParseFingerprint(s string, width int) (Fingerprint, error) {
+	if err := ValidateFingerprintBits(width); err != nil {
+		return Fingerprint{}, err
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	if hex == "" || len(hex) > width/4 {
+		return Fingerprint{}, fmt.Errorf("invalid %d-bit fingerprint %q", width, s)
+	}
+
+	f := NewFingerprint(width)
+	for i := 0; hex != ""; i++ {
+		start := len(hex) - 16
+		if start < 0 {
+			start = 0
+		}
+		word, err := strconv.ParseUint(hex[start:], 16, 64)
+		if err != nil {
+			return Fingerprint{}, fmt.Errorf("invalid %d-bit fingerprint %q", width, s)
+		}
+		f.words[i] = word
+		hex = hex[:start]
+	}
+	return f, nil
+}
+
+// MarshalBinary encodes the width followed by the used words
+func (f Fingerprint) MarshalBinary() ([]byte, error) {
+	n := f.bits / 64
+	data := make([]byte, 1+8*n)
+	data[0] = byte(n)
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint64(data[1+8*i:], f.words[i])
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a fingerprint written by MarshalBinary
+func (f *Fingerprint) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || int(data[0]) > fingerprintWords || len(data) != 1+8*int(data[0]) {
+		return fmt.Errorf("invalid encoded fingerprint")
+	}
+	*f = NewFingerprint(int(data[0]) * 64)
+	for i := range f.words[:data[0]] {
+		f.words[i] = binary.BigEndian.Uint64(data[1+8*i:])
+	}
+	return nil
+}
+
+// MarshalText encodes the fingerprint as hex
+func (f Fingerprint) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes a hex fingerprint whose width is given by its length
+func (f *Fingerprint) UnmarshalText(text []byte) error {
+	parsed, err := ParseFingerprint(string(text), len(text)*4)
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// CalculateFingerprint computes a fingerprint of the given width. The
+// hyperplane algorithm needs at least width hyperplanes; Charikar ignores them.
+func CalculateFingerprint(algorithm Algorithm, width int, text string, hyperplanes [][]float64, vectorizer Vectorizer) Fingerprint {
+	if algorithm == Charikar {
+		return charikarFingerprint(text, vectorizer, width)
+	}
+
+	return projectFingerprint(vectorizer.TextToVector(text), width, hyperplanes)
+}
+
+// projectFingerprint sets bit i when vector lies on the positive side of
+// hyperplane i
+func projectFingerprint(vector []float64, width int, hyperplanes [][]float64) Fingerprint {
+	fp := NewFingerprint(width)
+	for i, hyperplane := range hyperplanes {
+		if i == width {
+			break
+		}
+		dotProduct := 0.0
+		for j := range vector {
+			dotProduct += vector[j] * hyperplane[j]
+		}
+		if dotProduct >= 0 {
+			fp.SetBit(i)
+		}
+	}
+	return fp
+}
@@ -0,0 +1,129 @@
+package simhash
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseFingerprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		bits    int
+		want    string
+		wantErr bool
+	}{
+		{name: "64-bit", input: "00000000deadbeef", bits: 64, want: "00000000deadbeef"},
+		{name: "64-bit without leading zeros", input: "deadbeef", bits: 64, want: "00000000deadbeef"},
+		{name: "128-bit", input: "0123456789abcdef" + "fedcba9876543210", bits: 128, want: "0123456789abcdeffedcba9876543210"},
+		{name: "256-bit with prefix", input: "0x1" + strings.Repeat("0", 63), bits: 256, want: "1" + strings.Repeat("0", 63)},
+		{name: "too long", input: strings.Repeat("f", 17), bits: 64, wantErr: true},
+		{name: "not hex", input: "xyz", bits: 64, wantErr: true},
+		{name: "empty", input: "", bits: 64, wantErr: true},
+		{name: "unsupported width", input: "1", bits: 96, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp, err := ParseFingerprint(tt.input, tt.bits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && fp.String() != tt.want {
+				t.Errorf("String() = %s, want %s", fp, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintHammingDistance(t *testing.T) {
+	a := NewFingerprint(256)
+	b := NewFingerprint(256)
+	for _, bit := range []int{0, 63, 64, 200, 255} {
+		b.SetBit(bit)
+	}
+
+	if got := a.HammingDistance(b); got != 5 {
+		t.Errorf("HammingDistance() = %d, want 5", got)
+	}
+	if !b.Bit(200) || b.Bit(201) {
+		t.Error("Bit() does not match the bits that were set")
+	}
+	if got := a.Similarity(b); got != 251.0/256.0 {
+		t.Errorf("Similarity() = %f, want %f", got, 251.0/256.0)
+	}
+	if SimHash(0xff).Fingerprint().HammingDistance(SimHash(0x0f).Fingerprint()) != SimHash(0xff).HammingDistance(0x0f) {
+		t.Error("64-bit fingerprint distance differs from SimHash distance")
+	}
+}
+
+func TestFingerprintEncoding(t *testing.T) {
+	fp, err := ParseFingerprint("0123456789abcdeffedcba9876543210", 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Fingerprint
+	if err := decoded.UnmarshalBinary(data); err != nil || decoded != fp {
+		t.Errorf("binary round trip = %s, %v, want %s", decoded, err, fp)
+	}
+
+	text, err := json.Marshal(map[string]Fingerprint{"hash": fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON map[string]Fingerprint
+	if err := json.Unmarshal(text, &fromJSON); err != nil || fromJSON["hash"] != fp {
+		t.Errorf("JSON round trip = %v, %v, want %s", fromJSON, err, fp)
+	}
+}
+
+func TestCalculateFingerprintWidths(t *testing.T) {
+	text := "wider fingerprints extend the 64-bit hash rather than replacing it"
+	vectorizer := NewFrequencyVectorizer(VectorDimensions)
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 256)
+
+	for _, bits := range []int{64, 128, 256} {
+		fp := CalculateFingerprint(Hyperplane, bits, text, hyperplanes, vectorizer)
+		if fp.Bits() != bits {
+			t.Errorf("Bits() = %d, want %d", fp.Bits(), bits)
+		}
+		if fp.SimHash() != CalculateWithVectorizer(text, hyperplanes[:64], vectorizer) {
+			t.Errorf("%d-bit hyperplane fingerprint does not start with the 64-bit SimHash", bits)
+		}
+
+		fp = CalculateFingerprint(Charikar, bits, text, nil, vectorizer)
+		if fp.SimHash() != CalculateCharikar(text, vectorizer) {
+			t.Errorf("%d-bit Charikar fingerprint does not start with the 64-bit SimHash", bits)
+		}
+	}
+}
+
+func TestBandSignaturesWide(t *testing.T) {
+	pt := NewPermutationTable(256, 16)
+	fp := NewFingerprint(256)
+	fp.SetBit(255)
+
+	inverted := NewFingerprint(256)
+	for bit := 0; bit < 255; bit++ {
+		inverted.SetBit(bit)
+	}
+
+	a, b := pt.BandSignatures(fp), pt.BandSignatures(inverted)
+	if len(a) != 16 {
+		t.Fatalf("got %d bands, want 16", len(a))
+	}
+	for i, sig := range pt.BandSignatures(fp) {
+		if sig != a[i] {
+			t.Errorf("band %d signature is not deterministic", i)
+		}
+		if a[i] == b[i] {
+			t.Errorf("band %d matches for inverted fingerprints", i)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package simhash
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PlaneMethod selects how LearnHyperplanes derives hyperplanes from a sample
+type PlaneMethod string
+
+const (
+	// PCAPlanes spans the principal components of the sample and rotates
+	// them at random, so every bit sees a share of the variance
+	PCAPlanes PlaneMethod = "pca"
+	// ITQPlanes rotates the principal components by iterative quantization,
+	// which turns them until the projections round to bits with the least
+	// error
+	ITQPlanes PlaneMethod = "itq"
+)
+
+// DefaultPlaneMethod is the method used when none is given
+const DefaultPlaneMethod = PCAPlanes
+
+const (
+	// subspaceIterations refines the principal components
+	subspaceIterations = 30
+	// itqIterations alternates bits and rotation in iterative quantization
+	itqIterations = 50
+)
+
+// ParsePlaneMethod parses a method name; the empty string selects the
+// default
+func ParsePlaneMethod(s string) (PlaneMethod, error) {
+	switch PlaneMethod(s) {
+	case "":
+		return DefaultPlaneMethod, nil
+	case PCAPlanes, ITQPlanes:
+		return PlaneMethod(s), nil
+	}
+	return "", fmt.Errorf("unknown hyperplane method %q (pca|itq)", s)
+}
+
+// LearnHyperplanes derives bits hyperplanes from sample vectors, such as
+// vectorized chunks of the corpus to be indexed. Random hyperplanes spend
+// many bits on directions where the text barely varies; learned ones follow
+// the directions of most variance instead.
+//
+// Fingerprints compare angles, so each vector is scaled to unit length and
+// the direction of their mean, which every vector shares, is removed. The
+// hyperplanes span the principal components of what is left, rotated at
+// random or by iterative quantization. Without enough components for every
+// bit, the extra hyperplanes are random directions among them; iterative
+// quantization needs one component per bit. The seed makes the result
+// reproducible.
+func LearnHyperplanes(sample [][]float64, bits int, method PlaneMethod, seed int64) ([][]float64, error) {
+	if err := ValidateFingerprintBits(bits); err != nil {
+		return nil, err
+	}
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("no vectors to learn hyperplanes from")
+	}
+	dims := len(sample[0])
+	if dims < 2 {
+		return nil, fmt.Errorf("cannot learn hyperplanes from %d-dimensional vectors", dims)
+	}
+
+	vectors := make([][]float64, 0, len(sample))
+	for i, v := range sample {
+		if len(v) != dims {
+			return nil, fmt.Errorf("vector %d has %d dimensions, expected %d", i, len(v), dims)
+		}
+		if norm := math.Sqrt(dot(v, v)); norm > 0 && !math.IsInf(norm, 0) && !math.IsNaN(norm) {
+			vectors = append(vectors, scaled(v, 1/norm))
+		}
+	}
+	if len(vectors) < 2 {
+		return nil, fmt.Errorf("need at least 2 nonzero vectors to learn hyperplanes, got %d", len(vectors))
+	}
+
+	// Remove the mean direction, which leaves the vectors centred
+	mean := make([]float64, dims)
+	for _, v := range vectors {
+		for j, x := range v {
+			mean[j] += x
+		}
+	}
+	var exclude [][]float64
+	if norm := math.Sqrt(dot(mean, mean)); norm > 0 {
+		exclude = append(exclude, scaled(mean, 1/norm))
+		for i, v := range vectors {
+			vectors[i] = project(v, exclude)
+		}
+	}
+
+	components := min(bits, dims-len(exclude))
+	if method == ITQPlanes && components < bits {
+		return nil, fmt.Errorf("itq needs a component per bit, but %d-dimensional vectors have %d; use pca or more dimensions",
+			dims, components)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	basis := principalComponents(vectors, components, exclude, rng)
+
+	var rotation [][]float64
+	switch method {
+	case PCAPlanes:
+		rotation = gaussianMatrix(components, bits, rng)
+		if components == bits {
+			rotation = orthonormalRows(rotation, nil, rng)
+		}
+	case ITQPlanes:
+		rotation = quantizationRotation(vectors, basis, rng)
+	default:
+		return nil, fmt.Errorf("unknown hyperplane method %q (pca|itq)", method)
+	}
+
+	// Hyperplane k combines the components with column k of the rotation
+	hyperplanes := make([][]float64, bits)
+	for k := range hyperplanes {
+		plane := make([]float64, dims)
+		for j, component := range basis {
+			axpy(plane, rotation[j][k], component)
+		}
+		if norm := math.Sqrt(dot(plane, plane)); norm > 0 {
+			plane = scaled(plane, 1/norm)
+		}
+		hyperplanes[k] = plane
+	}
+	return hyperplanes, nil
+}
+
+// BitEntropy is the mean entropy of the fingerprint bits the hyperplanes give
+// the sample vectors: 1 when every bit splits the sample in half, and lower
+// as bits take the same value for most vectors and tell them apart less.
+func BitEntropy(sample [][]float64, hyperplanes [][]float64) float64 {
+	if len(sample) == 0 || len(hyperplanes) == 0 {
+		return 0
+	}
+	var total float64
+	for _, plane := range hyperplanes {
+		set := 0
+		for _, v := range sample {
+			if dot(v, plane) >= 0 {
+				set++
+			}
+		}
+		p := float64(set) / float64(len(sample))
+		for _, q := range []float64{p, 1 - p} {
+			if q > 0 {
+				total -= q * math.Log2(q)
+			}
+		}
+	}
+	return total / float64(len(hyperplanes))
+}
+
+// principalComponents returns an orthonormal basis of the count directions
+// of most variance of centred vectors, orthogonal to exclude, by subspace
+// iteration on their covariance
+func principalComponents(vectors [][]float64, count int, exclude [][]float64, rng *rand.Rand) [][]float64 {
+	dims := len(vectors[0])
+	covariance := make([][]float64, dims)
+	for i := range covariance {
+		covariance[i] = make([]float64, dims)
+	}
+	for _, v := range vectors {
+		for i, x := range v {
+			if x == 0 {
+				continue
+			}
+			axpy(covariance[i], x, v)
+		}
+	}
+
+	basis := orthonormalRows(gaussianMatrix(count, dims, rng), exclude, rng)
+	for iter := 0; iter < subspaceIterations; iter++ {
+		next := make([][]float64, count)
+		for k, q := range basis {
+			next[k] = make([]float64, dims)
+			for i, row := range covariance {
+				next[k][i] = dot(row, q)
+			}
+		}
+		basis = orthonormalRows(next, exclude, rng)
+	}
+	return basis
+}
+
+// quantizationRotation finds the rotation of the projections of vectors on
+// basis that rounds them to bits with the least error: it alternates taking
+// the bits of the rotated projections and the rotation closest to mapping
+// the projections onto those bits
+func quantizationRotation(vectors, basis [][]float64, rng *rand.Rand) [][]float64 {
+	count := len(basis)
+	projections := make([][]float64, len(vectors))
+	for i, v := range vectors {
+		projections[i] = make([]float64, count)
+		for j, component := range basis {
+			projections[i][j] = dot(v, component)
+		}
+	}
+
+	rotation := orthonormalRows(gaussianMatrix(count, count, rng), nil, rng)
+	rotated := make([]float64, count)
+	for iter := 0; iter < itqIterations; iter++ {
+		// correlation = projectionsᵀ · sign(projections · rotation)
+		correlation := make([][]float64, count)
+		for j := range correlation {
+			correlation[j] = make([]float64, count)
+		}
+		for _, p := range projections {
+			for k := range rotated {
+				rotated[k] = 0
+			}
+			for j, x := range p {
+				axpy(rotated, x, rotation[j])
+			}
+			for j, x := range p {
+				row := correlation[j]
+				for k, r := range rotated {
+					if r >= 0 {
+						row[k] += x
+					} else {
+						row[k] -= x
+					}
+				}
+			}
+		}
+
+		next, ok := polarFactor(correlation)
+		if !ok {
+			break // Degenerate sample; keep the rotation so far
+		}
+		rotation = next
+	}
+	return rotation
+}
+
+// polarFactor returns the orthogonal matrix nearest m, the polar factor of
+// its decomposition, by the scaled Newton iteration. It fails when m is
+// singular.
+func polarFactor(m [][]float64) ([][]float64, bool) {
+	x := m
+	for iter := 0; iter < 100; iter++ {
+		inverse, ok := invert(x)
+		if !ok {
+			return nil, false
+		}
+		// Scaling speeds convergence when singular values are far from 1
+		zeta := math.Sqrt(frobenius(inverse) / frobenius(x))
+		next := make([][]float64, len(x))
+		change := 0.0
+		for i := range x {
+			next[i] = make([]float64, len(x))
+			for j := range x {
+				next[i][j] = (zeta*x[i][j] + inverse[j][i]/zeta) / 2
+				change += (next[i][j] - x[i][j]) * (next[i][j] - x[i][j])
+			}
+		}
+		x = next
+		if math.Sqrt(change) < 1e-12*float64(len(x)) {
+			break
+		}
+	}
+	return x, true
+}
+
+// invert returns the inverse of a square matrix by Gauss-Jordan elimination
+// with partial pivoting, or false when it is singular
+func invert(m [][]float64) ([][]float64, bool) {
+	n := len(m)
+	a := make([][]float64, n)
+	inverse := make([][]float64, n)
+	scale := frobenius(m)
+	for i := range m {
+		a[i] = append([]float64(nil), m[i]...)
+		inverse[i] = make([]float64, n)
+		inverse[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) <= 1e-12*scale {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		f := 1 / a[col][col]
+		a[col] = scaled(a[col], f)
+		inverse[col] = scaled(inverse[col], f)
+		for row := 0; row < n; row++ {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+			f := -a[row][col]
+			axpy(a[row], f, a[col])
+			axpy(inverse[row], f, inverse[col])
+		}
+	}
+	return inverse, true
+}
+
+// orthonormalRows orthonormalizes rows by Gram-Schmidt, also against the
+// orthonormal rows of exclude. A row that vanishes is replaced by a random
+// one, so the result always has as many rows.
+func orthonormalRows(rows, exclude [][]float64, rng *rand.Rand) [][]float64 {
+	out := make([][]float64, 0, len(rows))
+	for _, row := range rows {
+		norm := math.Sqrt(dot(row, row))
+		for attempt := 0; ; attempt++ {
+			// Project twice for numerical stability
+			v := project(project(row, exclude), out)
+			if n := math.Sqrt(dot(v, v)); n > 1e-10*norm && n > 0 {
+				out = append(out, scaled(v, 1/n))
+				break
+			}
+			if attempt == 10 {
+				panic("simhash: cannot extend an orthonormal basis")
+			}
+			row = gaussianMatrix(1, len(row), rng)[0]
+			norm = math.Sqrt(dot(row, row))
+		}
+	}
+	return out
+}
+
+// project removes the components of v along the orthonormal rows of basis
+func project(v []float64, basis [][]float64) []float64 {
+	v = append([]float64(nil), v...)
+	for _, b := range basis {
+		axpy(v, -dot(v, b), b)
+	}
+	return v
+}
+
+// gaussianMatrix returns a rows × cols matrix of standard normal values
+func gaussianMatrix(rows, cols int, rng *rand.Rand) [][]float64 {
+	m := make([][]float64, rows)
+	for i := range m {
+		m[i] = make([]float64, cols)
+		for j := range m[i] {
+			m[i][j] = rng.NormFloat64()
+		}
+	}
+	return m
+}
+
+// frobenius returns the Frobenius norm of a matrix
+func frobenius(m [][]float64) float64 {
+	var sum float64
+	for _, row := range m {
+		sum += dot(row, row)
+	}
+	return math.Sqrt(sum)
+}
+
+// dot returns the dot product of two vectors of the same length
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i, x := range a {
+		sum += x * b[i]
+	}
+	return sum
+}
+
+// axpy adds a times x to y
+func axpy(y []float64, a float64, x []float64) {
+	for i, v := range x {
+		y[i] += a * v
+	}
+}
+
+// scaled returns a copy of v multiplied by f
+func scaled(v []float64, f float64) []float64 {
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = f * x
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package simhash
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// anisotropicSample returns vectors that share a mean direction and vary
+// mostly along a few directions, as vectorized text does
+func anisotropicSample(n, dims, directions int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	mean := gaussianMatrix(1, dims, rng)[0]
+	basis := gaussianMatrix(directions, dims, rng)
+	sample := make([][]float64, n)
+	for i := range sample {
+		v := scaled(mean, 3)
+		for _, b := range basis {
+			axpy(v, rng.NormFloat64(), b)
+		}
+		for j := range v {
+			v[j] += 0.05 * rng.NormFloat64()
+		}
+		sample[i] = v
+	}
+	return sample
+}
+
+func TestLearnHyperplanes(t *testing.T) {
+	sample := anisotropicSample(500, 80, 6, 1)
+	random := GenerateHyperplanesWithSeed(80, 64, DefaultSeed)
+
+	for _, method := range []PlaneMethod{PCAPlanes, ITQPlanes} {
+		t.Run(string(method), func(t *testing.T) {
+			planes, err := LearnHyperplanes(sample, 64, method, DefaultSeed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(planes) != 64 {
+				t.Fatalf("got %d hyperplanes, want 64", len(planes))
+			}
+			if err := ValidateHyperplanes(planes, 80); err != nil {
+				t.Fatal(err)
+			}
+			for k, plane := range planes {
+				if norm := math.Sqrt(dot(plane, plane)); math.Abs(norm-1) > 1e-9 {
+					t.Errorf("hyperplane %d has length %v", k, norm)
+				}
+			}
+
+			// Every learned bit splits the sample; random ones mostly
+			// agree on the shared mean direction
+			learned, baseline := BitEntropy(sample, planes), BitEntropy(sample, random)
+			if learned < 0.9 || learned <= baseline {
+				t.Errorf("bit entropy %.3f learned, %.3f random", learned, baseline)
+			}
+
+			again, err := LearnHyperplanes(sample, 64, method, DefaultSeed)
+			if err != nil || !reflect.DeepEqual(again, planes) {
+				t.Error("the same seed learned other hyperplanes")
+			}
+		})
+	}
+}
+
+func TestLearnHyperplanesITQIsOrthogonal(t *testing.T) {
+	planes, err := LearnHyperplanes(anisotropicSample(300, 72, 20, 2), 64, ITQPlanes, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range planes {
+		for j := i + 1; j < len(planes); j++ {
+			if d := dot(planes[i], planes[j]); math.Abs(d) > 1e-6 {
+				t.Fatalf("hyperplanes %d and %d have dot product %v", i, j, d)
+			}
+		}
+	}
+}
+
+func TestLearnHyperplanesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample [][]float64
+		bits   int
+		method PlaneMethod
+		want   string
+	}{
+		{"empty", nil, 64, PCAPlanes, "no vectors"},
+		{"width", anisotropicSample(10, 8, 2, 1), 48, PCAPlanes, "64, 128 or 256"},
+		{"ragged", [][]float64{{1, 2}, {1, 2, 3}}, 64, PCAPlanes, "vector 1 has 3 dimensions"},
+		{"zero", [][]float64{{0, 0}, {0, 0}}, 64, PCAPlanes, "nonzero vectors"},
+		{"itq", anisotropicSample(10, 8, 2, 1), 64, ITQPlanes, "itq needs a component per bit"},
+		{"method", anisotropicSample(10, 8, 2, 1), 64, "lda", "unknown hyperplane method"},
+	}
+	for _, tt := range tests {
+		_, err := LearnHyperplanes(tt.sample, tt.bits, tt.method, DefaultSeed)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParsePlaneMethod(t *testing.T) {
+	if m, err := ParsePlaneMethod(""); err != nil || m != DefaultPlaneMethod {
+		t.Errorf(`ParsePlaneMethod("") = %q, %v`, m, err)
+	}
+	if m, err := ParsePlaneMethod("itq"); err != nil || m != ITQPlanes {
+		t.Errorf(`ParsePlaneMethod("itq") = %q, %v`, m, err)
+	}
+	if _, err := ParsePlaneMethod("random"); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
+
+func TestPolarFactor(t *testing.T) {
+	m := [][]float64{{2, 1, 0}, {0, 3, 1}, {1, 0, 1}}
+	r, ok := polarFactor(m)
+	if !ok {
+		t.Fatal("polarFactor failed on a nonsingular matrix")
+	}
+	for i := range r {
+		for j := range r {
+			var d float64
+			for k := range r {
+				d += r[k][i] * r[k][j]
+			}
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(d-want) > 1e-9 {
+				t.Fatalf("RᵀR[%d][%d] = %v, want %v", i, j, d, want)
+			}
+		}
+	}
+	if _, ok := polarFactor([][]float64{{1, 2}, {2, 4}}); ok {
+		t.Error("expected a singular matrix to fail")
+	}
+}
@@ -0,0 +1,124 @@
+package simhash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// LSHEstimate describes how an LSH band layout behaves for a Hamming
+// distance threshold
+type LSHEstimate struct {
+	Bands         int
+	BandSize      int
+	Recall        float64 // Probability that a pair at the threshold becomes a candidate
+	CandidateRate float64 // Expected fraction of unrelated hashes that become candidates
+}
+
+// ValidateLSHBands checks that bands split a fingerprint width into bands
+// that fit a 64-bit signature
+func ValidateLSHBands(bits, bands int) error {
+	if bands <= 0 || bits%bands != 0 {
+		return fmt.Errorf("%d LSH bands do not divide %d-bit fingerprints", bands, bits)
+	}
+	if bits/bands > 64 {
+		return fmt.Errorf("LSH bands of %d bits do not fit a 64-bit signature", bits/bands)
+	}
+	return nil
+}
+
+// LSHLayouts returns the band counts that are valid for a fingerprint width,
+// from fewest to most bands
+func LSHLayouts(bits int) []int {
+	var layouts []int
+	for bands := 1; bands <= bits; bands++ {
+		if ValidateLSHBands(bits, bands) == nil {
+			layouts = append(layouts, bands)
+		}
+	}
+	return layouts
+}
+
+// LSHProbability returns the probability that two fingerprints distance bits
+// apart share at least one band. Every band reads bits/bands distinct bits
+// chosen at random, so it matches when none of them is a differing bit.
+func LSHProbability(bits, bands, distance int) float64 {
+	bandSize := bits / bands
+	match := 1.0
+	for i := 0; i < bandSize; i++ {
+		match *= float64(bits-distance-i) / float64(bits-i)
+		if match <= 0 {
+			match = 0
+			break
+		}
+	}
+	return 1 - math.Pow(1-match, float64(bands))
+}
+
+// LSHCurve returns the S-curve of a layout: the candidate probability for
+// every distance from 0 to bits
+func LSHCurve(bits, bands int) []float64 {
+	curve := make([]float64, bits+1)
+	for d := range curve {
+		curve[d] = LSHProbability(bits, bands, d)
+	}
+	return curve
+}
+
+// EstimateLSH evaluates a layout for a Hamming distance threshold. Unrelated
+// fingerprints are taken to differ in each bit with probability one half.
+func EstimateLSH(bits, bands, threshold int) LSHEstimate {
+	e := LSHEstimate{
+		Bands:    bands,
+		BandSize: bits / bands,
+		Recall:   LSHProbability(bits, bands, threshold),
+	}
+	for d, p := range LSHCurve(bits, bands) {
+		e.CandidateRate += binomialHalf(bits, d) * p
+	}
+	return e
+}
+
+// binomialHalf returns the probability of k successes in n fair trials
+func binomialHalf(n, k int) float64 {
+	lgN, _ := math.Lgamma(float64(n + 1))
+	lgK, _ := math.Lgamma(float64(k + 1))
+	lgNK, _ := math.Lgamma(float64(n - k + 1))
+	return math.Exp(lgN - lgK - lgNK - float64(n)*math.Ln2)
+}
+
+// TuneLSH evaluates every layout for a fingerprint width and recommends the
+// one that reaches the target recall at threshold with the fewest expected
+// candidates. When no layout reaches the target, the one with the highest
+// recall is recommended.
+func TuneLSH(bits, threshold int, recall float64) (LSHEstimate, []LSHEstimate, error) {
+	if err := ValidateFingerprintBits(bits); err != nil {
+		return LSHEstimate{}, nil, err
+	}
+	if threshold < 0 || threshold > bits {
+		return LSHEstimate{}, nil, fmt.Errorf("threshold must be between 0 and %d, got %d", bits, threshold)
+	}
+	if recall <= 0 || recall > 1 {
+		return LSHEstimate{}, nil, fmt.Errorf("target recall must be in (0, 1], got %g", recall)
+	}
+
+	var estimates []LSHEstimate
+	for _, bands := range LSHLayouts(bits) {
+		estimates = append(estimates, EstimateLSH(bits, bands, threshold))
+	}
+
+	ranked := append([]LSHEstimate(nil), estimates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		aMeets, bMeets := a.Recall >= recall, b.Recall >= recall
+		switch {
+		case aMeets && bMeets:
+			return a.CandidateRate < b.CandidateRate
+		case aMeets != bMeets:
+			return aMeets
+		default:
+			return a.Recall > b.Recall
+		}
+	})
+	return ranked[0], estimates, nil
+}
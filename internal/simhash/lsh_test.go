@@ -0,0 +1,92 @@
+package simhash
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestLSHLayouts(t *testing.T) {
+	if got, want := LSHLayouts(64), []int{1, 2, 4, 8, 16, 32, 64}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LSHLayouts(64) = %v, want %v", got, want)
+	}
+	// 256-bit fingerprints need at least 4 bands to fit 64-bit signatures
+	if got := LSHLayouts(256); got[0] != 4 {
+		t.Errorf("LSHLayouts(256) = %v, want it to start at 4 bands", got)
+	}
+	if err := ValidateLSHBands(64, 3); err == nil {
+		t.Error("expected error for bands that do not divide the width")
+	}
+}
+
+func TestLSHProbability(t *testing.T) {
+	if p := LSHProbability(64, 4, 0); p != 1 {
+		t.Errorf("identical fingerprints are candidates with probability %v", p)
+	}
+	if p := LSHProbability(64, 1, 1); p != 0 {
+		t.Errorf("a single 64-bit band matched a differing pair with probability %v", p)
+	}
+	curve := LSHCurve(64, 8)
+	for d := 1; d < len(curve); d++ {
+		if curve[d] > curve[d-1] {
+			t.Fatalf("S-curve rises at distance %d: %v", d, curve)
+		}
+	}
+
+	// The formula matches the permutation table that indexes use
+	table := NewPermutationTableWithSeed(64, 8, 1)
+	rng := rand.New(rand.NewSource(2))
+	const distance, trials = 12, 4000
+	hits := 0
+	for i := 0; i < trials; i++ {
+		a := SimHash(rng.Uint64())
+		b := a
+		for _, bit := range rng.Perm(64)[:distance] {
+			b ^= 1 << bit
+		}
+		sa, sb := table.GetBandSignatures(a), table.GetBandSignatures(b)
+		for band := range sa {
+			if sa[band] == sb[band] {
+				hits++
+				break
+			}
+		}
+	}
+	want := LSHProbability(64, 8, distance)
+	if got := float64(hits) / trials; math.Abs(got-want) > 0.05 {
+		t.Errorf("measured candidate rate %.3f, formula %.3f", got, want)
+	}
+}
+
+func TestTuneLSH(t *testing.T) {
+	best, estimates, err := TuneLSH(64, 3, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(estimates) != len(LSHLayouts(64)) {
+		t.Errorf("got %d estimates, want one per layout", len(estimates))
+	}
+	if best.Bands != 8 || best.BandSize != 8 {
+		t.Errorf("TuneLSH(64, 3, 0.95) = %+v, want 8 bands of 8 bits", best)
+	}
+
+	// Fewer candidates are preferred once the recall is met
+	if best, _, _ := TuneLSH(64, 1, 0.5); best.Bands != 2 {
+		t.Errorf("TuneLSH(64, 1, 0.5) = %+v, want 2 bands", best)
+	}
+	// Unreachable targets fall back to the highest recall
+	if best, _, _ := TuneLSH(64, 64, 0.99); best.Recall != LSHProbability(64, best.Bands, 64) {
+		t.Errorf("TuneLSH(64, 64, 0.99) = %+v", best)
+	}
+
+	if _, _, err := TuneLSH(64, -1, 0.9); err == nil {
+		t.Error("expected error for a negative threshold")
+	}
+	if _, _, err := TuneLSH(64, 3, 0); err == nil {
+		t.Error("expected error for zero recall")
+	}
+	if _, _, err := TuneLSH(100, 3, 0.9); err == nil {
+		t.Error("expected error for an unsupported width")
+	}
+}
@@ -0,0 +1,166 @@
+package simhash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ModelVersion is part of every model ID. It must change whenever the same
+// model parameters start producing different fingerprints, so fingerprints
+// from before and after never look comparable.
+//
+// Version 2 derives each group of hyperplanes from a mix of the seed and the
+// group, where version 1 added them.
+const ModelVersion = 2
+
+// DefaultSeed seeds the hyperplanes and LSH permutations of new models, and
+// is assumed for indexes built before the seed was recorded
+const DefaultSeed int64 = 42
+
+// LSHBandBits is the number of fingerprint bits per LSH band in default
+// models, so wider fingerprints get more bands
+const LSHBandBits = 16
+
+// Model is everything that decides the fingerprint of a text. Hyperplanes
+// and LSH permutations are derived from Seed, so a model is fully described
+// by its parameters and identified by a short ID. Fingerprints are only
+// comparable when their models have the same ID.
+type Model struct {
+	Vectorizer VectorizerConfig
+	Normalizer Normalizer
+	Language   Language
+	Algorithm  Algorithm
+	Bits       int
+	Seed       int64
+	LSHBands   int
+	// PlanesDigest identifies hyperplanes that were not generated from Seed;
+	// it is empty for seeded models
+	PlanesDigest string
+	// Planes are the hyperplanes PlanesDigest identifies, such as learned
+	// ones; nil for seeded models
+	Planes [][]float64
+}
+
+// DefaultModel returns the model used when no fingerprint settings are
+// given: the default vectorizer, normalization, algorithm and width
+func DefaultModel() Model {
+	vectorizer, _ := DefaultVectorizerConfig().WithDefaults()
+	normalizer, _ := ParseNormalizer(DefaultNormalizer)
+	return Model{
+		Vectorizer: vectorizer,
+		Normalizer: normalizer,
+		Language:   NoLanguage,
+		Algorithm:  DefaultAlgorithm,
+		Bits:       DefaultFingerprintBits,
+		Seed:       DefaultSeed,
+		LSHBands:   DefaultFingerprintBits / LSHBandBits,
+	}
+}
+
+// Validate checks that the model can produce fingerprints
+func (m Model) Validate() error {
+	if err := ValidateFingerprintBits(m.Bits); err != nil {
+		return err
+	}
+	return ValidateLSHBands(m.Bits, m.LSHBands)
+}
+
+// String returns the canonical description the model ID is derived from
+func (m Model) String() string {
+	spec := fmt.Sprintf("v%d algorithm=%s vectorizer=%s normalize=%s lang=%s bits=%d seed=%d lsh=%d",
+		ModelVersion, m.Algorithm, m.Vectorizer, m.Normalizer, m.language(), m.Bits, m.Seed, m.LSHBands)
+	if m.PlanesDigest != "" {
+		spec += " planes=" + m.PlanesDigest
+	}
+	return spec
+}
+
+// ID returns a short identifier of the model
+func (m Model) ID() string {
+	sum := sha256.Sum256([]byte(m.String()))
+	return hex.EncodeToString(sum[:4])
+}
+
+// language treats the empty language as NoLanguage, so both get one ID
+func (m Model) language() Language {
+	if m.Language == "" {
+		return NoLanguage
+	}
+	return m.Language
+}
+
+// Hyperplanes returns the model's hyperplanes, one per fingerprint bit,
+// generating them from the seed unless the model has its own
+func (m Model) Hyperplanes() [][]float64 {
+	if m.Planes != nil {
+		return m.Planes
+	}
+	return GenerateHyperplanesWithSeed(m.Vectorizer.Dimensions(), m.Bits, m.Seed)
+}
+
+// WithHyperplanes returns the model with hyperplanes that were not generated
+// from its seed, such as ones learned from a corpus
+func (m Model) WithHyperplanes(hyperplanes [][]float64) Model {
+	m.Planes = hyperplanes
+	m.PlanesDigest = HyperplanesDigest(hyperplanes)
+	return m
+}
+
+// Seeded returns the model with the hyperplanes generated from its seed
+func (m Model) Seeded() Model {
+	m.Planes = nil
+	m.PlanesDigest = ""
+	return m
+}
+
+// PermutationTable generates the model's LSH permutation table
+func (m Model) PermutationTable() *PermutationTable {
+	return NewPermutationTableWithSeed(m.Bits, m.LSHBands, m.Seed)
+}
+
+// NewVectorizer builds the model's vectorizer with its language and
+// normalization. Corpus vectorizers start without learned statistics.
+func (m Model) NewVectorizer() (Vectorizer, error) {
+	vectorizer, err := m.Vectorizer.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.language().Apply(vectorizer); err != nil {
+		return nil, err
+	}
+	return m.Normalizer.Wrap(vectorizer), nil
+}
+
+// FormatHash writes a fingerprint as model:hash
+func (m Model) FormatHash(fp Fingerprint) string {
+	return m.ID() + ":" + fp.String()
+}
+
+// SplitModelHash splits model:hash into its parts. Plain hashes have no
+// model.
+func SplitModelHash(s string) (model, hash string) {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// HyperplanesDigest identifies a hyperplane matrix that was not generated
+// from a seed
+func HyperplanesDigest(hyperplanes [][]float64) string {
+	h := sha256.New()
+	var buf [8]byte
+	for _, plane := range hyperplanes {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(plane)))
+		h.Write(buf[:])
+		for _, v := range plane {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+			h.Write(buf[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,101 @@
+package simhash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModelID(t *testing.T) {
+	model := DefaultModel()
+	if err := model.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	id := model.ID()
+	if len(id) != 8 || id != DefaultModel().ID() {
+		t.Fatalf("ID() = %q, want 8 stable hex digits", id)
+	}
+
+	changes := map[string]func(m *Model){
+		"seed":       func(m *Model) { m.Seed = 7 },
+		"bits":       func(m *Model) { m.Bits = 128; m.LSHBands = 8 },
+		"algorithm":  func(m *Model) { m.Algorithm = Charikar },
+		"language":   func(m *Model) { m.Language = English },
+		"normalizer": func(m *Model) { m.Normalizer = Normalizer{} },
+		"lsh":        func(m *Model) { m.LSHBands = 2 },
+		"planes":     func(m *Model) { m.PlanesDigest = "0011223344556677" },
+		"vectorizer": func(m *Model) { m.Vectorizer, _ = ParseVectorizerConfig("ngram:n=3") },
+	}
+	for name, change := range changes {
+		changed := DefaultModel()
+		change(&changed)
+		if changed.ID() == id {
+			t.Errorf("changing the %s keeps model ID %s", name, id)
+		}
+	}
+
+	// The empty language and NoLanguage are the same model
+	empty := DefaultModel()
+	empty.Language = ""
+	if empty.ID() != id {
+		t.Errorf("empty language gives model %s, want %s", empty.ID(), id)
+	}
+
+	bad := DefaultModel()
+	bad.LSHBands = 3
+	if err := bad.Validate(); err == nil {
+		t.Error("expected error for bands that do not divide the width")
+	}
+}
+
+func TestModelRegeneratesHyperplanes(t *testing.T) {
+	model := DefaultModel()
+	if !reflect.DeepEqual(model.Hyperplanes(), model.Hyperplanes()) {
+		t.Fatal("hyperplanes differ between calls")
+	}
+	if !reflect.DeepEqual(model.Hyperplanes(), GenerateHyperplanes(model.Vectorizer.Dimensions(), model.Bits)) {
+		t.Error("default seed does not reproduce GenerateHyperplanes")
+	}
+
+	other := model
+	other.Seed = 7
+	if reflect.DeepEqual(model.Hyperplanes(), other.Hyperplanes()) {
+		t.Error("different seeds give the same hyperplanes")
+	}
+	if reflect.DeepEqual(model.PermutationTable(), other.PermutationTable()) {
+		t.Error("different seeds give the same LSH permutations")
+	}
+
+	if HyperplanesDigest(model.Hyperplanes()) == HyperplanesDigest(other.Hyperplanes()) {
+		t.Error("different hyperplanes share a digest")
+	}
+}
+
+func TestModelWithHyperplanes(t *testing.T) {
+	model := DefaultModel()
+	custom := GenerateHyperplanesWithSeed(model.Vectorizer.Dimensions(), model.Bits, 7)
+
+	learned := model.WithHyperplanes(custom)
+	if !reflect.DeepEqual(learned.Hyperplanes(), custom) {
+		t.Error("Hyperplanes() ignores the model's own hyperplanes")
+	}
+	if learned.PlanesDigest != HyperplanesDigest(custom) || learned.ID() == model.ID() {
+		t.Errorf("model with custom hyperplanes has digest %q and ID %s", learned.PlanesDigest, learned.ID())
+	}
+	if seeded := learned.Seeded(); seeded.ID() != model.ID() || !reflect.DeepEqual(seeded.Hyperplanes(), model.Hyperplanes()) {
+		t.Error("Seeded() does not restore the generated hyperplanes")
+	}
+}
+
+func TestModelFormatHash(t *testing.T) {
+	model := DefaultModel()
+	fp := SimHash(0x1234).Fingerprint()
+	formatted := model.FormatHash(fp)
+
+	id, hash := SplitModelHash(formatted)
+	if id != model.ID() || hash != fp.String() {
+		t.Errorf("SplitModelHash(%q) = %q, %q", formatted, id, hash)
+	}
+	if id, hash := SplitModelHash("00000000000012ab"); id != "" || hash != "00000000000012ab" {
+		t.Errorf("plain hash split into %q, %q", id, hash)
+	}
+}
@@ -0,0 +1,189 @@
+package simhash
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultNormalizer is used for new indexes and for hashing without an index.
+// Indexes built before normalization was recorded used none.
+const DefaultNormalizer = "nfkc,fold,punct,space"
+
+// ExecNormalizer is the normalization used with the exec vectorizer when
+// none is given. Embedding models are trained on text as it is written, so
+// case and punctuation are left for them.
+const ExecNormalizer = "nfkc,space"
+
+// DefaultNormalizerFor returns the normalization a vectorizer is used with
+// when none is given: DefaultNormalizer, CodeNormalizer for code,
+// ExecNormalizer for exec or VectorNormalizer for vector
+func DefaultNormalizerFor(cfg VectorizerConfig) string {
+	switch cfg.Name {
+	case "code":
+		return CodeNormalizer
+	case "exec":
+		return ExecNormalizer
+	case "vector":
+		return VectorNormalizer
+	}
+	return DefaultNormalizer
+}
+
+// Normalizer canonicalizes text before it reaches a vectorizer, so that
+// spellings which read the same produce the same features
+type Normalizer struct {
+	NFKC            bool // Compatibility composition: full-width forms, ligatures
+	Fold            bool // Unicode case folding
+	StripDiacritics bool // "café" becomes "cafe"
+	Punctuation     bool // Straight quotes and hyphens, no invisible format characters
+	Whitespace      bool // Runs of whitespace become a single space
+}
+
+// normalizerSteps names the steps in the order they are applied
+var normalizerSteps = []string{"nfkc", "fold", "diacritics", "punct", "space"}
+
+// ParseNormalizer parses a comma-separated list of steps (nfkc, fold,
+// diacritics, punct, space), or "none". The empty string selects
+// DefaultNormalizer.
+func ParseNormalizer(spec string) (Normalizer, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = DefaultNormalizer
+	}
+
+	var n Normalizer
+	if spec == "none" {
+		return n, nil
+	}
+	for _, step := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(step) {
+		case "nfkc":
+			n.NFKC = true
+		case "fold":
+			n.Fold = true
+		case "diacritics":
+			n.StripDiacritics = true
+		case "punct":
+			n.Punctuation = true
+		case "space":
+			n.Whitespace = true
+		default:
+			return Normalizer{}, fmt.Errorf("unknown normalization step %q (available: %s, or none)",
+				step, strings.Join(normalizerSteps, ", "))
+		}
+	}
+	return n, nil
+}
+
+// String returns the canonical spec of the normalizer, "none" when it does
+// nothing
+func (n Normalizer) String() string {
+	enabled := []bool{n.NFKC, n.Fold, n.StripDiacritics, n.Punctuation, n.Whitespace}
+	var steps []string
+	for i, on := range enabled {
+		if on {
+			steps = append(steps, normalizerSteps[i])
+		}
+	}
+	if len(steps) == 0 {
+		return "none"
+	}
+	return strings.Join(steps, ",")
+}
+
+// Normalize applies the enabled steps to text. It is safe for concurrent use.
+func (n Normalizer) Normalize(text string) string {
+	if n.NFKC {
+		text = norm.NFKC.String(text)
+	}
+	if n.Fold {
+		// Casers keep state, so each call gets its own
+		text = cases.Fold().String(text)
+	}
+	if n.StripDiacritics {
+		text = norm.NFC.String(strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) {
+				return -1
+			}
+			return r
+		}, norm.NFD.String(text)))
+	}
+	if n.Punctuation {
+		text = strings.Map(canonicalPunctuation, text)
+	}
+	if n.Whitespace {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	return text
+}
+
+// canonicalPunctuation maps typographic punctuation to its ASCII form and
+// drops invisible format characters such as soft hyphens
+func canonicalPunctuation(r rune) rune {
+	switch r {
+	case '‘', '’', '‚', '‛', '′':
+		return '\''
+	case '“', '”', '„', '‟', '″':
+		return '"'
+	case '‐', '‑', '‒', '–', '—', '―', '−':
+		return '-'
+	}
+	if unicode.Is(unicode.Cf, r) {
+		return -1
+	}
+	return r
+}
+
+// Wrap returns a vectorizer that normalizes text before handing it to v.
+// Corpus vectorizers stay corpus vectorizers, observing normalized text.
+func (n Normalizer) Wrap(v Vectorizer) Vectorizer {
+	if n == (Normalizer{}) {
+		return v
+	}
+	nv := normalizedVectorizer{normalizer: n, vectorizer: v}
+	if cv, ok := v.(CorpusVectorizer); ok {
+		return &normalizedCorpusVectorizer{normalizedVectorizer: nv, corpus: cv}
+	}
+	return &nv
+}
+
+// normalizedVectorizer normalizes text in front of another vectorizer
+type normalizedVectorizer struct {
+	normalizer Normalizer
+	vectorizer Vectorizer
+}
+
+// TextToVector vectorizes the normalized text
+func (nv *normalizedVectorizer) TextToVector(text string) []float64 {
+	return nv.vectorizer.TextToVector(nv.normalizer.Normalize(text))
+}
+
+// Features returns the features of the normalized text
+func (nv *normalizedVectorizer) Features(text string) map[string]float64 {
+	return vectorFeatures(nv.vectorizer, nv.normalizer.Normalize(text))
+}
+
+// normalizedCorpusVectorizer normalizes text in front of a corpus vectorizer
+type normalizedCorpusVectorizer struct {
+	normalizedVectorizer
+	corpus CorpusVectorizer
+}
+
+// Observe learns from the normalized text
+func (nv *normalizedCorpusVectorizer) Observe(text string) {
+	nv.corpus.Observe(nv.normalizer.Normalize(text))
+}
+
+// MarshalBinary encodes the state of the wrapped vectorizer
+func (nv *normalizedCorpusVectorizer) MarshalBinary() ([]byte, error) {
+	return nv.corpus.MarshalBinary()
+}
+
+// UnmarshalBinary restores the state of the wrapped vectorizer
+func (nv *normalizedCorpusVectorizer) UnmarshalBinary(data []byte) error {
+	return nv.corpus.UnmarshalBinary(data)
+}
@@ -0,0 +1,98 @@
+package simhash
+
+import (
+	"testing"
+)
+
+func TestParseNormalizer(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"", DefaultNormalizer, false},
+		{"none", "none", false},
+		{"space, nfkc", "nfkc,space", false},
+		{"fold,diacritics", "fold,diacritics", false},
+		{"stem", "", true},
+	}
+
+	for _, tt := range tests {
+		n, err := ParseNormalizer(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNormalizer(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && n.String() != tt.want {
+			t.Errorf("ParseNormalizer(%q) = %s, want %s", tt.spec, n, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	all, _ := ParseNormalizer("nfkc,fold,diacritics,punct,space")
+	def, _ := ParseNormalizer("")
+
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		in, want   string
+	}{
+		{"full-width", Normalizer{NFKC: true}, "ＡＢＣ１２３", "ABC123"},
+		{"ligature", Normalizer{NFKC: true}, "ﬁnd", "find"},
+		{"case folding", Normalizer{Fold: true}, "Straße CAFÉ", "strasse café"},
+		{"diacritics", Normalizer{StripDiacritics: true}, "café naïve Ångström", "cafe naive Angstrom"},
+		{"curly quotes", Normalizer{Punctuation: true}, "“it’s” — done", "\"it's\" - done"},
+		{"soft hyphen", Normalizer{Punctuation: true}, "hy\u00adphen\u200bated", "hyphenated"},
+		{"whitespace", Normalizer{Whitespace: true}, "  a\t\tb\n c ", "a b c"},
+		{"default keeps diacritics", def, "Café", "café"},
+		{"everything", all, "  “CAFÉ” ﬁne ", "\"cafe\" fine"},
+		{"none", Normalizer{}, "Café ", "Café "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.normalizer.Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizerWrap(t *testing.T) {
+	v := NewFrequencyVectorizer(VectorDimensions)
+	if got := (Normalizer{}).Wrap(v); got != Vectorizer(v) {
+		t.Error("the empty normalizer should not wrap the vectorizer")
+	}
+
+	n, _ := ParseNormalizer("nfkc,fold,diacritics,punct,space")
+	wrapped := n.Wrap(v)
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 64)
+	for _, alg := range []Algorithm{Hyperplane, Charikar} {
+		a := CalculateWithAlgorithm(alg, "The café’s ＭＥＮＵ", hyperplanes, wrapped)
+		b := CalculateWithAlgorithm(alg, "the cafe's menu", hyperplanes, wrapped)
+		if a != b {
+			t.Errorf("%s: normalized spellings hash to %x and %x", alg, a, b)
+		}
+	}
+
+	// Corpus vectorizers observe normalized text
+	corpus := n.Wrap(NewTFIDFVectorizer(VectorDimensions))
+	cv, ok := corpus.(CorpusVectorizer)
+	if !ok {
+		t.Fatal("wrapping a corpus vectorizer should keep it a CorpusVectorizer")
+	}
+	cv.Observe("CAFÉ")
+	cv.Observe("other words")
+	state, err := cv.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewTFIDFVectorizer(VectorDimensions)
+	if err := restored.UnmarshalBinary(state); err != nil {
+		t.Fatal(err)
+	}
+	if restored.IDF("cafe") >= restored.IDF("unseen") {
+		t.Error("expected the normalized word to have been observed")
+	}
+}
@@ -0,0 +1,324 @@
+package simhash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxCachedFeatures bounds the feature hashes each scratch space of a
+// Projector keeps. Features first seen after that are hashed every time.
+const maxCachedFeatures = 1 << 16
+
+// featureCounter is implemented by the built-in vectorizers, whose vector
+// is the unit-length sum of their features, each added to the dimension the
+// first four bytes of its MD5 pick
+type featureCounter interface {
+	Vectorizer
+	Dimensions() int
+	// countFeatures adds the weighted features of text to counts, which are
+	// empty, in place of the map Features returns
+	countFeatures(text string, counts *featureCounts)
+}
+
+// featureDimensions returns the dimensions of a vectorizer that counts
+// features, looking through normalization
+func featureDimensions(v Vectorizer) (int, bool) {
+	switch v := v.(type) {
+	case featureCounter:
+		return v.Dimensions(), true
+	case *normalizedVectorizer:
+		return featureDimensions(v.vectorizer)
+	case *normalizedCorpusVectorizer:
+		return featureDimensions(v.vectorizer)
+	}
+	return 0, false
+}
+
+// countFeatures counts the features of text with a vectorizer
+// featureDimensions accepts, normalizing the text first where it asks to
+func countFeatures(v Vectorizer, text string, counts *featureCounts) {
+	switch v := v.(type) {
+	case featureCounter:
+		v.countFeatures(text, counts)
+	case *normalizedVectorizer:
+		countFeatures(v.vectorizer, v.normalizer.Normalize(text), counts)
+	case *normalizedCorpusVectorizer:
+		countFeatures(v.vectorizer, v.normalizer.Normalize(text), counts)
+	}
+}
+
+// featureCounts collects the weighted features of a text. Vectorizers whose
+// weights are whole numbers add them with add and addKey; TF-IDF sets its
+// weights in features. A Projector keeps one per scratch space, reusing the
+// token slice and key buffer from one text to the next, and folds added
+// features straight into their dimensions, as whole numbers sum exactly in
+// any order. With the hash of each feature cached, a feature built in the
+// key buffer then never becomes a string.
+type featureCounts struct {
+	features map[string]float64
+	tokens   []string          // Scratch space for tokenizing
+	key      []byte            // Scratch space for building a feature
+	hashes   map[string]uint32 // Cached hashes of features seen before
+	// fold adds weight to the dimension of a feature hash; when it is nil,
+	// added features are collected in features
+	fold func(hash uint32, weight float64)
+}
+
+// newFeatureCounts returns counts that collect features
+func newFeatureCounts() *featureCounts {
+	return &featureCounts{features: make(map[string]float64)}
+}
+
+// add adds weight to a feature
+func (fc *featureCounts) add(feature string, weight float64) {
+	if fc.fold == nil {
+		fc.features[feature] += weight
+		return
+	}
+	fc.fold(fc.hash(feature), weight)
+}
+
+// addKey adds weight to the feature held in the key buffer
+func (fc *featureCounts) addKey(weight float64) {
+	if fc.fold == nil {
+		fc.features[string(fc.key)] += weight
+		return
+	}
+	h, ok := fc.hashes[string(fc.key)]
+	if !ok {
+		h = md5Prefix(fc.key)
+		if len(fc.hashes) < maxCachedFeatures {
+			fc.hashes[string(fc.key)] = h
+		}
+	}
+	fc.fold(h, weight)
+}
+
+// hash returns the first four bytes of the MD5 of a feature
+func (fc *featureCounts) hash(feature string) uint32 {
+	if h, ok := fc.hashes[feature]; ok {
+		return h
+	}
+	h := md5Prefix([]byte(feature))
+	if len(fc.hashes) < maxCachedFeatures {
+		// Features are often substrings of a whole chunk, which the cache
+		// must not keep alive
+		fc.hashes[strings.Clone(feature)] = h
+	}
+	return h
+}
+
+// md5Prefix returns the first four bytes of the MD5 of b
+func md5Prefix(b []byte) uint32 {
+	sum := md5.Sum(b)
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// Projector computes hyperplane fingerprints from sparse feature weights.
+// CalculateFingerprint fills a dense vector and takes a full dot product
+// with every hyperplane; a Projector only visits the dimensions a text
+// uses. It keeps the hyperplanes by dimension, so the contributions of one
+// dimension to every bit are adjacent, caches the hash of each feature, and
+// reuses its maps and slices from one text to the next. Sums are taken in
+// the same order as in CalculateFingerprint, so fingerprints are identical.
+// A Projector is safe for concurrent use.
+type Projector struct {
+	width   int       // Fingerprint width
+	planes  int       // Hyperplanes used, at most width
+	dims    int       // Hyperplane dimensions
+	columns []float64 // columns[j*planes+i] is component j of hyperplane i
+	scratch sync.Pool // *projection
+}
+
+// NewProjector creates a projector for fingerprints of the given width. Like
+// CalculateFingerprint, it needs at least width hyperplanes.
+func NewProjector(width int, hyperplanes [][]float64) *Projector {
+	p := &Projector{width: width, planes: min(width, len(hyperplanes))}
+	if p.planes > 0 {
+		p.dims = len(hyperplanes[0])
+	}
+	p.columns = make([]float64, p.dims*p.planes)
+	for i, hyperplane := range hyperplanes[:p.planes] {
+		for j, component := range hyperplane {
+			p.columns[j*p.planes+i] = component
+		}
+	}
+	return p
+}
+
+// Fingerprint computes the hyperplane fingerprint of text. The built-in
+// vectorizers are projected from their features; any other from its dense
+// vector, skipping zero dimensions.
+func (p *Projector) Fingerprint(text string, vectorizer Vectorizer) Fingerprint {
+	pr := p.get()
+	defer p.put(pr)
+
+	dims, ok := featureDimensions(vectorizer)
+	if !ok {
+		pr.projectVector(vectorizer.TextToVector(text))
+		return pr.fingerprint()
+	}
+
+	pr.resize(dims)
+	countFeatures(vectorizer, text, &pr.counts)
+	pr.fold()
+
+	// Dimensions are visited in increasing order, as a dense dot product
+	// visits them
+	slices.Sort(pr.touched)
+	magnitude := 0.0
+	for _, dim := range pr.touched {
+		magnitude += pr.weights[dim] * pr.weights[dim]
+	}
+	magnitude = math.Sqrt(magnitude)
+	for _, dim := range pr.touched {
+		v := pr.weights[dim]
+		if magnitude > 0 {
+			v /= magnitude
+		}
+		if v != 0 {
+			pr.project(dim, v)
+		}
+	}
+	return pr.fingerprint()
+}
+
+// FingerprintVector computes the hyperplane fingerprint of a vector computed
+// elsewhere, the one CalculateFingerprint gives for a vectorizer returning it
+func (p *Projector) FingerprintVector(vector []float64) Fingerprint {
+	pr := p.get()
+	defer p.put(pr)
+
+	pr.projectVector(vector)
+	return pr.fingerprint()
+}
+
+// get returns cleared scratch space
+func (p *Projector) get() *projection {
+	if pr, ok := p.scratch.Get().(*projection); ok {
+		return pr
+	}
+	pr := &projection{
+		projector: p,
+		counts: featureCounts{
+			features: make(map[string]float64),
+			hashes:   make(map[string]uint32),
+		},
+		sums: make([]float64, p.planes),
+	}
+	pr.counts.fold = func(hash uint32, weight float64) {
+		pr.add(int(hash%pr.dims), weight)
+	}
+	return pr
+}
+
+// put clears scratch space and returns it for reuse
+func (p *Projector) put(pr *projection) {
+	clear(pr.counts.features)
+	// Tokens are substrings of the text, which must not be kept alive
+	clear(pr.counts.tokens)
+	pr.counts.tokens = pr.counts.tokens[:0]
+	for _, dim := range pr.touched {
+		pr.weights[dim] = 0
+		pr.seen[dim] = false
+	}
+	pr.touched = pr.touched[:0]
+	pr.keys = pr.keys[:0]
+	clear(pr.sums)
+	p.scratch.Put(pr)
+}
+
+// projection is the scratch space of one fingerprint
+type projection struct {
+	projector *Projector
+	counts    featureCounts // Features of the text
+	keys      []string      // Features in sorted order, when needed
+	dims      uint32        // Dimensions of the vectorizer
+	weights   []float64     // Weight of each dimension
+	seen      []bool        // Whether a dimension is in touched
+	touched   []int         // Dimensions with features
+	sums      []float64     // Dot product with each hyperplane
+}
+
+// resize makes room for the weights of a vectorizer with dims dimensions
+func (pr *projection) resize(dims int) {
+	pr.dims = uint32(dims)
+	if len(pr.weights) < dims {
+		pr.weights = make([]float64, dims)
+		pr.seen = make([]bool, dims)
+	}
+}
+
+// fold adds the weight of every collected feature to its dimension.
+// Whole-number weights sum exactly in any order; other weights are added in
+// the sorted order TF-IDF uses, so they round the same way.
+func (pr *projection) fold() {
+	features := pr.counts.features
+	whole := true
+	for _, weight := range features {
+		if weight != math.Trunc(weight) {
+			whole = false
+			break
+		}
+	}
+	if whole {
+		for feature, weight := range features {
+			pr.counts.fold(pr.counts.hash(feature), weight)
+		}
+		return
+	}
+
+	for feature := range features {
+		pr.keys = append(pr.keys, feature)
+	}
+	slices.Sort(pr.keys)
+	for _, feature := range pr.keys {
+		pr.counts.fold(pr.counts.hash(feature), features[feature])
+	}
+}
+
+// add adds weight to a dimension
+func (pr *projection) add(dim int, weight float64) {
+	if !pr.seen[dim] {
+		pr.seen[dim] = true
+		pr.touched = append(pr.touched, dim)
+	}
+	pr.weights[dim] += weight
+}
+
+// project adds the contribution of dimension dim with value v to the dot
+// product with every hyperplane
+func (pr *projection) project(dim int, v float64) {
+	p := pr.projector
+	if dim >= p.dims {
+		return
+	}
+	for i, h := range p.columns[dim*p.planes : (dim+1)*p.planes] {
+		pr.sums[i] += v * h
+	}
+}
+
+// projectVector adds the contribution of every nonzero dimension of vector
+func (pr *projection) projectVector(vector []float64) {
+	for j, v := range vector {
+		if v != 0 {
+			pr.project(j, v)
+		}
+	}
+}
+
+// fingerprint sets bit i when the dot product with hyperplane i is not
+// negative
+func (pr *projection) fingerprint() Fingerprint {
+	fp := NewFingerprint(pr.projector.width)
+	for i, sum := range pr.sums {
+		if sum >= 0 {
+			fp.SetBit(i)
+		}
+	}
+	return fp
+}
@@ -0,0 +1,237 @@
+package simhash
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVectorizer is used when no vectorizer is configured, and is assumed
+// for indexes built before the vectorizer was recorded
+const DefaultVectorizer = "frequency"
+
+// VectorizerConfig names a registered vectorizer and its parameters. Its
+// canonical String form is stored with an index so every command that
+// queries the index builds exactly the same vectorizer.
+type VectorizerConfig struct {
+	Name   string
+	Params map[string]string
+}
+
+// VectorizerFactory builds a vectorizer from fully defaulted parameters
+type VectorizerFactory func(params VectorizerParams) (Vectorizer, error)
+
+// VectorizerParams gives typed access to vectorizer parameters
+type VectorizerParams map[string]string
+
+type vectorizerEntry struct {
+	defaults map[string]string
+	factory  VectorizerFactory
+}
+
+var (
+	registryMu  sync.RWMutex
+	vectorizers = make(map[string]vectorizerEntry)
+)
+
+func init() {
+	RegisterVectorizer("frequency", map[string]string{"dims": "128"},
+		func(p VectorizerParams) (Vectorizer, error) {
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			return NewFrequencyVectorizer(dims), nil
+		})
+
+	RegisterVectorizer("ngram", map[string]string{"dims": "128", "n": "3"},
+		func(p VectorizerParams) (Vectorizer, error) {
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			n, err := p.Int("n")
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("ngram size must be a positive integer, got %q", p["n"])
+			}
+			return NewNGramVectorizer(dims, n), nil
+		})
+}
+
+// RegisterVectorizer makes a vectorizer selectable by name. Every parameter
+// the factory understands must have an entry in defaults.
+func RegisterVectorizer(name string, defaults map[string]string, factory VectorizerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	vectorizers[name] = vectorizerEntry{defaults: defaults, factory: factory}
+}
+
+// VectorizerNames lists the registered vectorizers
+func VectorizerNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(vectorizers))
+	for name := range vectorizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultVectorizerConfig returns the fully defaulted DefaultVectorizer
+func DefaultVectorizerConfig() VectorizerConfig {
+	cfg, _ := ParseVectorizerConfig(DefaultVectorizer)
+	return cfg
+}
+
+// ParseVectorizerConfig parses "name" or "name:key=value,key=value" and
+// fills in the defaults of the named vectorizer
+func ParseVectorizerConfig(spec string) (VectorizerConfig, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = DefaultVectorizer
+	}
+
+	name, rest, _ := strings.Cut(spec, ":")
+	params := make(map[string]string)
+	if rest != "" {
+		for _, pair := range strings.Split(rest, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				return VectorizerConfig{}, fmt.Errorf("invalid vectorizer parameter %q in %q", pair, spec)
+			}
+			params[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return VectorizerConfig{Name: name, Params: params}.WithDefaults()
+}
+
+// WithDefaults validates the config against the registry and adds any
+// parameters that were left out
+func (c VectorizerConfig) WithDefaults() (VectorizerConfig, error) {
+	registryMu.RLock()
+	entry, ok := vectorizers[c.Name]
+	registryMu.RUnlock()
+	if !ok {
+		return c, fmt.Errorf("unknown vectorizer %q (available: %s)", c.Name, strings.Join(VectorizerNames(), ", "))
+	}
+
+	params := make(map[string]string, len(entry.defaults))
+	for key, value := range entry.defaults {
+		params[key] = value
+	}
+	for key, value := range c.Params {
+		if _, known := entry.defaults[key]; !known {
+			return c, fmt.Errorf("vectorizer %s has no parameter %q", c.Name, key)
+		}
+		params[key] = value
+	}
+
+	return VectorizerConfig{Name: c.Name, Params: params}, nil
+}
+
+// String returns the canonical form, with parameters sorted by key
+func (c VectorizerConfig) String() string {
+	if len(c.Params) == 0 {
+		return c.Name
+	}
+
+	keys := make([]string, 0, len(c.Params))
+	for key := range c.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + c.Params[key]
+	}
+	return c.Name + ":" + strings.Join(pairs, ",")
+}
+
+// Equal reports whether two configs build identical vectorizers
+func (c VectorizerConfig) Equal(other VectorizerConfig) bool {
+	a, errA := c.WithDefaults()
+	b, errB := other.WithDefaults()
+	if errA != nil || errB != nil {
+		return c.String() == other.String()
+	}
+	return a.String() == b.String()
+}
+
+// New builds the configured vectorizer
+func (c VectorizerConfig) New() (Vectorizer, error) {
+	full, err := c.WithDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	entry := vectorizers[full.Name]
+	registryMu.RUnlock()
+
+	return entry.factory(VectorizerParams(full.Params))
+}
+
+// Dimensions returns the vector size the config produces, which is the
+// dimension the hyperplanes must have
+func (c VectorizerConfig) Dimensions() int {
+	if dims, err := VectorizerParams(c.Params).Int("dims"); err == nil && dims > 0 {
+		return dims
+	}
+	return VectorDimensions
+}
+
+// Int returns an integer parameter
+func (p VectorizerParams) Int(key string) (int, error) {
+	v, err := strconv.Atoi(p[key])
+	if err != nil {
+		return 0, fmt.Errorf("vectorizer parameter %s must be an integer, got %q", key, p[key])
+	}
+	return v, nil
+}
+
+// Dims returns the "dims" parameter, which must be positive
+func (p VectorizerParams) Dims() (int, error) {
+	dims, err := p.Int("dims")
+	if err != nil {
+		return 0, err
+	}
+	if dims <= 0 {
+		return 0, fmt.Errorf("vectorizer dimensions must be positive, got %d", dims)
+	}
+	return dims, nil
+}
+
+// Float returns a floating point parameter
+func (p VectorizerParams) Float(key string) (float64, error) {
+	v, err := strconv.ParseFloat(p[key], 64)
+	if err != nil {
+		return 0, fmt.Errorf("vectorizer parameter %s must be a number, got %q", key, p[key])
+	}
+	return v, nil
+}
+
+// Bool returns a boolean parameter
+func (p VectorizerParams) Bool(key string) (bool, error) {
+	v, err := strconv.ParseBool(p[key])
+	if err != nil {
+		return false, fmt.Errorf("vectorizer parameter %s must be true or false, got %q", key, p[key])
+	}
+	return v, nil
+}
+
+// Duration returns a duration parameter such as "30s"
+func (p VectorizerParams) Duration(key string) (time.Duration, error) {
+	v, err := time.ParseDuration(p[key])
+	if err != nil {
+		return 0, fmt.Errorf("vectorizer parameter %s must be a duration, got %q", key, p[key])
+	}
+	return v, nil
+}
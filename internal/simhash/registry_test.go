@@ -0,0 +1,74 @@
+package simhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVectorizerConfig(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr string
+	}{
+		{spec: "", want: "frequency:dims=128"},
+		{spec: "frequency", want: "frequency:dims=128"},
+		{spec: "ngram", want: "ngram:dims=128,n=3"},
+		{spec: "ngram:n=5, dims=64", want: "ngram:dims=64,n=5"},
+		{spec: "bogus", wantErr: "unknown vectorizer"},
+		{spec: "ngram:size=3", wantErr: "no parameter"},
+		{spec: "ngram:n", wantErr: "invalid vectorizer parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			cfg, err := ParseVectorizerConfig(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseVectorizerConfig(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseVectorizerConfig(%q) failed: %v", tt.spec, err)
+			}
+			if got := cfg.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			// The canonical form must parse back to the same config
+			again, err := ParseVectorizerConfig(cfg.String())
+			if err != nil || !again.Equal(cfg) {
+				t.Errorf("round trip of %q gave %v, %v", cfg, again, err)
+			}
+		})
+	}
+}
+
+func TestVectorizerConfigNew(t *testing.T) {
+	cfg, err := ParseVectorizerConfig("ngram:dims=32,n=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Dimensions() != 32 {
+		t.Errorf("Dimensions() = %d, want 32", cfg.Dimensions())
+	}
+
+	vectorizer, err := cfg.New()
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := len(vectorizer.TextToVector("some text to vectorize")); got != 32 {
+		t.Errorf("vector length = %d, want 32", got)
+	}
+
+	for _, spec := range []string{"ngram:n=0", "frequency:dims=-1", "frequency:dims=x"} {
+		cfg, err := ParseVectorizerConfig(spec)
+		if err != nil {
+			t.Fatalf("ParseVectorizerConfig(%q) failed: %v", spec, err)
+		}
+		if _, err := cfg.New(); err == nil {
+			t.Errorf("New() for %q should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package simhash
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// noSpaceScripts are the scripts whose words are not separated by spaces
+var noSpaceScripts = []string{"Han", "Hiragana", "Katakana", "Thai", "Lao", "Khmer", "Myanmar"}
+
+var noSpaceTables = func() []*unicode.RangeTable {
+	tables := make([]*unicode.RangeTable, len(noSpaceScripts))
+	for i, name := range noSpaceScripts {
+		tables[i] = unicode.Scripts[name]
+	}
+	return tables
+}()
+
+// noSpaceMin is the first rune of a script written without spaces, so most
+// text is ruled out without looking the rune up
+var noSpaceMin = func() rune {
+	first := rune(unicode.MaxRune)
+	for _, table := range noSpaceTables {
+		if len(table.R16) > 0 {
+			first = min(first, rune(table.R16[0].Lo))
+		} else if len(table.R32) > 0 {
+			first = min(first, rune(table.R32[0].Lo))
+		}
+	}
+	return first
+}()
+
+// detectedScripts are the scripts DetectScript can name
+var detectedScripts = []string{
+	"Latin", "Cyrillic", "Greek", "Arabic", "Hebrew", "Devanagari", "Hangul",
+	"Han", "Hiragana", "Katakana", "Thai", "Lao", "Khmer", "Myanmar",
+}
+
+// DetectScript returns the Unicode script most letters of text are written
+// in, or "" when text has no letters in a known script. Kana and Han count
+// together as Han, since Japanese mixes them freely.
+func DetectScript(text string) string {
+	counts := make(map[string]int)
+	countScripts(counts, text)
+	return dominantScript(counts)
+}
+
+// countScripts adds the letters of text to the count of their script
+func countScripts(counts map[string]int, text string) {
+	// ASCII letters are counted apart, since they are most letters
+	latin := 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+				latin++
+			}
+			continue
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, name := range detectedScripts {
+			if unicode.Is(unicode.Scripts[name], r) {
+				if name == "Hiragana" || name == "Katakana" {
+					name = "Han"
+				}
+				counts[name]++
+				break
+			}
+		}
+	}
+	if latin > 0 {
+		counts["Latin"] += latin
+	}
+}
+
+// dominantScript returns the script with the most letters, the first of
+// detectedScripts on ties
+func dominantScript(counts map[string]int) string {
+	best := ""
+	for _, name := range detectedScripts {
+		if counts[name] > counts[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+// NoSpaceScript reports whether a script is written without spaces between
+// words
+func NoSpaceScript(script string) bool {
+	for _, name := range noSpaceScripts {
+		if name == script {
+			return true
+		}
+	}
+	return false
+}
+
+// isNoSpaceScript reports whether r belongs to a script written without
+// spaces. The Japanese prolonged sound mark is shared by two scripts and
+// counted with them.
+func isNoSpaceScript(r rune) bool {
+	return r >= noSpaceMin && (r == 'ー' || unicode.In(r, noSpaceTables...))
+}
+
+// appendSegments splits a field mixing scripts: runs of no-space scripts
+// become character bigrams, other runs stay words, and punctuation separates
+// them
+func appendSegments(result []string, field string) []string {
+	var word, run []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			result = append(result, string(word))
+			word = word[:0]
+		}
+	}
+	flushRun := func() {
+		result = appendBigrams(result, run)
+		run = run[:0]
+	}
+
+	for _, r := range field {
+		switch {
+		case isNoSpaceScript(r):
+			flushWord()
+			run = append(run, r)
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flushWord()
+			flushRun()
+		default:
+			flushRun()
+			word = append(word, r)
+		}
+	}
+	flushWord()
+	flushRun()
+	return result
+}
+
+// appendBigrams adds the overlapping character bigrams of run, or run itself
+// when it is a single character
+func appendBigrams(result []string, run []rune) []string {
+	if len(run) == 1 {
+		return append(result, string(run))
+	}
+	for i := 0; i+2 <= len(run); i++ {
+		result = append(result, string(run[i:i+2]))
+	}
+	return result
+}
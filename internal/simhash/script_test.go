@@ -0,0 +1,78 @@
+package simhash
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDetectScript(t *testing.T) {
+	tests := map[string]string{
+		"plain English text": "Latin",
+		"東京タワーに行きました":        "Han",
+		"สวัสดีครับ":         "Thai",
+		"Привет, мир":        "Cyrillic",
+		"iPhone 15 发布会在北京举行": "Han",
+		"12345 !!!":          "",
+	}
+
+	for text, want := range tests {
+		if got := DetectScript(text); got != want {
+			t.Errorf("DetectScript(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestWordsSegmentsNoSpaceScripts(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, world", []string{"hello", "world"}},
+		{"東京タワー", []string{"東京", "京タ", "タワ", "ワー"}},
+		{"我爱北京。", []string{"我爱", "爱北", "北京"}},
+		{"iPhone发布了", []string{"iphone", "发布", "布了"}},
+		{"天，地", []string{"天", "地"}},
+	}
+
+	for _, tt := range tests {
+		if got := words(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNGramFeaturesAreRuneAware(t *testing.T) {
+	nv := NewNGramVectorizer(VectorDimensions, 3)
+
+	for feature := range nv.Features("naïve café résumé") {
+		if !utf8.ValidString(feature) {
+			t.Fatalf("n-gram %q cuts a character in half", feature)
+		}
+		if n := utf8.RuneCountInString(feature); n != 3 {
+			t.Errorf("n-gram %q has %d characters, want 3", feature, n)
+		}
+	}
+
+	// Chinese text switches to character bigrams
+	features := nv.Features("我爱北京天安门")
+	if _, ok := features["北京"]; !ok || len(features) != 6 {
+		t.Errorf("expected six character bigrams, got %v", features)
+	}
+}
+
+func TestCJKNearDuplicates(t *testing.T) {
+	original := "今天天气很好，我们一起去公园散步，然后在湖边吃午饭，下午回家休息。"
+	edited := "今天天气很好，我们一起去公园散步，然后在湖边吃晚饭，晚上回家休息。"
+	other := "股票市场周二大幅上涨，投资者正在评估最新的通货膨胀数据和央行政策。"
+
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 64)
+	for _, v := range []Vectorizer{NewFrequencyVectorizer(VectorDimensions), NewNGramVectorizer(VectorDimensions, 3)} {
+		a := CalculateWithVectorizer(original, hyperplanes, v)
+		b := CalculateWithVectorizer(edited, hyperplanes, v)
+		c := CalculateWithVectorizer(other, hyperplanes, v)
+		if near, far := a.HammingDistance(b), a.HammingDistance(c); near >= far {
+			t.Errorf("%T: near-duplicate distance %d, unrelated distance %d", v, near, far)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package simhash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ShingleVectorizer counts k-word shingles, the runs of k consecutive words,
+// hashed into a fixed number of dimensions. Unlike a bag of words it keeps
+// phrase-level word order, which is what copied sentences share.
+type ShingleVectorizer struct {
+	dimensions int
+	size       int
+	tokenizer  Tokenizer
+}
+
+func init() {
+	RegisterVectorizer("shingle", map[string]string{"dims": "256", "k": "3"},
+		func(p VectorizerParams) (Vectorizer, error) {
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			k, err := p.Int("k")
+			if err != nil || k <= 0 {
+				return nil, fmt.Errorf("shingle size must be a positive integer, got %q", p["k"])
+			}
+			return NewShingleVectorizer(dims, k), nil
+		})
+}
+
+// NewShingleVectorizer creates a vectorizer over shingles of size words
+func NewShingleVectorizer(dimensions, size int) *ShingleVectorizer {
+	return &ShingleVectorizer{dimensions: dimensions, size: size}
+}
+
+// SetTokenizer replaces the tokenizer that splits text into words
+func (sv *ShingleVectorizer) SetTokenizer(t Tokenizer) {
+	sv.tokenizer = t
+}
+
+// countFeatures adds the shingle counts of text to counts. Text shorter
+// than one shingle is a single shingle of all its words.
+func (sv *ShingleVectorizer) countFeatures(text string, counts *featureCounts) {
+	counts.tokens = appendTokens(counts.tokens[:0], sv.tokenizer, text)
+	addShingles(counts.tokens, sv.size, counts)
+}
+
+// addShingles adds one to counts for every run of size tokens, joined by
+// spaces, or for all tokens when there are fewer. Counts that fold features
+// into dimensions take each shingle in the key buffer, so none becomes a
+// string; otherwise the shingles are written into one string and cut from
+// it, which costs a single allocation.
+func addShingles(tokens []string, size int, counts *featureCounts) {
+	if len(tokens) == 0 {
+		return
+	}
+	size = min(size, len(tokens))
+
+	if counts.fold != nil {
+		for i := 0; i+size <= len(tokens); i++ {
+			counts.key = counts.key[:0]
+			for j, token := range tokens[i : i+size] {
+				if j > 0 {
+					counts.key = append(counts.key, ' ')
+				}
+				counts.key = append(counts.key, token...)
+			}
+			counts.addKey(1)
+		}
+		return
+	}
+
+	var sb strings.Builder
+	length := size - 1
+	for _, token := range tokens[:size] {
+		length += len(token)
+	}
+	sb.Grow(length * (len(tokens) - size + 1))
+
+	ends := make([]int, 0, len(tokens)-size+1)
+	for i := 0; i+size <= len(tokens); i++ {
+		for j, token := range tokens[i : i+size] {
+			if j > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(token)
+		}
+		ends = append(ends, sb.Len())
+	}
+
+	all, start := sb.String(), 0
+	for _, end := range ends {
+		counts.features[all[start:end]]++
+		start = end
+	}
+}
+
+// TextToVector converts text to a normalized shingle vector
+func (sv *ShingleVectorizer) TextToVector(text string) []float64 {
+	vector := make([]float64, sv.dimensions)
+
+	for shingle, freq := range sv.Features(text) {
+		hash := md5.Sum([]byte(shingle))
+		dim := int(binary.BigEndian.Uint32(hash[:4]) % uint32(sv.dimensions))
+		vector[dim] += freq
+	}
+
+	magnitude := 0.0
+	for _, v := range vector {
+		magnitude += v * v
+	}
+	magnitude = math.Sqrt(magnitude)
+
+	if magnitude > 0 {
+		for i := range vector {
+			vector[i] /= magnitude
+		}
+	}
+
+	return vector
+}
+
+// Features returns the shingle counts of text
+func (sv *ShingleVectorizer) Features(text string) map[string]float64 {
+	counts := newFeatureCounts()
+	sv.countFeatures(text, counts)
+	return counts.features
+}
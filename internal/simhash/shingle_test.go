@@ -0,0 +1,64 @@
+package simhash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShingleFeatures(t *testing.T) {
+	sv := NewShingleVectorizer(VectorDimensions, 2)
+
+	got := sv.Features("The cat sat. The cat ran!")
+	want := map[string]float64{"the cat": 2, "cat sat": 1, "sat the": 1, "cat ran": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Features = %v, want %v", got, want)
+	}
+
+	if got := sv.Features("alone"); !reflect.DeepEqual(got, map[string]float64{"alone": 1}) {
+		t.Errorf("short text Features = %v, want a single shingle", got)
+	}
+	if got := sv.TextToVector(""); len(got) != VectorDimensions {
+		t.Errorf("empty text vector has %d dimensions, want %d", len(got), VectorDimensions)
+	}
+}
+
+func TestShingleVectorizerRegistered(t *testing.T) {
+	cfg, err := ParseVectorizerConfig("shingle:k=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.String() != "shingle:dims=256,k=4" {
+		t.Errorf("String() = %q", cfg.String())
+	}
+	v, err := cfg.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv, ok := v.(*ShingleVectorizer); !ok || sv.size != 4 || sv.dimensions != 256 {
+		t.Errorf("New() = %#v", v)
+	}
+
+	zero, err := ParseVectorizerConfig("shingle:k=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zero.New(); err == nil {
+		t.Error("expected an error for a zero shingle size")
+	}
+}
+
+func TestShingleVectorizerKeepsWordOrder(t *testing.T) {
+	text := "the committee approved the budget after a long debate about the new school building"
+	shuffled := "the budget approved the committee about a long debate after the new building school"
+
+	bag := NewFrequencyVectorizer(256)
+	shingles := NewShingleVectorizer(256, 3)
+
+	// Both texts have the same words, so only shingles tell them apart
+	if s := cosine(bag.TextToVector(text), bag.TextToVector(shuffled)); s < 0.999 {
+		t.Fatalf("bag of words cosine = %.3f, want 1", s)
+	}
+	if s := cosine(shingles.TextToVector(text), shingles.TextToVector(shuffled)); s > 0.5 {
+		t.Errorf("shingle cosine of reordered text = %.3f, want well below 1", s)
+	}
+}
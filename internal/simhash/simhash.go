@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 const (
@@ -33,6 +34,7 @@ type Vectorizer interface {
 // FrequencyVectorizer implements simple frequency-based vectorization
 type FrequencyVectorizer struct {
 	dimensions int
+	tokenizer  Tokenizer
 }
 
 // NewFrequencyVectorizer creates a new frequency vectorizer
@@ -69,6 +71,7 @@ func Calculate(text string, hyperplanes [][]float64) SimHash {
 type NGramVectorizer struct {
 	dimensions int
 	ngramSize  int
+	tokenizer  Tokenizer
 }
 
 // HammingDistance calculates the number of bit positions where two SimHashes differ
@@ -83,12 +86,19 @@ func (s SimHash) IsSimilar(other SimHash, threshold int) bool {
 
 // NewPermutationTable creates a new permutation table for LSH
 func NewPermutationTable(hashBits, bands int) *PermutationTable {
+	return NewPermutationTableWithSeed(hashBits, bands, DefaultSeed)
+}
+
+// NewPermutationTableWithSeed creates a permutation table whose permutations
+// are derived from seed, so the same seed always buckets hashes the same way
+func NewPermutationTableWithSeed(hashBits, bands int, seed int64) *PermutationTable {
 	if bands <= 0 || hashBits%bands != 0 {
 		panic("Number of bands must divide hash bits evenly")
 	}
 
 	bandSize := hashBits / bands
 	permutations := make([][]int, bands)
+	rng := rand.New(rand.NewSource(seed))
 	
 	// Create random permutations for each band
 	for i := 0; i < bands; i++ {
@@ -96,7 +106,7 @@ func NewPermutationTable(hashBits, bands int) *PermutationTable {
 		for j := 0; j < hashBits; j++ {
 			perm[j] = j
 		}
-		rand.Shuffle(len(perm), func(i, j int) {
+		rng.Shuffle(len(perm), func(i, j int) {
 			perm[i], perm[j] = perm[j], perm[i]
 		})
 		permutations[i] = perm
@@ -109,26 +119,42 @@ func NewPermutationTable(hashBits, bands int) *PermutationTable {
 	}
 }
 
+// Bands returns the number of LSH bands
+func (pt *PermutationTable) Bands() int {
+	return pt.bands
+}
+
 // GetBandSignatures returns LSH band signatures for a SimHash
 func (pt *PermutationTable) GetBandSignatures(hash SimHash) []uint64 {
+	return pt.BandSignatures(hash.Fingerprint())
+}
+
+// BandSignatures returns LSH band signatures for a fingerprint. The table
+// must have been created for the fingerprint's width.
+func (pt *PermutationTable) BandSignatures(fp Fingerprint) []uint64 {
 	signatures := make([]uint64, pt.bands)
-	
+
 	for i := 0; i < pt.bands; i++ {
 		var bandHash uint64
 		for j := 0; j < pt.bandSize; j++ {
-			bitPos := pt.permutations[i][j]
-			if (hash & (1 << bitPos)) != 0 {
+			if fp.Bit(pt.permutations[i][j]) {
 				bandHash |= 1 << j
 			}
 		}
 		signatures[i] = bandHash
 	}
-	
+
 	return signatures
 }
 
 // GenerateHyperplanes creates random unit vectors for SimHash
 func GenerateHyperplanes(dimensions, count int) [][]float64 {
+	return GenerateHyperplanesWithSeed(dimensions, count, DefaultSeed)
+}
+
+// GenerateHyperplanesWithSeed creates random unit vectors derived from seed.
+// The same dimensions, count and seed always give the same hyperplanes.
+func GenerateHyperplanesWithSeed(dimensions, count int, seed int64) [][]float64 {
 	// Create a deterministic source for reproducibility
 	hyperplanes := make([][]float64, count)
 	var wg sync.WaitGroup
@@ -140,8 +166,9 @@ func GenerateHyperplanes(dimensions, count int) [][]float64 {
 		go func(startIdx int) {
 			defer wg.Done()
 
-			// Create a unique seeded source for this goroutine
-			localSource := rand.NewSource(42 + int64(startIdx))
+			// Create a unique seeded source for this goroutine. Mixing seed
+			// and group keeps nearby seeds from sharing groups of planes.
+			localSource := rand.NewSource(int64(mix64(mix64(uint64(seed)) + uint64(startIdx))))
 			localRand := rand.New(localSource)
 
 			end := startIdx + chunkSize
@@ -184,28 +211,91 @@ func NewNGramVectorizer(dimensions, ngramSize int) *NGramVectorizer {
 	}
 }
 
-// TextToVector converts text to a normalized n-gram vector
-func (nv *NGramVectorizer) TextToVector(text string) []float64 {
-	if len(text) < nv.ngramSize {
-		// Handle edge case for very short texts
-		return NewFrequencyVectorizer(nv.dimensions).TextToVector(text)
+// SetTokenizer makes the vectorizer take n-grams over the tokens of text,
+// joined by spaces, instead of over the raw text
+func (nv *NGramVectorizer) SetTokenizer(t Tokenizer) {
+	nv.tokenizer = t
+}
+
+// tokenText returns the text n-grams are taken from
+func (nv *NGramVectorizer) tokenText(text string) string {
+	if nv.tokenizer == nil {
+		return text
 	}
+	return strings.Join(nv.tokenizer.Tokens(text), " ")
+}
 
-	ngramFreq := make(map[string]int)
+// ngrams adds the counts of the character n-grams of text to counts.
+// N-grams are taken over runes, so multi-byte characters are never cut in
+// half, and text mostly written in a script without spaces uses bigrams,
+// whose characters carry about as much as a short word. It returns false,
+// adding nothing, when text is shorter than one n-gram.
+func (nv *NGramVectorizer) ngrams(text string, counts *featureCounts) bool {
+	text = nv.tokenText(text)
+	size := nv.ngramSize
+	if size > 2 && NoSpaceScript(DetectScript(text)) {
+		size = 2
+	}
 
-	// Generate n-grams
-	for i := 0; i <= len(text)-nv.ngramSize; i++ {
-		ngram := text[i : i+nv.ngramSize]
-		ngramFreq[ngram]++
+	if !utf8.ValidString(text) {
+		// Invalid bytes become U+FFFD, one rune each
+		runes := []rune(text)
+		if len(runes) < size {
+			return false
+		}
+		for i := 0; i <= len(runes)-size; i++ {
+			counts.add(string(runes[i:i+size]), 1)
+		}
+		return true
+	}
+
+	// Valid text is cut into substrings, which cost no copies
+	if utf8.RuneCountInString(text) < size {
+		return false
+	}
+	start, end := 0, 0
+	for i := 0; i < size; i++ {
+		_, width := utf8.DecodeRuneInString(text[end:])
+		end += width
+	}
+	for {
+		counts.add(text[start:end], 1)
+		if end == len(text) {
+			return true
+		}
+		_, width := utf8.DecodeRuneInString(text[end:])
+		end += width
+		_, width = utf8.DecodeRuneInString(text[start:])
+		start += width
+	}
+}
+
+// countFeatures adds the n-gram counts of text to counts, or its word
+// counts when the text is shorter than one n-gram
+func (nv *NGramVectorizer) countFeatures(text string, counts *featureCounts) {
+	if !nv.ngrams(text, counts) {
+		counts.tokens = appendWords(counts.tokens[:0], nv.tokenText(text))
+		for _, word := range counts.tokens {
+			counts.add(word, 1)
+		}
+	}
+}
+
+// TextToVector converts text to a normalized n-gram vector
+func (nv *NGramVectorizer) TextToVector(text string) []float64 {
+	counts := newFeatureCounts()
+	if !nv.ngrams(text, counts) {
+		// Handle edge case for very short texts
+		return NewFrequencyVectorizer(nv.dimensions).TextToVector(nv.tokenText(text))
 	}
 
 	vector := make([]float64, nv.dimensions)
 
 	// Distribute frequencies to dimensions using hashing
-	for ngram, freq := range ngramFreq {
+	for ngram, freq := range counts.features {
 		hash := md5.Sum([]byte(ngram))
 		dim := int(binary.BigEndian.Uint32(hash[:4]) % uint32(nv.dimensions))
-		vector[dim] += float64(freq)
+		vector[dim] += freq
 	}
 
 	// Normalize vector
@@ -224,16 +314,13 @@ func (nv *NGramVectorizer) TextToVector(text string) []float64 {
 	return vector
 }
 
-func (fv *FrequencyVectorizer) TextToVector(text string) []float64 {
-	wordFreq := make(map[string]int)
+// SetTokenizer replaces the tokenizer that splits text into words
+func (fv *FrequencyVectorizer) SetTokenizer(t Tokenizer) {
+	fv.tokenizer = t
+}
 
-	// Count word frequencies
-	for _, word := range strings.Fields(text) {
-		word = strings.ToLower(strings.Trim(word, ".,!?:;\"'()[]{}"))
-		if word != "" {
-			wordFreq[word]++
-		}
-	}
+func (fv *FrequencyVectorizer) TextToVector(text string) []float64 {
+	wordFreq := tokenCounts(fv.tokenizer, text)
 
 	if len(wordFreq) == 0 {
 		return make([]float64, fv.dimensions)
@@ -263,3 +350,13 @@ func (fv *FrequencyVectorizer) TextToVector(text string) []float64 {
 
 	return vector
 }
+
+// wordCounts splits text into lower-cased words without surrounding
+// punctuation and counts them
+func wordCounts(text string) map[string]int {
+	wordFreq := make(map[string]int)
+	for _, word := range words(text) {
+		wordFreq[word]++
+	}
+	return wordFreq
+}
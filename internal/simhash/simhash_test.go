@@ -1,6 +1,11 @@
 package simhash
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -53,3 +58,152 @@ func TestGenerateHyperplanes(t *testing.T) {
 
 	}
 }
+
+func TestGenerateHyperplanesSeedsShareNoPlanes(t *testing.T) {
+	// Seeds a group apart once reproduced each other's later groups
+	planes := GenerateHyperplanesWithSeed(16, 64, 42)
+	for _, seed := range []int64{0, 38, 46, 50} {
+		other := GenerateHyperplanesWithSeed(16, 64, seed)
+		for i := range planes {
+			for j := range other {
+				if reflect.DeepEqual(planes[i], other[j]) {
+					t.Fatalf("seed %d plane %d equals seed 42 plane %d", seed, j, i)
+				}
+			}
+		}
+	}
+}
+
+func TestProjectorMatchesDenseProjection(t *testing.T) {
+	texts := []string{
+		"",
+		"hi",
+		"The quick brown fox jumps over the lazy dog. The dog sleeps.",
+		"東京都の天気は晴れです。明日も晴れるでしょう。",
+		"func max(a, b int) int { if a > b { return a }; return b }",
+		benchmarkCorpus(1, 4096)[0],
+	}
+	specs := []string{"frequency", "ngram", "ngram:n=5", "shingle", "tfidf", "code", "frequency:dims=64"}
+	english, _ := ParseLanguage("en")
+	normalizer, _ := ParseNormalizer(DefaultNormalizer)
+
+	for _, spec := range specs {
+		for _, width := range []int{64, 256} {
+			cfg, err := ParseVectorizerConfig(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vectorizer, err := cfg.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cv, ok := vectorizer.(CorpusVectorizer); ok {
+				for _, text := range texts {
+					cv.Observe(text)
+				}
+			}
+			hyperplanes := GenerateHyperplanes(cfg.Dimensions(), width)
+
+			variants := map[string]Vectorizer{"plain": vectorizer, "normalized": normalizer.Wrap(vectorizer)}
+			if _, ok := vectorizer.(TokenizingVectorizer); ok {
+				stemmed, _ := cfg.New()
+				if err := english.Apply(stemmed); err != nil {
+					t.Fatal(err)
+				}
+				if cv, ok := stemmed.(CorpusVectorizer); ok {
+					for _, text := range texts {
+						cv.Observe(text)
+					}
+				}
+				variants["english"] = stemmed
+			}
+
+			projector := NewProjector(width, hyperplanes)
+			for name, v := range variants {
+				for i, text := range texts {
+					want := CalculateFingerprint(Hyperplane, width, text, hyperplanes, v)
+					// Twice, so the second run uses cached hashes and reused scratch space
+					for run := 0; run < 2; run++ {
+						if got := projector.Fingerprint(text, v); got != want {
+							t.Errorf("%s %s %d bits, text %d: projector gave %s, dense projection %s", spec, name, width, i, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestProjectorConcurrent(t *testing.T) {
+	vectorizer := NewNGramVectorizer(VectorDimensions, 3)
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 128)
+	projector := NewProjector(128, hyperplanes)
+	chunks := benchmarkCorpus(64, 512)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, chunk := range chunks {
+				if got, want := projector.Fingerprint(chunk, vectorizer), CalculateFingerprint(Hyperplane, 128, chunk, hyperplanes, vectorizer); got != want {
+					t.Errorf("concurrent projection gave %s, want %s", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// benchmarkCorpus returns count chunks of about size bytes of random words
+// drawn from a Zipf-like vocabulary, as natural text is
+func benchmarkCorpus(count, size int) []string {
+	rng := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rng, 1.1, 1, 20000)
+	chunks := make([]string, count)
+	for i := range chunks {
+		var sb strings.Builder
+		for sb.Len() < size {
+			fmt.Fprintf(&sb, "w%d ", zipf.Uint64())
+		}
+		chunks[i] = sb.String()
+	}
+	return chunks
+}
+
+// BenchmarkProjection hashes 4 MiB in 4 KiB chunks, as indexing does, with
+// dense projection and with a Projector
+func BenchmarkProjection(b *testing.B) {
+	chunks := benchmarkCorpus(1024, 4096)
+	total := 0
+	for _, chunk := range chunks {
+		total += len(chunk)
+	}
+
+	for _, spec := range []string{"frequency", "ngram", "shingle"} {
+		cfg, _ := ParseVectorizerConfig(spec)
+		vectorizer, _ := cfg.New()
+		hyperplanes := GenerateHyperplanes(cfg.Dimensions(), NumHyperplanes)
+
+		b.Run(spec+"/dense", func(b *testing.B) {
+			b.SetBytes(int64(total))
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				for _, chunk := range chunks {
+					CalculateFingerprint(Hyperplane, NumHyperplanes, chunk, hyperplanes, vectorizer)
+				}
+			}
+		})
+		b.Run(spec+"/sparse", func(b *testing.B) {
+			projector := NewProjector(NumHyperplanes, hyperplanes)
+			b.SetBytes(int64(total))
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				for _, chunk := range chunks {
+					projector.Fingerprint(chunk, vectorizer)
+				}
+			}
+		})
+	}
+}
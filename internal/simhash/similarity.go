@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type DocumentSimilarity struct {
+	algorithm   Algorithm
+	bits        int
 	hyperplanes [][]float64
+	projector   *Projector // Nil for Charikar
 	vectorizer  Vectorizer
+	calibration Calibration
 }
 
 func NewDocumentSimilarity() *DocumentSimilarity {
@@ -18,58 +23,117 @@ func NewDocumentSimilarity() *DocumentSimilarity {
 	// Use NGramVectorizer for better accuracy with documents
 	vectorizer := NewNGramVectorizer(VectorDimensions, 3) // 3-gram vectorization
 
-	return &DocumentSimilarity{
+	return NewDocumentSimilarityWithAlgorithm(DefaultAlgorithm, DefaultFingerprintBits, hyperplanes, vectorizer)
+}
+
+// NewDocumentSimilarityFromConfig creates a detector using a registered
+// vectorizer, so comparisons match hashes stored in an index built with it
+func NewDocumentSimilarityFromConfig(cfg VectorizerConfig) (*DocumentSimilarity, error) {
+	vectorizer, err := cfg.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDocumentSimilarityWithVectorizer(GenerateHyperplanes(cfg.Dimensions(), NumHyperplanes), vectorizer), nil
+}
+
+// NewDocumentSimilarityWithVectorizer creates a detector from explicit
+// hyperplanes and vectorizer, such as the ones stored with an index
+func NewDocumentSimilarityWithVectorizer(hyperplanes [][]float64, vectorizer Vectorizer) *DocumentSimilarity {
+	return NewDocumentSimilarityWithAlgorithm(DefaultAlgorithm, DefaultFingerprintBits, hyperplanes, vectorizer)
+}
+
+// NewDocumentSimilarityWithAlgorithm creates a detector that computes
+// fingerprints of the given width with the given algorithm
+func NewDocumentSimilarityWithAlgorithm(algorithm Algorithm, width int, hyperplanes [][]float64, vectorizer Vectorizer) *DocumentSimilarity {
+	ds := &DocumentSimilarity{
+		algorithm:   algorithm,
+		bits:        width,
 		hyperplanes: hyperplanes,
 		vectorizer:  vectorizer,
+		calibration: AngleCalibration(),
 	}
+	if algorithm == Hyperplane {
+		ds.projector = NewProjector(width, hyperplanes)
+	}
+	return ds
 }
 
-func (ds *DocumentSimilarity) CompareDocuments(doc1, doc2 string) (similarity float64, details string) {
-	// Calculate SimHashes for both documents
-	hash1 := CalculateWithVectorizer(doc1, ds.hyperplanes, ds.vectorizer)
-	hash2 := CalculateWithVectorizer(doc2, ds.hyperplanes, ds.vectorizer)
+// WithHyperplanes returns a detector like ds, sharing its vectorizer and
+// calibration, that projects onto other hyperplanes
+func (ds *DocumentSimilarity) WithHyperplanes(hyperplanes [][]float64) *DocumentSimilarity {
+	other := NewDocumentSimilarityWithAlgorithm(ds.algorithm, ds.bits, hyperplanes, ds.vectorizer)
+	other.calibration = ds.calibration
+	return other
+}
 
-	// Calculate Hamming distance
-	distance := hash1.HammingDistance(hash2)
+// SetCalibration replaces the angle formula that maps Hamming distance to
+// similarity, typically with one fitted on labelled pairs
+func (ds *DocumentSimilarity) SetCalibration(c Calibration) {
+	ds.calibration = c
+}
 
-	// Convert distance to similarity percentage (0-100)
-	similarity = 100.0 * (64.0 - float64(distance)) / 64.0
+// Estimate returns the calibrated similarity of two documents
+func (ds *DocumentSimilarity) Estimate(doc1, doc2 string) Estimate {
+	return ds.calibration.EstimateFingerprints(ds.Fingerprint(doc1), ds.Fingerprint(doc2))
+}
 
-	// Generate detailed report
-	var assessment string
-	switch {
-	case similarity >= 90:
-		assessment = "Nearly identical"
-	case similarity >= 80:
-		assessment = "Very similar"
-	case similarity >= 70:
-		assessment = "Moderately similar"
-	case similarity >= 50:
-		assessment = "Somewhat similar"
-	default:
-		assessment = "Different"
+// CompareDocuments reports the calibrated similarity of two documents as a
+// percentage, with details
+func (ds *DocumentSimilarity) CompareDocuments(doc1, doc2 string) (similarity float64, details string) {
+	return ds.CompareFingerprints(ds.Fingerprint(doc1), ds.Fingerprint(doc2))
+}
+
+// CompareFingerprints reports the similarity of two documents from their
+// fingerprints, as the calibrated estimate in percent. The assessment names
+// the range the confidence interval spans, so a distance that fits both
+// "Very similar" and "Nearly identical" says so instead of picking one.
+func (ds *DocumentSimilarity) CompareFingerprints(hash1, hash2 Fingerprint) (similarity float64, details string) {
+	estimate := ds.calibration.EstimateFingerprints(hash1, hash2)
+	similarity = 100 * estimate.Similarity
+
+	assessment := assess(estimate.Low)
+	if high := assess(estimate.High); high != assessment {
+		assessment += " to " + strings.ToLower(high)
 	}
 
-	details = fmt.Sprintf("Similarity: %.2f%%\nHamming Distance: %d\nAssessment: %s\n",
-		similarity, distance, assessment)
+	details = fmt.Sprintf("%s: %s\nHamming Distance: %d\nAssessment: %s\n",
+		ds.calibration.Label(), estimate, estimate.Distance, assessment)
 
 	return similarity, details
 }
 
+// assess names the band a similarity between -1 and 1 falls in
+func assess(similarity float64) string {
+	switch {
+	case similarity >= 0.95:
+		return "Nearly identical"
+	case similarity >= 0.85:
+		return "Very similar"
+	case similarity >= 0.7:
+		return "Moderately similar"
+	case similarity >= 0.5:
+		return "Somewhat similar"
+	default:
+		return "Different"
+	}
+}
+
 func CompareFiles(file1, file2 string) error {
-	// Read files
-	content1, err := os.ReadFile(file1)
+	detector := NewDocumentSimilarity()
+
+	// Hash each file as it is read
+	hash1, err := detector.fingerprintFile(file1)
 	if err != nil {
-		return fmt.Errorf("error reading %s: %w", file1, err)
+		return err
 	}
 
-	content2, err := os.ReadFile(file2)
+	hash2, err := detector.fingerprintFile(file2)
 	if err != nil {
-		return fmt.Errorf("error reading %s: %w", file2, err)
+		return err
 	}
 
-	detector := NewDocumentSimilarity()
-	similarity, details := detector.CompareDocuments(string(content1), string(content2))
+	similarity, details := detector.CompareFingerprints(hash1, hash2)
 
 	fmt.Printf("\nComparison of %s and %s:\n%s",
 		filepath.Base(file1), filepath.Base(file2), details)
@@ -86,3 +150,44 @@ func CompareFiles(file1, file2 string) error {
 
 	return nil
 }
+
+// Err returns the error the detector's vectorizer has failed with, if any.
+// Fingerprints and comparisons made since are meaningless.
+func (ds *DocumentSimilarity) Err() error {
+	return VectorizerErr(ds.vectorizer)
+}
+
+// Close releases what the detector's vectorizer holds, such as the command
+// of an exec vectorizer
+func (ds *DocumentSimilarity) Close() error {
+	return CloseVectorizer(ds.vectorizer)
+}
+
+// fingerprintFile computes the fingerprint of a file as it is read
+func (ds *DocumentSimilarity) fingerprintFile(path string) (Fingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Fingerprint{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fp, err := ds.FingerprintReader(f)
+	if err != nil {
+		return Fingerprint{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return fp, nil
+}
+
+// Hash computes the 64-bit SimHash of a document with the detector's settings
+func (ds *DocumentSimilarity) Hash(doc string) SimHash {
+	return CalculateWithAlgorithm(ds.algorithm, doc, ds.hyperplanes, ds.vectorizer)
+}
+
+// Fingerprint computes the fingerprint of a document with the detector's
+// settings and width
+func (ds *DocumentSimilarity) Fingerprint(doc string) Fingerprint {
+	if ds.projector != nil {
+		return ds.projector.Fingerprint(doc, ds.vectorizer)
+	}
+	return CalculateFingerprint(ds.algorithm, ds.bits, doc, ds.hyperplanes, ds.vectorizer)
+}
@@ -28,61 +28,70 @@ func TestNewDocumentSimilarity(t *testing.T) {
 }
 
 func TestCompareDocuments(t *testing.T) {
+    // The values are those of the angle formula for the default hyperplanes,
+    // so they are pinned: a change to either shows up here
     tests := []struct {
         name           string
         doc1           string
         doc2           string
         minSimilarity float64
         maxSimilarity float64
+        wantInterval   string
         wantAssessment string
     }{
         {
-            name:           "identical documents",
+            name:           "identical documents are nearly identical",
             doc1:           "This is a test document",
             doc2:           "This is a test document",
-            minSimilarity: 95.0,
+            minSimilarity: 99.5,
             maxSimilarity: 100.0,
-            wantAssessment: "Nearly identical",
+            wantInterval:   "(95% CI 98.42% to 100.00%)",
+            wantAssessment: "Assessment: Nearly identical\n",
         },
         {
-            name:           "very similar documents",
+            name:           "one added character is very similar to nearly identical",
             doc1:           "This is a test document",
             doc2:           "This is a test document!",
-            minSimilarity: 90.0,
-            maxSimilarity: 100.0,
-            wantAssessment: "Nearly identical",
+            minSimilarity: 96.5,
+            maxSimilarity: 97.5,
+            wantInterval:   "(95% CI 86.04% to 99.44%)",
+            wantAssessment: "Assessment: Very similar to nearly identical\n",
         },
         {
-            name:           "moderately similar documents",
+            name:           "two changed words are different to somewhat similar",
             doc1:           "This is a test document",
             doc2:           "This is another test file",
-            minSimilarity: 60.0,
-            maxSimilarity: 90.0,
-            wantAssessment: "Moderately similar",
+            minSimilarity: 37.5,
+            maxSimilarity: 39.0,
+            wantInterval:   "(95% CI 0.79% to 66.91%)",
+            wantAssessment: "Assessment: Different to somewhat similar\n",
         },
         {
-            name:           "somewhat similar documents",
+            name:           "a shared opening is different",
             doc1:           "This is a test document",
             doc2:           "This is something completely different",
-            minSimilarity: 40.0,
-            maxSimilarity: 70.0,
-            wantAssessment: "Somewhat similar",
+            minSimilarity: -15.5,
+            maxSimilarity: -14.0,
+            wantInterval:   "(95% CI -48.92% to 23.12%)",
+            wantAssessment: "Assessment: Different\n",
         },
         {
-            name:           "different documents",
+            name:           "unrelated documents are different",
             doc1:           "This is a test document",
             doc2:           "Something entirely different here",
-            minSimilarity: 40.0,
-            maxSimilarity: 60.0,
-            wantAssessment: "Somewhat similar",
+            minSimilarity: -25.0,
+            maxSimilarity: -23.5,
+            wantInterval:   "(95% CI -56.55% to 13.75%)",
+            wantAssessment: "Assessment: Different\n",
         },
         {
-            name:           "empty documents",
+            name:           "empty documents are nearly identical",
             doc1:           "",
             doc2:           "",
-            minSimilarity: 95.0,
+            minSimilarity: 99.5,
             maxSimilarity: 100.0,
-            wantAssessment: "Nearly identical",
+            wantInterval:   "(95% CI 98.42% to 100.00%)",
+            wantAssessment: "Assessment: Nearly identical\n",
         },
     }
 
@@ -97,6 +106,9 @@ func TestCompareDocuments(t *testing.T) {
                     similarity, tt.minSimilarity, tt.maxSimilarity)
             }
             
+            if !strings.Contains(details, tt.wantInterval) {
+                t.Errorf("details = %q, want to contain %q", details, tt.wantInterval)
+            }
             if !strings.Contains(details, tt.wantAssessment) {
                 t.Errorf("details = %q, want to contain %q", details, tt.wantAssessment)
             }
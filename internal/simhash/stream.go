@@ -0,0 +1,534 @@
+package simhash
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// streamBufferSize is how much of a reader is read at a time
+const streamBufferSize = 64 * 1024
+
+// FeatureSink accumulates the weighted features of a text
+type FeatureSink interface {
+	AddFeature(feature string, weight float64)
+}
+
+// FeatureStream extracts the features of a text written to it in segments.
+// The text is cut before whitespace where the read buffer has any. Text
+// without whitespace for longer than the buffer, such as Chinese or a
+// minified file, is cut between two characters instead, so a segment that
+// does not start with whitespace continues the word the last one ended in.
+type FeatureStream interface {
+	Write(segment string)
+	// Close returns the sink holding the features of the whole text
+	Close() FeatureSink
+}
+
+// StreamingVectorizer is implemented by vectorizers that can extract the
+// features of a text as it is read, so it never has to be held in memory.
+// Streamed features are exactly the ones Features returns for the whole
+// text, as long as the tokenizer splits each word on its own, which the
+// language tokenizers do.
+type StreamingVectorizer interface {
+	Vectorizer
+	FeatureExtractor
+	// Dimensions returns the length of the vectors TextToVector returns
+	Dimensions() int
+	// NewStream starts a text whose features are added to sinks made by
+	// newSink. A stream may make more than one when it can only tell at
+	// the end which features the text has.
+	NewStream(newSink func() FeatureSink) FeatureStream
+}
+
+// CalculateReader computes the fingerprint of the text read from r. With a
+// StreamingVectorizer the text is hashed as it is read, in constant memory
+// for the hashed vector and for Charikar sums; other vectorizers get the
+// whole text at once. Either way the fingerprint is the one
+// CalculateFingerprint computes for the same text.
+func CalculateReader(r io.Reader, algorithm Algorithm, width int, hyperplanes [][]float64, vectorizer Vectorizer) (Fingerprint, error) {
+	var newSink func() FeatureSink
+	if algorithm == Charikar {
+		newSink = func() FeatureSink { return newCharikarSums(width) }
+	} else if dims, ok := streamDimensions(vectorizer); ok {
+		newSink = func() FeatureSink { return newHashedVector(dims) }
+	}
+
+	stream, ok := newFeatureStream(vectorizer, newSink)
+	if !ok || newSink == nil {
+		text, err := io.ReadAll(r)
+		if err != nil {
+			return Fingerprint{}, err
+		}
+		fp := CalculateFingerprint(algorithm, width, string(text), hyperplanes, vectorizer)
+		if err := VectorizerErr(vectorizer); err != nil {
+			return Fingerprint{}, err
+		}
+		return fp, nil
+	}
+
+	if err := readSegments(r, stream.Write); err != nil {
+		return Fingerprint{}, err
+	}
+	sink := stream.Close()
+	if algorithm == Charikar {
+		return sink.(charikarSums).fingerprint(), nil
+	}
+	return projectFingerprint(sink.(hashedVector).normalized(), width, hyperplanes), nil
+}
+
+// FingerprintReader computes the fingerprint of the text read from r with
+// the detector's settings and width
+func (ds *DocumentSimilarity) FingerprintReader(r io.Reader) (Fingerprint, error) {
+	return CalculateReader(r, ds.algorithm, ds.bits, ds.hyperplanes, ds.vectorizer)
+}
+
+// readSegments reads r to the end and hands its text to write in segments
+// cut before whitespace, or between two characters when the buffer fills up
+// without any. Only a stretch of combining marks longer than the buffer
+// grows it.
+func readSegments(r io.Reader, write func(segment string)) error {
+	buf := make([]byte, streamBufferSize)
+	n := 0
+	for {
+		// What is left after a cut has no whitespace but at its start, so
+		// only new bytes, and a rune they may complete, need a look
+		from := max(1, n-utf8.UTFMax+1)
+		read, err := r.Read(buf[n:])
+		n += read
+
+		if err == io.EOF {
+			if n > 0 {
+				write(string(buf[:n]))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cut := -1
+		if i := bytes.LastIndexFunc(buf[from:n], unicode.IsSpace); i >= 0 {
+			cut = from + i
+		} else if n == len(buf) {
+			cut = lastRuneBoundary(buf)
+		}
+		if cut > 0 {
+			write(string(buf[:cut]))
+			n = copy(buf, buf[cut:n])
+		} else if n == len(buf) {
+			buf = append(buf, make([]byte, len(buf))...)
+		}
+	}
+}
+
+// lastRuneBoundary returns the start of the last complete rune in buf that
+// normalization never joins to the rune before it, or -1. Cutting there
+// leaves each segment to normalize alike on its own.
+func lastRuneBoundary(buf []byte) int {
+	for end := len(buf); end > 0; {
+		_, size := utf8.DecodeLastRune(buf[:end])
+		end -= size
+		if end > 0 && utf8.FullRune(buf[end:]) && norm.NFKC.Properties(buf[end:]).BoundaryBefore() &&
+			norm.NFD.Properties(buf[end:]).BoundaryBefore() {
+			return end
+		}
+	}
+	return -1
+}
+
+// streamDimensions returns the vector length of a streaming vectorizer,
+// possibly wrapped in a normalizer
+func streamDimensions(v Vectorizer) (int, bool) {
+	switch v := v.(type) {
+	case StreamingVectorizer:
+		return v.Dimensions(), true
+	case *normalizedVectorizer:
+		return streamDimensions(v.vectorizer)
+	case *normalizedCorpusVectorizer:
+		return streamDimensions(v.vectorizer)
+	}
+	return 0, false
+}
+
+// newFeatureStream starts a text for a streaming vectorizer, normalizing
+// each segment in front of it when it is wrapped in a normalizer
+func newFeatureStream(v Vectorizer, newSink func() FeatureSink) (FeatureStream, bool) {
+	var nv *normalizedVectorizer
+	switch v := v.(type) {
+	case StreamingVectorizer:
+		return v.NewStream(newSink), true
+	case *normalizedVectorizer:
+		nv = v
+	case *normalizedCorpusVectorizer:
+		nv = &v.normalizedVectorizer
+	default:
+		return nil, false
+	}
+	inner, ok := newFeatureStream(nv.vectorizer, newSink)
+	if !ok {
+		return nil, false
+	}
+	return &normalizedStream{normalizer: nv.normalizer, stream: inner}, true
+}
+
+// normalizedStream normalizes each segment in front of another stream
+type normalizedStream struct {
+	normalizer Normalizer
+	stream     FeatureStream
+	started    bool
+	spaced     bool // The last segment ended in whitespace
+}
+
+// Write normalizes a segment. Collapsing whitespace trims every segment, so
+// the single space that joins them in the whole text is put back, unless the
+// segment continues a word.
+func (ns *normalizedStream) Write(segment string) {
+	first, _ := utf8.DecodeRuneInString(segment)
+	last, _ := utf8.DecodeLastRuneInString(segment)
+	continued := segment != "" && !unicode.IsSpace(first) && !ns.spaced
+	if segment != "" {
+		ns.spaced = unicode.IsSpace(last)
+	}
+	segment = ns.normalizer.Normalize(segment)
+	if ns.normalizer.Whitespace {
+		if segment == "" {
+			return
+		}
+		if ns.started && !continued {
+			segment = " " + segment
+		}
+	}
+	ns.started = true
+	ns.stream.Write(segment)
+}
+
+// Close returns the features of the normalized text
+func (ns *normalizedStream) Close() FeatureSink {
+	return ns.stream.Close()
+}
+
+// hashedVector folds features into vector dimensions by their MD5 hash, as
+// every built-in vectorizer does
+type hashedVector []float64
+
+func newHashedVector(dims int) hashedVector {
+	return make(hashedVector, dims)
+}
+
+// AddFeature adds weight to the feature's dimension
+func (v hashedVector) AddFeature(feature string, weight float64) {
+	hash := md5.Sum([]byte(feature))
+	v[binary.BigEndian.Uint32(hash[:4])%uint32(len(v))] += weight
+}
+
+// normalized returns the vector scaled to unit length
+func (v hashedVector) normalized() []float64 {
+	magnitude := 0.0
+	for _, x := range v {
+		magnitude += x * x
+	}
+	magnitude = math.Sqrt(magnitude)
+
+	if magnitude > 0 {
+		for i := range v {
+			v[i] /= magnitude
+		}
+	}
+	return v
+}
+
+// segmentTokens returns the tokens of a segment, using plain words when t is
+// nil
+func segmentTokens(t Tokenizer, segment string) []string {
+	return appendTokens(nil, t, segment)
+}
+
+// appendTokens appends the tokens of text to tokens, using plain words when
+// t is nil
+func appendTokens(tokens []string, t Tokenizer, text string) []string {
+	if t == nil {
+		return appendWords(tokens, text)
+	}
+	return append(tokens, t.Tokens(text)...)
+}
+
+// wordJoiner tokenizes segments that may be cut inside a word. The word a
+// segment ends in is held until whitespace completes it, except in runs of
+// scripts written without spaces: those become bigrams, so a run is
+// tokenized up to the cut and only its last letter, the first of the next
+// bigram, is held.
+type wordJoiner struct {
+	tokenizer Tokenizer
+	partial   []byte
+}
+
+// tokens returns the tokens of the words that segment completes
+func (wj *wordJoiner) tokens(segment string) []string {
+	cut, keep := -1, 0
+	if i := strings.LastIndexFunc(segment, unicode.IsSpace); i >= 0 {
+		cut, keep = i, i
+	} else {
+		cut, keep = noSpaceCut(segment)
+	}
+	if cut < 0 {
+		wj.partial = append(wj.partial, segment...)
+		return nil
+	}
+
+	text := string(append(wj.partial, segment[:cut]...))
+	wj.partial = append(wj.partial[:0], segment[keep:]...)
+	return segmentTokens(wj.tokenizer, text)
+}
+
+// flush returns the tokens of the word held at the end of the text
+func (wj *wordJoiner) flush() []string {
+	text := string(wj.partial)
+	wj.partial = nil
+	return segmentTokens(wj.tokenizer, text)
+}
+
+// noSpaceCut finds the last three letters in a row of scripts written
+// without spaces in s and returns where the third starts, the end of the
+// run tokenized now, and where the second starts, which is held. With two
+// letters before the cut, the run before it is not mistaken for a single
+// letter, and the held one joins the next. It returns -1 without such a
+// run.
+func noSpaceCut(s string) (cut, keep int) {
+	run, next, last := 0, -1, -1
+	for end := len(s); end > 0; {
+		r, size := utf8.DecodeLastRuneInString(s[:end])
+		end -= size
+		if !isNoSpaceScript(r) {
+			run = 0
+			continue
+		}
+		run++
+		if run == 3 {
+			return last, next
+		}
+		last, next = next, end
+	}
+	return -1, 0
+}
+
+// Dimensions returns the number of vector dimensions
+func (fv *FrequencyVectorizer) Dimensions() int {
+	return fv.dimensions
+}
+
+// NewStream starts a text whose words are counted as they are written
+func (fv *FrequencyVectorizer) NewStream(newSink func() FeatureSink) FeatureStream {
+	return &tokenStream{words: wordJoiner{tokenizer: fv.tokenizer}, sink: newSink()}
+}
+
+// tokenStream adds one for every token
+type tokenStream struct {
+	words wordJoiner
+	sink  FeatureSink
+}
+
+func (ts *tokenStream) Write(segment string) {
+	ts.add(ts.words.tokens(segment))
+}
+
+func (ts *tokenStream) add(tokens []string) {
+	for _, token := range tokens {
+		ts.sink.AddFeature(token, 1)
+	}
+}
+
+func (ts *tokenStream) Close() FeatureSink {
+	ts.add(ts.words.flush())
+	return ts.sink
+}
+
+// Dimensions returns the number of vector dimensions
+func (tv *TFIDFVectorizer) Dimensions() int {
+	return tv.dimensions
+}
+
+// NewStream starts a text. TF-IDF weights are added once per distinct word
+// at the end, in the order TextToVector adds them, so the stream holds the
+// counts of the text's vocabulary.
+func (tv *TFIDFVectorizer) NewStream(newSink func() FeatureSink) FeatureStream {
+	return &tfidfStream{vectorizer: tv, words: wordJoiner{tokenizer: tv.tokenizer}, counts: make(map[string]int), sink: newSink()}
+}
+
+type tfidfStream struct {
+	vectorizer *TFIDFVectorizer
+	words      wordJoiner
+	counts     map[string]int
+	sink       FeatureSink
+}
+
+func (ts *tfidfStream) Write(segment string) {
+	ts.add(ts.words.tokens(segment))
+}
+
+func (ts *tfidfStream) add(tokens []string) {
+	for _, token := range tokens {
+		ts.counts[token]++
+	}
+}
+
+func (ts *tfidfStream) Close() FeatureSink {
+	ts.add(ts.words.flush())
+	for _, word := range sortedKeys(ts.counts) {
+		ts.sink.AddFeature(word, float64(ts.counts[word])*ts.vectorizer.IDF(word))
+	}
+	return ts.sink
+}
+
+// Dimensions returns the number of vector dimensions
+func (sv *ShingleVectorizer) Dimensions() int {
+	return sv.dimensions
+}
+
+// NewStream starts a text whose shingles are counted as they are written
+func (sv *ShingleVectorizer) NewStream(newSink func() FeatureSink) FeatureStream {
+	return &shingleStream{vectorizer: sv, words: wordJoiner{tokenizer: sv.tokenizer}, sink: newSink()}
+}
+
+// shingleStream keeps the last words of the text, which the next shingle
+// starts with, and the first ones in case the text is a single short shingle
+type shingleStream struct {
+	vectorizer *ShingleVectorizer
+	words      wordJoiner
+	window     []string
+	first      []string
+	tokens     int
+	sink       FeatureSink
+}
+
+func (ss *shingleStream) Write(segment string) {
+	ss.add(ss.words.tokens(segment))
+}
+
+func (ss *shingleStream) add(tokens []string) {
+	size := ss.vectorizer.size
+	for _, token := range tokens {
+		if ss.tokens < size {
+			ss.first = append(ss.first, token)
+		}
+		ss.tokens++
+		ss.window = append(ss.window, token)
+		if len(ss.window) == size {
+			ss.sink.AddFeature(strings.Join(ss.window, " "), 1)
+			ss.window = append(ss.window[:0], ss.window[1:]...)
+		}
+	}
+}
+
+func (ss *shingleStream) Close() FeatureSink {
+	ss.add(ss.words.flush())
+	if ss.tokens > 0 && ss.tokens < ss.vectorizer.size {
+		ss.sink.AddFeature(strings.Join(ss.first, " "), 1)
+	}
+	return ss.sink
+}
+
+// Dimensions returns the number of vector dimensions
+func (nv *NGramVectorizer) Dimensions() int {
+	return nv.dimensions
+}
+
+// NewStream starts a text whose n-grams are counted as they are written.
+// Whether the text is mostly in a script without spaces, and so counted in
+// bigrams, is only known at the end, so those are counted alongside.
+func (nv *NGramVectorizer) NewStream(newSink func() FeatureSink) FeatureStream {
+	ns := &ngramStream{vectorizer: nv, words: wordJoiner{tokenizer: nv.tokenizer}, scripts: make(map[string]int), sink: newSink(), newSink: newSink}
+	if nv.ngramSize > 2 {
+		ns.bigrams = newSink()
+	}
+	return ns
+}
+
+// ngramStream keeps the runes the next n-gram starts with and, in case the
+// text is shorter than one n-gram, the first ones
+type ngramStream struct {
+	vectorizer *NGramVectorizer
+	words      wordJoiner // Used with a tokenizer
+	scripts    map[string]int
+	tail       []rune
+	first      []rune
+	runes      int
+	started    bool
+	sink       FeatureSink
+	bigrams    FeatureSink
+	newSink    func() FeatureSink
+}
+
+func (ns *ngramStream) Write(segment string) {
+	if ns.vectorizer.tokenizer != nil {
+		ns.addTokens(ns.words.tokens(segment))
+		return
+	}
+	ns.add(segment)
+}
+
+// addTokens adds the n-grams of tokens, which the whole text joins by single
+// spaces
+func (ns *ngramStream) addTokens(tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	segment := strings.Join(tokens, " ")
+	if ns.started {
+		segment = " " + segment
+	}
+	ns.add(segment)
+}
+
+// add adds the n-grams of text that follows what was added before
+func (ns *ngramStream) add(segment string) {
+	ns.started = true
+	countScripts(ns.scripts, segment)
+
+	size := ns.vectorizer.ngramSize
+	runes := append(append([]rune(nil), ns.tail...), []rune(segment)...)
+	if ns.runes < size {
+		ns.first = append(ns.first, runes[len(ns.tail):min(len(runes), len(ns.tail)+size-ns.runes)]...)
+	}
+	ns.runes += len(runes) - len(ns.tail)
+
+	addNGrams(ns.sink, runes, size)
+	if ns.bigrams != nil {
+		addNGrams(ns.bigrams, runes[max(0, len(ns.tail)-1):], 2)
+	}
+	ns.tail = append(ns.tail[:0], runes[max(0, len(runes)-size+1):]...)
+}
+
+// addNGrams adds one for every n-gram of runes
+func addNGrams(sink FeatureSink, runes []rune, size int) {
+	for i := 0; i+size <= len(runes); i++ {
+		sink.AddFeature(string(runes[i:i+size]), 1)
+	}
+}
+
+func (ns *ngramStream) Close() FeatureSink {
+	if ns.vectorizer.tokenizer != nil {
+		ns.addTokens(ns.words.flush())
+	}
+	size, sink := ns.vectorizer.ngramSize, ns.sink
+	if ns.bigrams != nil && NoSpaceScript(dominantScript(ns.scripts)) {
+		size, sink = 2, ns.bigrams
+	}
+	if ns.runes >= size {
+		return sink
+	}
+
+	// Text shorter than one n-gram counts its words, as TextToVector does
+	words := ns.newSink()
+	for word, freq := range wordCounts(string(ns.first)) {
+		words.AddFeature(word, float64(freq))
+	}
+	return words
+}
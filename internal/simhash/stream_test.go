@@ -0,0 +1,170 @@
+package simhash
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestCalculateReaderMatchesInMemory(t *testing.T) {
+	texts := map[string]string{
+		"empty":   "",
+		"short":   "ab",
+		"words":   "The quick brown fox jumps over the lazy dog.\n\nThe dog sleeps;  the fox runs!",
+		"cjk":     "今日は良い天気です。 明日も晴れるでしょう。 東京は 暑い",
+		"mixed":   "Ｆｕｌｌ　ｗｉｄｔｈ “quoted” café café soft­hyphen \t tabs and　spaces ",
+		"oneword": "supercalifragilisticexpialidocious",
+	}
+	// Longer than one read buffer
+	texts["long"] = strings.Repeat(texts["words"]+" ", 1000)
+	// Longer than one read buffer without whitespace, so cut inside words
+	texts["long-cjk"] = strings.Repeat("今日は良い天気です。明日も晴れるでしょう。東京は暑い", 1000)
+	texts["long-thai"] = strings.Repeat("ภาษาไทยเขียนติดกันโดยไม่เว้นวรรค", 800)
+	texts["long-minified"] = strings.Repeat("function(a,b){return a.concat(b)};", 2000)
+
+	tfidf := NewTFIDFVectorizer(64)
+	tfidf.Observe(texts["words"])
+	tfidf.Observe("the lazy afternoon")
+
+	all, _ := ParseNormalizer("nfkc,fold,diacritics,punct,space")
+	noSpace, _ := ParseNormalizer("nfkc,fold,diacritics,punct")
+	english := func(v Vectorizer) Vectorizer {
+		if err := English.Apply(v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	vectorizers := map[string]Vectorizer{
+		"frequency":          NewFrequencyVectorizer(VectorDimensions),
+		"ngram":              NewNGramVectorizer(VectorDimensions, 3),
+		"ngram-1":            NewNGramVectorizer(VectorDimensions, 1),
+		"ngram-5":            NewNGramVectorizer(96, 5),
+		"ngram-english":      english(NewNGramVectorizer(VectorDimensions, 4)),
+		"shingle":            NewShingleVectorizer(256, 3),
+		"shingle-english":    english(NewShingleVectorizer(256, 2)),
+		"tfidf":              tfidf,
+		"normalized-ngram":   all.Wrap(NewNGramVectorizer(VectorDimensions, 3)),
+		"normalized-nospace": noSpace.Wrap(NewNGramVectorizer(VectorDimensions, 3)),
+		"normalized-tfidf":   all.Wrap(tfidf),
+	}
+
+	readers := map[string]func(string) io.Reader{
+		"whole":    func(s string) io.Reader { return strings.NewReader(s) },
+		"one byte": func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"half":     func(s string) io.Reader { return iotest.HalfReader(strings.NewReader(s)) },
+	}
+
+	for vname, vectorizer := range vectorizers {
+		for _, algorithm := range []Algorithm{Hyperplane, Charikar} {
+			for _, width := range []int{64, 128} {
+				dims, _ := streamDimensions(vectorizer)
+				hyperplanes := GenerateHyperplanes(dims, width)
+				for tname, text := range texts {
+					spaceless := strings.HasPrefix(tname, "long-")
+					if spaceless && width != 64 {
+						continue
+					}
+					want := CalculateFingerprint(algorithm, width, text, hyperplanes, vectorizer)
+					for rname, reader := range readers {
+						if tname == "long" && rname != "whole" || spaceless && rname == "one byte" {
+							continue
+						}
+						got, err := CalculateReader(reader(text), algorithm, width, hyperplanes, vectorizer)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if got != want {
+							t.Errorf("%s/%s/%d, %s text read %s: %s, want %s", vname, algorithm, width, tname, rname, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// featureTally is a sink that records every feature
+type featureTally map[string]float64
+
+func (f featureTally) AddFeature(feature string, weight float64) {
+	f[feature] += weight
+}
+
+func TestFeatureStreamCutInsideWords(t *testing.T) {
+	// Without whitespace in a full buffer, text is cut between any two
+	// characters normalization keeps apart
+	texts := []string{
+		"今日は良い天気です。明日も晴れる",
+		"ภาษาไทยเขียนติดกัน",
+		"minified(a,b){return a}",
+		"東京tower大阪 The Cats, 東",
+	}
+	all, _ := ParseNormalizer("nfkc,fold,diacritics,punct,space")
+	vectorizers := map[string]Vectorizer{
+		"frequency":            NewFrequencyVectorizer(VectorDimensions),
+		"ngram":                NewNGramVectorizer(VectorDimensions, 3),
+		"shingle":              NewShingleVectorizer(256, 2),
+		"normalized-frequency": all.Wrap(NewFrequencyVectorizer(VectorDimensions)),
+		"normalized-ngram":     all.Wrap(NewNGramVectorizer(VectorDimensions, 3)),
+	}
+	for _, name := range []string{"ngram-english", "shingle-english"} {
+		v := NewNGramVectorizer(VectorDimensions, 4)
+		var tv Vectorizer = v
+		if name == "shingle-english" {
+			tv = NewShingleVectorizer(256, 2)
+		}
+		if err := English.Apply(tv); err != nil {
+			t.Fatal(err)
+		}
+		vectorizers[name] = tv
+	}
+
+	for vname, vectorizer := range vectorizers {
+		for _, text := range texts {
+			want := vectorizer.(FeatureExtractor).Features(text)
+			for cut := 1; cut < len(text); cut++ {
+				if !utf8.RuneStart(text[cut]) || !norm.NFKC.Properties([]byte(text[cut:])).BoundaryBefore() {
+					continue
+				}
+				stream, _ := newFeatureStream(vectorizer, func() FeatureSink { return featureTally{} })
+				stream.Write(text[:cut])
+				stream.Write(text[cut:])
+				got := stream.Close().(featureTally)
+
+				if len(got) != len(want) {
+					t.Errorf("%s, %q cut at %d: %d features, want %d", vname, text, cut, len(got), len(want))
+					continue
+				}
+				for feature, weight := range want {
+					if got[feature] != weight {
+						t.Errorf("%s, %q cut at %d: %q weighs %v, want %v", vname, text, cut, feature, got[feature], weight)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCalculateReaderFallsBack(t *testing.T) {
+	// A vectorizer that cannot stream gets the whole text
+	vectorizer := vectorOnly{NewFrequencyVectorizer(VectorDimensions)}
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 64)
+	text := "plain words read in one piece"
+
+	for _, algorithm := range []Algorithm{Hyperplane, Charikar} {
+		want := CalculateFingerprint(algorithm, 64, text, hyperplanes, vectorizer)
+		got, err := CalculateReader(iotest.OneByteReader(strings.NewReader(text)), algorithm, 64, hyperplanes, vectorizer)
+		if err != nil || got != want {
+			t.Errorf("%s: got %s, %v, want %s", algorithm, got, err, want)
+		}
+	}
+
+	if _, err := CalculateReader(iotest.ErrReader(io.ErrUnexpectedEOF), Hyperplane, 64, hyperplanes, NewFrequencyVectorizer(VectorDimensions)); err != io.ErrUnexpectedEOF {
+		t.Errorf("read error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
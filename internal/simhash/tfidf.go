@@ -0,0 +1,131 @@
+package simhash
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/gob"
+	"math"
+)
+
+// CorpusVectorizer is a vectorizer whose weights are learned from the
+// documents being indexed. Indexing observes every chunk before hashing any
+// of them, and the learned state is stored with the index so queries weight
+// text exactly as the indexed chunks were weighted.
+type CorpusVectorizer interface {
+	Vectorizer
+	Observe(text string)
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+// TFIDFVectorizer weights words by term frequency times inverse document
+// frequency, so words that appear in most chunks barely move the fingerprint
+type TFIDFVectorizer struct {
+	dimensions int
+	documents  int
+	docFreq    map[string]int
+	tokenizer  Tokenizer
+}
+
+// tfidfState is the persisted form of the learned document frequencies
+type tfidfState struct {
+	Documents int
+	DocFreq   map[string]int
+}
+
+func init() {
+	RegisterVectorizer("tfidf", map[string]string{"dims": "128"},
+		func(p VectorizerParams) (Vectorizer, error) {
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			return NewTFIDFVectorizer(dims), nil
+		})
+}
+
+// NewTFIDFVectorizer creates a TF-IDF vectorizer with no corpus statistics.
+// Until documents are observed every word has the same weight.
+func NewTFIDFVectorizer(dimensions int) *TFIDFVectorizer {
+	return &TFIDFVectorizer{
+		dimensions: dimensions,
+		docFreq:    make(map[string]int),
+	}
+}
+
+// Observe counts the distinct words of one document. It must not be called
+// concurrently with TextToVector.
+func (tv *TFIDFVectorizer) Observe(text string) {
+	tv.documents++
+	for word := range tokenCounts(tv.tokenizer, text) {
+		tv.docFreq[word]++
+	}
+}
+
+// SetTokenizer replaces the tokenizer that splits text into words. Corpus
+// statistics must be learned with the same tokenizer that hashes queries.
+func (tv *TFIDFVectorizer) SetTokenizer(t Tokenizer) {
+	tv.tokenizer = t
+}
+
+// Documents returns the number of observed documents
+func (tv *TFIDFVectorizer) Documents() int {
+	return tv.documents
+}
+
+// IDF returns the smoothed inverse document frequency of a word. Words never
+// seen during indexing get the highest weight.
+func (tv *TFIDFVectorizer) IDF(word string) float64 {
+	return math.Log(float64(1+tv.documents)/float64(1+tv.docFreq[word])) + 1
+}
+
+// TextToVector converts text to a normalized TF-IDF weighted vector
+func (tv *TFIDFVectorizer) TextToVector(text string) []float64 {
+	vector := make([]float64, tv.dimensions)
+
+	// Weights are added in word order so rounding never depends on map order
+	counts := tokenCounts(tv.tokenizer, text)
+	for _, word := range sortedKeys(counts) {
+		freq := counts[word]
+		hash := md5.Sum([]byte(word))
+		dim := int(binary.BigEndian.Uint32(hash[:4]) % uint32(tv.dimensions))
+		vector[dim] += float64(freq) * tv.IDF(word)
+	}
+
+	// Normalize vector
+	magnitude := 0.0
+	for _, v := range vector {
+		magnitude += v * v
+	}
+	magnitude = math.Sqrt(magnitude)
+
+	if magnitude > 0 {
+		for i := range vector {
+			vector[i] /= magnitude
+		}
+	}
+
+	return vector
+}
+
+// MarshalBinary encodes the learned document frequencies
+func (tv *TFIDFVectorizer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(tfidfState{Documents: tv.documents, DocFreq: tv.docFreq})
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary restores document frequencies written by MarshalBinary
+func (tv *TFIDFVectorizer) UnmarshalBinary(data []byte) error {
+	var state tfidfState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+	tv.documents = state.Documents
+	tv.docFreq = state.DocFreq
+	if tv.docFreq == nil {
+		tv.docFreq = make(map[string]int)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package simhash
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTFIDFVectorizerIDF(t *testing.T) {
+	tv := NewTFIDFVectorizer(VectorDimensions)
+	tv.Observe("the cat sat")
+	tv.Observe("the dog ran")
+	tv.Observe("the bird flew")
+
+	if tv.Documents() != 3 {
+		t.Errorf("Documents() = %d, want 3", tv.Documents())
+	}
+	if common, rare := tv.IDF("the"), tv.IDF("cat"); common >= rare {
+		t.Errorf("IDF(the) = %f should be below IDF(cat) = %f", common, rare)
+	}
+	if rare, unseen := tv.IDF("cat"), tv.IDF("zebra"); rare >= unseen {
+		t.Errorf("IDF(cat) = %f should be below IDF(zebra) = %f", rare, unseen)
+	}
+}
+
+func TestTFIDFVectorizerDownweightsBoilerplate(t *testing.T) {
+	boilerplate := "copyright notice all rights reserved terms apply "
+	doc1 := boilerplate + "quantum entanglement experiment"
+	doc2 := boilerplate + "medieval castle architecture"
+
+	tv := NewTFIDFVectorizer(VectorDimensions)
+	for i := 0; i < 20; i++ {
+		tv.Observe(boilerplate + "filler")
+	}
+	tv.Observe(doc1)
+	tv.Observe(doc2)
+
+	fv := NewFrequencyVectorizer(VectorDimensions)
+	plain := cosine(fv.TextToVector(doc1), fv.TextToVector(doc2))
+	weighted := cosine(tv.TextToVector(doc1), tv.TextToVector(doc2))
+	if weighted >= plain {
+		t.Errorf("TF-IDF similarity %f should be below plain similarity %f", weighted, plain)
+	}
+}
+
+func TestTFIDFVectorizerMarshal(t *testing.T) {
+	tv := NewTFIDFVectorizer(VectorDimensions)
+	tv.Observe("alpha beta")
+	tv.Observe("alpha gamma")
+
+	data, err := tv.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	restored := NewTFIDFVectorizer(VectorDimensions)
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	want := tv.TextToVector("alpha beta delta")
+	got := restored.TextToVector("alpha beta delta")
+	for i := range want {
+		if math.Abs(want[i]-got[i]) > 1e-12 {
+			t.Fatalf("restored vector differs at %d: %f != %f", i, got[i], want[i])
+		}
+	}
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,186 @@
+package simhash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into the words that word-based vectorizers count
+type Tokenizer interface {
+	Tokens(text string) []string
+}
+
+// TokenizingVectorizer is implemented by vectorizers whose tokenizer can be
+// replaced. A nil tokenizer restores plain lower-cased words.
+type TokenizingVectorizer interface {
+	SetTokenizer(t Tokenizer)
+}
+
+// Language selects the stopwords and stemmer used to tokenize text
+type Language string
+
+// NoLanguage tokenizes into plain words, without stopwords or stemming. It
+// is assumed for indexes built before the language was recorded.
+const NoLanguage Language = "none"
+
+type languageEntry struct {
+	stopwords map[string]struct{}
+	stem      func(word string) string
+}
+
+var (
+	languagesMu sync.RWMutex
+	languages   = make(map[Language]languageEntry)
+)
+
+// RegisterLanguage makes a language available by name. Stopwords are
+// dropped before stemming; stem may be nil for languages without a stemmer.
+func RegisterLanguage(name string, stopwords []string, stem func(word string) string) {
+	entry := languageEntry{stopwords: make(map[string]struct{}, len(stopwords)), stem: stem}
+	for _, word := range stopwords {
+		entry.stopwords[word] = struct{}{}
+	}
+
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	languages[Language(name)] = entry
+}
+
+// LanguageNames returns the names of the registered languages
+func LanguageNames() []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	names := make([]string, 0, len(languages)+1)
+	names = append(names, string(NoLanguage))
+	for name := range languages {
+		names = append(names, string(name))
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// ParseLanguage parses a language name; the empty string selects NoLanguage
+func ParseLanguage(name string) (Language, error) {
+	if name == "" || Language(name) == NoLanguage {
+		return NoLanguage, nil
+	}
+
+	languagesMu.RLock()
+	_, ok := languages[Language(name)]
+	languagesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown language %q (available: %s)", name, strings.Join(LanguageNames(), ", "))
+	}
+	return Language(name), nil
+}
+
+// Tokenizer returns the tokenizer of the language, or nil for NoLanguage
+func (l Language) Tokenizer() Tokenizer {
+	languagesMu.RLock()
+	entry, ok := languages[l]
+	languagesMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return &languageTokenizer{entry: entry}
+}
+
+// Apply makes v tokenize text in the language. Vectorizers that do not work
+// on words only accept NoLanguage.
+func (l Language) Apply(v Vectorizer) error {
+	if l == NoLanguage || l == "" {
+		return nil
+	}
+	tv, ok := v.(TokenizingVectorizer)
+	if !ok {
+		return fmt.Errorf("vectorizer %T does not support language %s", v, l)
+	}
+	tv.SetTokenizer(l.Tokenizer())
+	return nil
+}
+
+// languageTokenizer drops stopwords and stems the remaining words
+type languageTokenizer struct {
+	entry languageEntry
+}
+
+// Tokens returns the stemmed words of text that are not stopwords
+func (lt *languageTokenizer) Tokens(text string) []string {
+	var tokens []string
+	for _, word := range words(text) {
+		if _, stop := lt.entry.stopwords[word]; stop {
+			continue
+		}
+		if lt.entry.stem != nil {
+			word = lt.entry.stem(word)
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// words splits text into lower-cased words without surrounding punctuation.
+// Scripts written without spaces, such as Chinese, Japanese and Thai, give
+// no words to split on, so their runs become overlapping character bigrams.
+func words(text string) []string {
+	return appendWords(nil, text)
+}
+
+// appendWords appends the words of text to result, so a caller splitting
+// many texts can reuse one slice
+func appendWords(result []string, text string) []string {
+	for {
+		start := strings.IndexFunc(text, isNotSpace)
+		if start < 0 {
+			return result
+		}
+		text = text[start:]
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		word := strings.ToLower(strings.TrimFunc(text[:end], isWordPunctuation))
+		text = text[end:]
+		if word == "" {
+			continue
+		}
+		if strings.IndexFunc(word, isNoSpaceScript) >= 0 {
+			result = appendSegments(result, word)
+		} else {
+			result = append(result, word)
+		}
+	}
+}
+
+func isNotSpace(r rune) bool {
+	return !unicode.IsSpace(r)
+}
+
+// wordPunctuation is the punctuation trimmed from the ends of words
+var wordPunctuation = func() (set [utf8.RuneSelf]bool) {
+	for _, c := range ".,!?:;\"'()[]{}" {
+		set[c] = true
+	}
+	return set
+}()
+
+func isWordPunctuation(r rune) bool {
+	return r < utf8.RuneSelf && wordPunctuation[r]
+}
+
+// tokenCounts counts the tokens of text, using plain words when t is nil
+func tokenCounts(t Tokenizer, text string) map[string]int {
+	if t == nil {
+		return wordCounts(text)
+	}
+	counts := make(map[string]int)
+	for _, token := range t.Tokens(text) {
+		counts[token]++
+	}
+	return counts
+}
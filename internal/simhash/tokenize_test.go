@@ -0,0 +1,81 @@
+package simhash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Language
+		wantErr bool
+	}{
+		{"", NoLanguage, false},
+		{"none", NoLanguage, false},
+		{"en", English, false},
+		{"klingon", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLanguage(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLanguage(%q) = %q, %v, want %q (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEnglishTokenizer(t *testing.T) {
+	got := English.Tokenizer().Tokens("The runner was running, and she runs!")
+	want := []string{"runner", "run", "run"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokens = %q, want %q", got, want)
+	}
+	if NoLanguage.Tokenizer() != nil {
+		t.Error("NoLanguage should not have a tokenizer")
+	}
+}
+
+func TestLanguageApply(t *testing.T) {
+	for _, v := range []Vectorizer{
+		NewFrequencyVectorizer(VectorDimensions),
+		NewNGramVectorizer(VectorDimensions, 3),
+		NewTFIDFVectorizer(VectorDimensions),
+	} {
+		if err := English.Apply(v); err != nil {
+			t.Errorf("Apply(%T) failed: %v", v, err)
+		}
+	}
+
+	type plain struct{ Vectorizer }
+	if err := English.Apply(plain{}); err == nil {
+		t.Error("expected an error for a vectorizer without a tokenizer")
+	}
+	if err := NoLanguage.Apply(plain{}); err != nil {
+		t.Errorf("NoLanguage should apply to any vectorizer, got %v", err)
+	}
+}
+
+func TestRewordedTextStaysClose(t *testing.T) {
+	original := "The researchers studied how the students learned new languages, and they found that the learners " +
+		"who practised daily were remembering far more words than the others"
+	reworded := "Researchers study how students learn a new language, and found learners " +
+		"practising every day remember many more words than others"
+
+	hyperplanes := GenerateHyperplanes(VectorDimensions, 64)
+	distance := func(lang Language) int {
+		v := NewFrequencyVectorizer(VectorDimensions)
+		if err := lang.Apply(v); err != nil {
+			t.Fatal(err)
+		}
+		a := CalculateWithVectorizer(original, hyperplanes, v)
+		b := CalculateWithVectorizer(reworded, hyperplanes, v)
+		return a.HammingDistance(b)
+	}
+
+	plain, english := distance(NoLanguage), distance(English)
+	if english >= plain {
+		t.Errorf("stemming and stopwords should bring the reworded text closer: distance %d with English, %d without", english, plain)
+	}
+	t.Logf("Hamming distance: %d without language, %d with English", plain, english)
+}
@@ -0,0 +1,107 @@
+package simhash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// VectorNormalizer is the normalization used with the vector vectorizer:
+// none, since its text is numbers
+const VectorNormalizer = "none"
+
+// VectorVectorizer reads a vector that was computed elsewhere from its
+// text: numbers separated by commas or whitespace, optionally in brackets,
+// so a JSON array works. It lets indexes of precomputed embeddings be
+// queried like any other, with the vector as the query text.
+//
+// TextToVector cannot fail, so the first text that is not a vector of the
+// right length is reported by Err, as for ExecVectorizer, and gives a zero
+// vector.
+type VectorVectorizer struct {
+	dimensions int
+
+	mu  sync.Mutex
+	err error
+}
+
+func init() {
+	RegisterVectorizer("vector", map[string]string{"dims": ""},
+		func(p VectorizerParams) (Vectorizer, error) {
+			if p["dims"] == "" {
+				return nil, fmt.Errorf("vector vectorizer needs dims, the length of the vectors")
+			}
+			dims, err := p.Dims()
+			if err != nil {
+				return nil, err
+			}
+			return NewVectorVectorizer(dims), nil
+		})
+}
+
+// NewVectorVectorizer creates a vectorizer for vectors of the given
+// dimensions
+func NewVectorVectorizer(dimensions int) *VectorVectorizer {
+	return &VectorVectorizer{dimensions: dimensions}
+}
+
+// TextToVector parses text as a vector, or returns a zero vector when it is
+// not one
+func (vv *VectorVectorizer) TextToVector(text string) []float64 {
+	vector, err := ParseVector(text)
+	if err == nil && len(vector) != vv.dimensions {
+		err = fmt.Errorf("vector has %d dimensions, expected %d", len(vector), vv.dimensions)
+	}
+	if err == nil {
+		return vector
+	}
+
+	vv.mu.Lock()
+	if vv.err == nil {
+		vv.err = err
+	}
+	vv.mu.Unlock()
+	return make([]float64, vv.dimensions)
+}
+
+// Err returns the first error TextToVector met, if any
+func (vv *VectorVectorizer) Err() error {
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	return vv.err
+}
+
+// Dimensions returns the number of vector dimensions
+func (vv *VectorVectorizer) Dimensions() int {
+	return vv.dimensions
+}
+
+// ParseVector parses numbers separated by commas or whitespace, optionally
+// in square brackets, such as a JSON array. Every number must be finite.
+func ParseVector(text string) ([]float64, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "[") {
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("vector has no closing bracket")
+		}
+		text = text[1 : len(text)-1]
+	}
+
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("vector has no numbers")
+	}
+	vector := make([]float64, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("vector component %d is not a finite number: %q", i, field)
+		}
+		vector[i] = v
+	}
+	return vector, nil
+}
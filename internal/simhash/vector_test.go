@@ -0,0 +1,59 @@
+package simhash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVector(t *testing.T) {
+	want := []float64{0.5, -1, 2e-3}
+	for _, text := range []string{"[0.5, -1, 2e-3]", "0.5 -1 2e-3\n", " [0.5,-1,\t0.002] "} {
+		got, err := ParseVector(text)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseVector(%q) = %v, %v; want %v", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"", "[]", "[1, 2", "1, two", "1, NaN", "[1, Inf]"} {
+		if _, err := ParseVector(text); err == nil {
+			t.Errorf("ParseVector(%q): expected an error", text)
+		}
+	}
+}
+
+func TestVectorVectorizer(t *testing.T) {
+	cfg, err := ParseVectorizerConfig("vector:dims=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := cfg.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.TextToVector("[1, 2, 3]"); !reflect.DeepEqual(got, []float64{1, 2, 3}) {
+		t.Errorf("TextToVector = %v", got)
+	}
+	if err := VectorizerErr(v); err != nil {
+		t.Errorf("Err = %v", err)
+	}
+
+	// Hyperplane fingerprints of a vector match those of its text
+	hyperplanes := GenerateHyperplanesWithSeed(3, 64, DefaultSeed)
+	projector := NewProjector(64, hyperplanes)
+	if got, want := projector.FingerprintVector([]float64{1, 2, 3}), CalculateFingerprint(Hyperplane, 64, "1 2 3", hyperplanes, v); got != want {
+		t.Errorf("FingerprintVector = %s, want %s", got, want)
+	}
+
+	if got := v.TextToVector("[1, 2]"); !reflect.DeepEqual(got, []float64{0, 0, 0}) {
+		t.Errorf("TextToVector of a short vector = %v, want a zero vector", got)
+	}
+	if VectorizerErr(v) == nil {
+		t.Error("expected an error for a vector of other dimensions")
+	}
+
+	if cfg, err = ParseVectorizerConfig("vector"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.New(); err == nil {
+		t.Error("expected an error for a vector vectorizer without dims")
+	}
+}
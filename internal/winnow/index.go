@@ -0,0 +1,175 @@
+package winnow
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+)
+
+// maxOccurrences is how often a fingerprint may occur in the corpus and
+// still locate passages. More frequent ones are boilerplate, and matching
+// them would pair every occurrence with every other.
+const maxOccurrences = 64
+
+// Passage is a stretch of a query that also occurs in the corpus
+type Passage struct {
+	QueryStart   int64 // Byte range in the query
+	QueryEnd     int64
+	SourceStart  int64 // Byte range in the corpus
+	SourceEnd    int64
+	Fingerprints int // Shared fingerprints the passage was assembled from
+}
+
+// Index maps fingerprint hashes to where they occur in a corpus
+type Index struct {
+	config      Config
+	occurrences map[uint64][]Fingerprint
+	count       int
+}
+
+// NewIndex creates an empty index for fingerprints selected with cfg
+func NewIndex(cfg Config) *Index {
+	return &Index{config: cfg, occurrences: make(map[uint64][]Fingerprint)}
+}
+
+// Config returns the configuration of the indexed fingerprints
+func (ix *Index) Config() Config {
+	return ix.config
+}
+
+// Len returns the number of indexed fingerprints
+func (ix *Index) Len() int {
+	return ix.count
+}
+
+// Add indexes a fingerprint of the corpus
+func (ix *Index) Add(fp Fingerprint) {
+	ix.occurrences[fp.Hash] = append(ix.occurrences[fp.Hash], fp)
+	ix.count++
+}
+
+// Occurrences returns where a fingerprint hash occurs in the corpus
+func (ix *Index) Occurrences(hash uint64) []Fingerprint {
+	return ix.occurrences[hash]
+}
+
+// hit pairs a fingerprint of the query with the same one in the corpus
+type hit struct {
+	query, source Fingerprint
+}
+
+// diagonal is how far the corpus copy is shifted from the query, in
+// normalized characters. It stays the same along a copied passage however
+// its whitespace and punctuation were changed.
+func (h hit) diagonal() int64 {
+	return h.source.Pos - h.query.Pos
+}
+
+// Match locates the passages of a query, given as its fingerprints, that
+// also occur in the corpus. Shared fingerprints on the same diagonal no more
+// than a window apart belong to one passage. Passages are ordered by their
+// position in the query.
+func (ix *Index) Match(query []Fingerprint) []Passage {
+	var hits []hit
+	for _, q := range query {
+		occurrences := ix.occurrences[q.Hash]
+		if len(occurrences) > maxOccurrences {
+			continue
+		}
+		for _, s := range occurrences {
+			hits = append(hits, hit{query: q, source: s})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if di, dj := hits[i].diagonal(), hits[j].diagonal(); di != dj {
+			return di < dj
+		}
+		return hits[i].query.Pos < hits[j].query.Pos
+	})
+
+	var passages []Passage
+	for i, h := range hits {
+		if i > 0 && h.diagonal() == hits[i-1].diagonal() &&
+			h.query.Pos-hits[i-1].query.Pos <= int64(ix.config.Window) {
+			p := &passages[len(passages)-1]
+			p.QueryEnd = max(p.QueryEnd, h.query.End)
+			p.SourceEnd = max(p.SourceEnd, h.source.End)
+			p.Fingerprints++
+			continue
+		}
+		passages = append(passages, Passage{
+			QueryStart:   h.query.Start,
+			QueryEnd:     h.query.End,
+			SourceStart:  h.source.Start,
+			SourceEnd:    h.source.End,
+			Fingerprints: 1,
+		})
+	}
+
+	// A phrase repeated within a passage also matches off its diagonal;
+	// those echoes lie inside the passage in both texts
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].QueryEnd-passages[i].QueryStart > passages[j].QueryEnd-passages[j].QueryStart
+	})
+	kept := passages[:0]
+	for _, p := range passages {
+		echo := false
+		for _, k := range kept {
+			if k.contains(p) {
+				echo = true
+				break
+			}
+		}
+		if !echo {
+			kept = append(kept, p)
+		}
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].QueryStart != kept[j].QueryStart {
+			return kept[i].QueryStart < kept[j].QueryStart
+		}
+		return kept[i].SourceStart < kept[j].SourceStart
+	})
+	return kept
+}
+
+// contains reports whether other lies within p in both texts
+func (p Passage) contains(other Passage) bool {
+	return other.QueryStart >= p.QueryStart && other.QueryEnd <= p.QueryEnd &&
+		other.SourceStart >= p.SourceStart && other.SourceEnd <= p.SourceEnd
+}
+
+// indexState is the persisted form of an index
+type indexState struct {
+	Config       Config
+	Fingerprints []Fingerprint
+}
+
+// MarshalBinary encodes the indexed fingerprints in position order
+func (ix *Index) MarshalBinary() ([]byte, error) {
+	state := indexState{Config: ix.config, Fingerprints: make([]Fingerprint, 0, ix.count)}
+	for _, fps := range ix.occurrences {
+		state.Fingerprints = append(state.Fingerprints, fps...)
+	}
+	sort.Slice(state.Fingerprints, func(i, j int) bool {
+		return state.Fingerprints[i].Pos < state.Fingerprints[j].Pos
+	})
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(state)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary restores an index written by MarshalBinary
+func (ix *Index) UnmarshalBinary(data []byte) error {
+	var state indexState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+	*ix = *NewIndex(state.Config)
+	for _, fp := range state.Fingerprints {
+		ix.Add(fp)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+// Package winnow selects position-tagged fingerprints of a text by
+// winnowing (Schleimer, Wilkerson and Aiken, 2003), the technique behind
+// MOSS. Any passage two texts share that is long enough shares at least one
+// fingerprint wherever it sits in either text, so copied passages can be
+// located down to their byte ranges.
+package winnow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hashBase is the multiplier of the rolling k-gram hash
+const hashBase = 0x100000001b3
+
+// Config describes how fingerprints are selected. Fingerprints are only
+// comparable when they were selected with the same Config.
+type Config struct {
+	K      int // Characters per k-gram, counted after normalization
+	Window int // Consecutive k-grams each fingerprint is the minimum of
+}
+
+// DefaultConfig returns 30-character k-grams winnowed over windows of 20,
+// which finds every shared passage of about ten words
+func DefaultConfig() Config {
+	return Config{K: 30, Window: 20}
+}
+
+// Enabled reports whether the config describes fingerprints at all; the
+// zero Config is used by indexes that store none
+func (c Config) Enabled() bool {
+	return c.K > 0
+}
+
+// Validate checks that the config can build a Winnower
+func (c Config) Validate() error {
+	if c.K <= 0 {
+		return fmt.Errorf("winnowing k-gram length must be positive, got %d", c.K)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("winnowing window must be positive, got %d", c.Window)
+	}
+	return nil
+}
+
+// Guarantee returns the length, in normalized characters, from which every
+// shared passage is certain to share a fingerprint
+func (c Config) Guarantee() int {
+	return c.Window + c.K - 1
+}
+
+// Fingerprint is the hash of one selected k-gram and where it occurs
+type Fingerprint struct {
+	Hash  uint64
+	Pos   int64 // Normalized character the k-gram starts at
+	Start int64 // Byte offset of the k-gram's first character
+	End   int64 // Byte offset just after its last character
+}
+
+// Winnower selects the fingerprints of texts. Only letters and digits
+// count, lower-cased, so whitespace, punctuation and case changes do not
+// hide a copied passage.
+type Winnower struct {
+	config Config
+	power  uint64 // hashBase^(K-1), removes the oldest character
+}
+
+// NewWinnower creates a winnower for cfg
+func NewWinnower(cfg Config) (*Winnower, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	power := uint64(1)
+	for i := 1; i < cfg.K; i++ {
+		power *= hashBase
+	}
+	return &Winnower{config: cfg, power: power}, nil
+}
+
+// Config returns the configuration the winnower was built with
+func (w *Winnower) Config() Config {
+	return w.config
+}
+
+// Fingerprints returns the fingerprints of text in position order
+func (w *Winnower) Fingerprints(text string) []Fingerprint {
+	var fps []Fingerprint
+	w.Read(strings.NewReader(text), func(fp Fingerprint) {
+		fps = append(fps, fp)
+	})
+	return fps
+}
+
+// Read selects the fingerprints of the text read from r as it is read and
+// hands them to fn in position order. Memory does not grow with the text.
+func (w *Winnower) Read(r io.Reader, fn func(Fingerprint)) error {
+	k, window := w.config.K, w.config.Window
+
+	// The last k characters: their values and where each starts
+	chars := make([]rune, k)
+	starts := make([]int64, k)
+	// Candidates for the minimum of the current window, hashes increasing
+	var queue []Fingerprint
+	var hash uint64
+	var offset, count int64
+	selected := int64(-1)
+
+	br := bufio.NewReader(r)
+	for {
+		c, size, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start := offset
+		offset += int64(size)
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			continue
+		}
+		c = unicode.ToLower(c)
+
+		slot := count % int64(k)
+		if count >= int64(k) {
+			hash -= uint64(chars[slot]) * w.power
+		}
+		hash = hash*hashBase + uint64(c)
+		chars[slot], starts[slot] = c, start
+		count++
+		if count < int64(k) {
+			continue
+		}
+
+		// The k-gram ending here starts at the oldest character
+		pos := count - int64(k)
+		fp := Fingerprint{Hash: mix64(hash), Pos: pos, Start: starts[count%int64(k)], End: offset}
+		for len(queue) > 0 && queue[len(queue)-1].Hash >= fp.Hash {
+			queue = queue[:len(queue)-1]
+		}
+		queue = append(queue, fp)
+		if queue[0].Pos <= pos-int64(window) {
+			queue = queue[1:]
+		}
+
+		// Each full window selects its rightmost minimum, once
+		if pos >= int64(window)-1 && queue[0].Pos != selected {
+			selected = queue[0].Pos
+			fn(queue[0])
+		}
+	}
+
+	// A text shorter than one window still gets its minimum
+	if kgrams := count - int64(k) + 1; kgrams > 0 && kgrams < int64(window) {
+		fn(queue[0])
+	}
+	return nil
+}
+
+// Extend widens a passage found by Match to the full extent of the shared
+// text. Match only knows the selected k-grams, and a copy can start up to a
+// window of k-grams before the first one and end up to a window after the
+// last, so the normalized characters around the passage are compared in
+// both texts.
+func (w *Winnower) Extend(p Passage, query, source io.ReaderAt) (Passage, error) {
+	// Every normalized character is one rune, but whitespace and
+	// punctuation between them are read too
+	margin := int64(w.config.Window) * 4 * utf8.UTFMax
+
+	qBefore, err := normalizedBefore(query, p.QueryStart, margin)
+	if err != nil {
+		return p, err
+	}
+	sBefore, err := normalizedBefore(source, p.SourceStart, margin)
+	if err != nil {
+		return p, err
+	}
+	for i := 1; i <= min(len(qBefore), len(sBefore), w.config.Window); i++ {
+		q, s := qBefore[len(qBefore)-i], sBefore[len(sBefore)-i]
+		if q.char != s.char {
+			break
+		}
+		p.QueryStart, p.SourceStart = q.start, s.start
+	}
+
+	qAfter, err := normalizedAfter(query, p.QueryEnd, margin)
+	if err != nil {
+		return p, err
+	}
+	sAfter, err := normalizedAfter(source, p.SourceEnd, margin)
+	if err != nil {
+		return p, err
+	}
+	for i := 0; i < min(len(qAfter), len(sAfter), w.config.Window); i++ {
+		q, s := qAfter[i], sAfter[i]
+		if q.char != s.char {
+			break
+		}
+		p.QueryEnd, p.SourceEnd = q.end, s.end
+	}
+	return p, nil
+}
+
+// normalizedChar is a character that counts towards k-grams and its byte
+// range
+type normalizedChar struct {
+	char       rune
+	start, end int64
+}
+
+// normalizedBefore returns the normalized characters in the margin bytes
+// before offset. The first may be the tail of a character cut in half.
+func normalizedBefore(r io.ReaderAt, offset, margin int64) ([]normalizedChar, error) {
+	start := max(0, offset-margin)
+	return readNormalized(r, start, offset-start)
+}
+
+// normalizedAfter returns the normalized characters in the margin bytes
+// from offset
+func normalizedAfter(r io.ReaderAt, offset, margin int64) ([]normalizedChar, error) {
+	return readNormalized(r, offset, margin)
+}
+
+// readNormalized returns the normalized characters of up to n bytes at
+// offset
+func readNormalized(r io.ReaderAt, offset, n int64) ([]normalizedChar, error) {
+	data := make([]byte, n)
+	read, err := r.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = data[:read]
+
+	var chars []normalizedChar
+	for i := 0; i < len(data); {
+		c, size := utf8.DecodeRune(data[i:])
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			start := offset + int64(i)
+			chars = append(chars, normalizedChar{unicode.ToLower(c), start, start + int64(size)})
+		}
+		i += size
+	}
+	return chars, nil
+}
+
+// mix64 is the splitmix64 finalizer. The low bits of a polynomial hash
+// modulo 2^64 only depend on the low bits of the characters, so the hash
+// is mixed before minima are taken.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
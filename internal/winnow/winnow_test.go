@@ -0,0 +1,198 @@
+package winnow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		wantErr bool
+	}{
+		{DefaultConfig(), false},
+		{Config{K: 5, Window: 1}, false},
+		{Config{}, true},
+		{Config{K: 5}, true},
+		{Config{K: -1, Window: 4}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFingerprintsCoverEveryWindow(t *testing.T) {
+	cfg := Config{K: 5, Window: 4}
+	w, err := NewWinnower(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "A do run run run, a do run run. Winnowing selects local minima of k-gram hashes!"
+	fps := w.Fingerprints(text)
+	if len(fps) == 0 {
+		t.Fatal("no fingerprints")
+	}
+
+	normalized := 0
+	for _, r := range strings.ToLower(text) {
+		if r >= 'a' && r <= 'z' {
+			normalized++
+		}
+	}
+	kgrams := int64(normalized - cfg.K + 1)
+
+	for i, fp := range fps {
+		// Every k-gram spans K letters of the original text
+		letters := 0
+		for _, r := range text[fp.Start:fp.End] {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+				letters++
+			}
+		}
+		if letters != cfg.K {
+			t.Errorf("fingerprint %d spans %q, want %d letters", i, text[fp.Start:fp.End], cfg.K)
+		}
+		if i > 0 && fp.Pos <= fps[i-1].Pos {
+			t.Errorf("fingerprints out of order: %d after %d", fp.Pos, fps[i-1].Pos)
+		}
+	}
+
+	// Every window of Window k-grams contains a selected one
+	for start := int64(0); start+int64(cfg.Window) <= kgrams; start++ {
+		covered := false
+		for _, fp := range fps {
+			if fp.Pos >= start && fp.Pos < start+int64(cfg.Window) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			t.Errorf("window at %d has no fingerprint", start)
+		}
+	}
+}
+
+func TestFingerprintsIgnoreFormatting(t *testing.T) {
+	w, _ := NewWinnower(Config{K: 8, Window: 3})
+	a := w.Fingerprints("The quick brown fox jumps over the lazy dog")
+	b := w.Fingerprints("the QUICK, brown   fox -- jumps over\nthe lazy dog.")
+
+	hashes := func(fps []Fingerprint) []uint64 {
+		var hs []uint64
+		for _, fp := range fps {
+			hs = append(hs, fp.Hash)
+		}
+		return hs
+	}
+	if !reflect.DeepEqual(hashes(a), hashes(b)) {
+		t.Errorf("formatting changed the fingerprints: %x != %x", hashes(a), hashes(b))
+	}
+}
+
+func TestShortText(t *testing.T) {
+	w, _ := NewWinnower(Config{K: 4, Window: 10})
+	if fps := w.Fingerprints("abc"); len(fps) != 0 {
+		t.Errorf("text shorter than k gave %d fingerprints", len(fps))
+	}
+	if fps := w.Fingerprints("abcdef"); len(fps) != 1 {
+		t.Errorf("text shorter than a window gave %d fingerprints, want its minimum", len(fps))
+	}
+}
+
+func TestMatchLocatesPassage(t *testing.T) {
+	cfg := Config{K: 12, Window: 8}
+	w, _ := NewWinnower(cfg)
+
+	copied := "It was the best of times, it was the worst of times, it was the age of wisdom."
+	corpus := strings.Repeat("Completely unrelated filler text about gardening and tomatoes. ", 5) +
+		copied + " More filler on the subject of weather patterns in late autumn."
+	query := "My essay begins in my own words, and then: " +
+		strings.ReplaceAll(copied, " ", "  ") + " Then it ends in my words again."
+
+	ix := NewIndex(cfg)
+	for _, fp := range w.Fingerprints(corpus) {
+		ix.Add(fp)
+	}
+	passages := ix.Match(w.Fingerprints(query))
+	if len(passages) != 1 {
+		t.Fatalf("got %d passages, want 1: %+v", len(passages), passages)
+	}
+
+	p := passages[0]
+	copyStart := int64(strings.Index(corpus, copied))
+	if p.SourceStart < copyStart || p.SourceEnd > copyStart+int64(len(copied)) {
+		t.Errorf("source range %d-%d is outside the copy at %d-%d", p.SourceStart, p.SourceEnd, copyStart, copyStart+int64(len(copied)))
+	}
+	if covered := p.SourceEnd - p.SourceStart; covered < int64(len(copied))/2 {
+		t.Errorf("source range %d-%d covers too little of the copy", p.SourceStart, p.SourceEnd)
+	}
+	queryCopy := query[p.QueryStart:p.QueryEnd]
+	if !strings.Contains(strings.ReplaceAll(copied, " ", "  "), queryCopy) {
+		t.Errorf("query range %q is not part of the copy", queryCopy)
+	}
+	if p.Fingerprints < 2 {
+		t.Errorf("passage assembled from %d fingerprints", p.Fingerprints)
+	}
+
+	if got := ix.Match(w.Fingerprints("Nothing in common with the corpus at all here.")); len(got) != 0 {
+		t.Errorf("unrelated query matched %+v", got)
+	}
+}
+
+func TestIndexMarshal(t *testing.T) {
+	cfg := Config{K: 6, Window: 4}
+	w, _ := NewWinnower(cfg)
+	ix := NewIndex(cfg)
+	for _, fp := range w.Fingerprints("the quick brown fox jumps over the lazy dog, the quick brown fox") {
+		ix.Add(fp)
+	}
+
+	data, err := ix.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Index
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Config() != cfg || restored.Len() != ix.Len() {
+		t.Fatalf("restored %+v with %d fingerprints, want %+v with %d", restored.Config(), restored.Len(), cfg, ix.Len())
+	}
+	query := w.Fingerprints("quick brown fox jumps")
+	if !reflect.DeepEqual(restored.Match(query), ix.Match(query)) {
+		t.Error("restored index matches differently")
+	}
+}
+
+func TestExtendFindsWholeCopy(t *testing.T) {
+	cfg := Config{K: 10, Window: 6}
+	w, _ := NewWinnower(cfg)
+
+	copied := "Sphinx of black quartz, judge my vow; pack my box with five dozen liquor jugs"
+	corpus := "Filler about gardening and tomatoes. " + copied + ". Unrelated closing remarks."
+	query := "An opening in other phrasing: " + strings.ToUpper(copied) + "! Quite different ending."
+
+	ix := NewIndex(cfg)
+	for _, fp := range w.Fingerprints(corpus) {
+		ix.Add(fp)
+	}
+	passages := ix.Match(w.Fingerprints(query))
+	if len(passages) != 1 {
+		t.Fatalf("got %d passages, want 1: %+v", len(passages), passages)
+	}
+
+	p, err := w.Extend(passages[0], strings.NewReader(query), strings.NewReader(corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := corpus[p.SourceStart:p.SourceEnd]; got != copied {
+		t.Errorf("source range covers %q, want %q", got, copied)
+	}
+	if got := query[p.QueryStart:p.QueryEnd]; got != strings.ToUpper(copied) {
+		t.Errorf("query range covers %q, want the upper-cased copy", got)
+	}
+}